@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"og-image-generator/ogimage"
+)
+
+// BatchOptions holds the configuration for batch mode
+type BatchOptions struct {
+	Manifest string
+	Format   string
+	Workers  int
+	Verbose  bool
+	Defaults ogimage.Options
+}
+
+func parseBatchFlags(args []string) (*BatchOptions, error) {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	format := fs.String("format", "", "Manifest format: csv, json or jsonl (default: from file extension)")
+	width := fs.Int("width", ogimage.DefaultWidth, "Default image width in pixels")
+	height := fs.Int("height", ogimage.DefaultHeight, "Default image height in pixels")
+	resolveTheme := themeFlags(fs)
+	resolveBgImage := bgImageFlags(fs)
+	resolveLogo := logoFlags(fs)
+	resolveTitleLayout := titleLayoutFlags(fs)
+	resolveTags := tagFlags(fs)
+	resolveInlineFonts := inlineFontFlags(fs)
+	resolveFontAxes := fontAxesFlags(fs)
+	titleFont := fs.String("title-font", "", "Default title font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	urlFont := fs.String("url-font", "", "Default URL font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	titleSize := fs.Float64("title-size", ogimage.TitleFontSize, "Default title font size in points")
+	maxLines := fs.Int("max-lines", 0, "Cut the title to this many lines, ending with an ellipsis (0 for no limit)")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "Number of images to render concurrently")
+	verbose := fs.Bool("verbose", false, "Report layout details, such as the size chosen by -title-fit")
+	configPath := fs.String("config", "", "Config file of default flag values (default .og-image.yaml if present)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := applyConfigFile(fs, *configPath); err != nil {
+		return nil, err
+	}
+	theme, err := resolveTheme()
+	if err != nil {
+		return nil, err
+	}
+	logo, err := resolveLogo()
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("batch requires exactly one manifest file")
+	}
+	if *workers < 1 {
+		return nil, fmt.Errorf("workers must be at least 1")
+	}
+	if *maxLines < 0 {
+		return nil, fmt.Errorf("max-lines must not be negative")
+	}
+
+	opts := &BatchOptions{
+		Manifest: fs.Arg(0),
+		Format:   *format,
+		Workers:  *workers,
+		Verbose:  *verbose,
+		Defaults: ogimage.Options{
+			Width:     *width,
+			Height:    *height,
+			BgColor:   theme.Background,
+			Theme:     theme,
+			TitleFont: *titleFont,
+			URLFont:   *urlFont,
+			TitleSize: *titleSize,
+			MaxLines:  *maxLines,
+			Logo:      logo,
+		},
+	}
+	if err := resolveBgImage(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	if err := resolveTitleLayout(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	if err := resolveTags(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	resolveInlineFonts(&opts.Defaults)
+	if err := resolveFontAxes(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func runBatch(args []string, resolver ogimage.FontResolver) error {
+	opts, err := parseBatchFlags(args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := readManifest(opts.Manifest, opts.Format)
+	if err != nil {
+		return err
+	}
+
+	if err := createOutputDirs(rows); err != nil {
+		return err
+	}
+
+	// A single renderer parses each font file once for the whole batch
+	renderer := &ogimage.Renderer{ResolveFont: resolver}
+	if opts.Verbose {
+		renderer.Logf = logVerbose
+	}
+
+	failed := renderJobs(renderer, rows, opts.Defaults, opts.Workers, printJobResult)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed", failed, len(rows))
+	}
+	return nil
+}
+
+// createOutputDirs creates the parent directory of every output path
+func createOutputDirs(rows []Job) error {
+	created := make(map[string]bool)
+	for _, row := range rows {
+		dir := filepath.Dir(row.Output)
+		if created[dir] {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create output directory: %w", err)
+		}
+		created[dir] = true
+	}
+	return nil
+}
+
+// readManifest reads all rows from a CSV, JSON or JSON Lines manifest.
+// If format is empty it is inferred from the file extension.
+func readManifest(path, format string) ([]Job, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".json":
+			format = "json"
+		case ".jsonl", ".ndjson":
+			format = "jsonl"
+		default:
+			return nil, fmt.Errorf("cannot infer manifest format from %q, use -format csv, -format json or -format jsonl", path)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open manifest: %w", err)
+	}
+	defer f.Close()
+
+	switch format {
+	case "csv":
+		return readCSVManifest(f, path)
+	case "json":
+		return readJSONManifest(f, path)
+	case "jsonl":
+		return readJSONLManifest(f, path)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q", format)
+	}
+}
+
+// readCSVManifest reads a CSV manifest whose first row names the columns
+func readCSVManifest(r io.Reader, name string) ([]Job, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: manifest is empty", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if !slices.Contains(batchColumns, col) {
+			return nil, fmt.Errorf("%s:1: unknown column %q", name, col)
+		}
+		columns[i] = col
+		seen[col] = true
+	}
+	for _, required := range []string{"title", "url", "output"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("%s:1: missing required column %q", name, required)
+		}
+	}
+
+	var rows []Job
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := Job{source: name, line: line}
+		for i, value := range record {
+			if err := row.set(columns[i], strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		}
+		if err := row.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// batchColumns lists the CSV columns, matching the JSON field names
+var batchColumns = []string{"title", "url", "output", "subtitle", "author", "date", "tags", "bg", "bg_image", "title_font", "url_font", "title_size", "width", "height"}
+
+// set assigns a CSV cell to the field named by column
+func (row *Job) set(column, value string) error {
+	var err error
+	switch column {
+	case "title":
+		row.Title = value
+	case "url":
+		row.URL = value
+	case "output":
+		row.Output = value
+	case "subtitle":
+		row.Subtitle = value
+	case "author":
+		row.Author = value
+	case "date":
+		row.Date = value
+	case "tags":
+		row.Tags = splitList(value)
+	case "bg":
+		row.BgColor = value
+	case "bg_image":
+		row.BgImage = value
+	case "title_font":
+		row.TitleFont = value
+	case "url_font":
+		row.URLFont = value
+	case "title_size":
+		if value != "" {
+			if row.TitleSize, err = strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("title_size: %q is not a number", value)
+			}
+		}
+	case "width":
+		if value != "" {
+			if row.Width, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("width: %q is not an integer", value)
+			}
+		}
+	case "height":
+		if value != "" {
+			if row.Height, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("height: %q is not an integer", value)
+			}
+		}
+	}
+	return nil
+}
+
+// readJSONLManifest reads a manifest with one JSON object per line.
+// Blank lines are skipped.
+func readJSONLManifest(r io.Reader, name string) ([]Job, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rows []Job
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		row := Job{source: name, line: line}
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if dec.More() {
+			return nil, fmt.Errorf("%s:%d: unexpected data after JSON object", name, line)
+		}
+		if err := row.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return rows, nil
+}
+
+// readJSONManifest reads a manifest that is a JSON array of row objects,
+// numbering each row by the line its object starts on
+func readJSONManifest(r io.Reader, name string) ([]Job, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	// lineAt is the line of the first value after offset
+	lineAt := func(offset int64) int {
+		start := len(data) - len(bytes.TrimLeft(data[offset:], " \t\r\n,"))
+		return 1 + bytes.Count(data[:start], []byte("\n"))
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("%s:%d: manifest must be a JSON array of objects", name, lineAt(0))
+	}
+
+	var rows []Job
+	for dec.More() {
+		line := lineAt(dec.InputOffset())
+		row := Job{source: name, line: line}
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if err := row.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rows = append(rows, row)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%s: unexpected data after JSON array", name)
+	}
+
+	return rows, nil
+}
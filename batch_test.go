@@ -0,0 +1,315 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"og-image-generator/ogimage"
+)
+
+// writeManifest writes content to a manifest file in a temp directory
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadCSVManifest(t *testing.T) {
+	t.Run("required and optional columns", func(t *testing.T) {
+		path := writeManifest(t, "cards.csv", `title,url,output,subtitle,author,date,tags,bg,bg_image,title_size,width,height
+"Hello, World",https://example.com/a,out/a.png,,,,,,,,,
+Second Post,https://example.com/b,out/b.png,A short tour,Ada,"March 5, 2024","go, graphics",#ff0000,hero.jpg,60,800,400
+`)
+		rows, err := readManifest(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("got %d rows, want 2", len(rows))
+		}
+		if rows[0].Title != "Hello, World" || rows[0].Output != "out/a.png" || rows[0].label() != path+":2" {
+			t.Errorf("unexpected first row: %+v", rows[0])
+		}
+		if rows[1].Subtitle != "A short tour" || rows[1].Author != "Ada" || rows[1].Date != "March 5, 2024" {
+			t.Errorf("unexpected second row byline: %+v", rows[1])
+		}
+		if !slices.Equal(rows[1].Tags, []string{"go", "graphics"}) || rows[0].Tags != nil {
+			t.Errorf("tags = %q, %q, want none and [go graphics]", rows[0].Tags, rows[1].Tags)
+		}
+		if rows[1].BgColor != "#ff0000" || rows[1].BgImage != "hero.jpg" || rows[1].TitleSize != 60 || rows[1].Width != 800 || rows[1].Height != 400 {
+			t.Errorf("unexpected second row: %+v", rows[1])
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty file", "", "manifest is empty"},
+		{"unknown column", "title,url,output,color\n", `unknown column "color"`},
+		{"missing column", "title,url\n", `missing required column "output"`},
+		{"missing value", "title,url,output\nHello,,out.png\n", "cards.csv:2: title, url and output are required"},
+		{"invalid number", "title,url,output,title_size\nHello,https://example.com,out.png,big\n", "cards.csv:2: title_size"},
+		{"title size NaN", "title,url,output,title_size\nHello,https://example.com,out.png,NaN\n", "cards.csv:2: title_size must be a number"},
+		{"title size infinite", "title,url,output,title_size\nHello,https://example.com,out.png,+Inf\n", "cards.csv:2: title_size must be a number"},
+		{"invalid width", "title,url,output,width\nHello,https://example.com,out.png,wide\n", "cards.csv:2: width"},
+		{"invalid bg", "title,url,output,bg\nHello,https://example.com,out.png,#ff000\n", `cards.csv:2: bg: invalid color "#ff000"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeManifest(t, "cards.csv", tt.content)
+			_, err := readManifest(path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadJSONLManifest(t *testing.T) {
+	t.Run("rows with blank lines", func(t *testing.T) {
+		path := writeManifest(t, "cards.jsonl", `{"title": "First", "url": "https://example.com/a", "output": "a.png"}
+
+{"title": "Second", "url": "https://example.com/b", "output": "b.png", "bg": "#00ff00", "title_font": "/t.ttf", "url_font": "/u.ttf"}
+`)
+		rows, err := readManifest(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("got %d rows, want 2", len(rows))
+		}
+		if rows[1].label() != path+":3" {
+			t.Errorf("second row label = %q, want line 3", rows[1].label())
+		}
+		if rows[1].BgColor != "#00ff00" || rows[1].TitleFont != "/t.ttf" || rows[1].URLFont != "/u.ttf" {
+			t.Errorf("unexpected second row: %+v", rows[1])
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid json", "{not json}\n", "cards.jsonl:1"},
+		{"unknown field", `{"title": "a", "url": "b", "output": "c", "colour": "red"}` + "\n", "unknown field"},
+		{"missing output", `{"title": "a", "url": "b"}` + "\n", "cards.jsonl:1: title, url and output are required"},
+		{"negative size", `{"title": "a", "url": "b", "output": "c", "width": -1}` + "\n", "must not be negative"},
+		{"trailing data", `{"title": "a", "url": "b", "output": "c"} {}` + "\n", "unexpected data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeManifest(t, "cards.jsonl", tt.content)
+			_, err := readManifest(path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadJSONManifest(t *testing.T) {
+	t.Run("array of rows", func(t *testing.T) {
+		path := writeManifest(t, "cards.json", `[
+  {"title": "First", "url": "https://example.com/a", "output": "a.png"},
+  {
+    "title": "Second", "url": "https://example.com/b", "output": "b.png",
+    "tags": ["go", "web"]
+  }
+]
+`)
+		rows, err := readManifest(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("got %d rows, want 2", len(rows))
+		}
+		if rows[1].label() != path+":3" {
+			t.Errorf("second row label = %q, want line 3", rows[1].label())
+		}
+		if !slices.Equal(rows[1].Tags, []string{"go", "web"}) {
+			t.Errorf("unexpected second row: %+v", rows[1])
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"JSON Lines", `{"title": "a", "url": "b", "output": "c"}` + "\n", "cards.json:1: manifest must be a JSON array"},
+		{"empty", "", "manifest must be a JSON array"},
+		{"unknown field", `[{"title": "a", "url": "b", "output": "c", "colour": "red"}]`, "unknown field"},
+		{"missing output", "[\n\n" + `{"title": "a", "url": "b"}]`, "cards.json:3: title, url and output are required"},
+		{"unclosed", `[{"title": "a", "url": "b", "output": "c"}`, "cards.json"},
+		{"trailing data", `[{"title": "a", "url": "b", "output": "c"}] []`, "unexpected data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeManifest(t, "cards.json", tt.content)
+			_, err := readManifest(path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadManifestFormat(t *testing.T) {
+	t.Run("unknown extension requires format", func(t *testing.T) {
+		path := writeManifest(t, "cards.txt", "title,url,output\n")
+		_, err := readManifest(path, "")
+		if err == nil || !strings.Contains(err.Error(), "cannot infer manifest format") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("explicit format overrides extension", func(t *testing.T) {
+		path := writeManifest(t, "cards.txt", "title,url,output\nHello,https://example.com,out.png\n")
+		rows, err := readManifest(path, "csv")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 1 {
+			t.Errorf("got %d rows, want 1", len(rows))
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		path := writeManifest(t, "cards.csv", "title,url,output\n")
+		_, err := readManifest(path, "xml")
+		if err == nil || !strings.Contains(err.Error(), "unknown manifest format") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := readManifest("/nonexistent/cards.csv", "")
+		if err == nil || !strings.Contains(err.Error(), "open manifest") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestBatchRowOptions(t *testing.T) {
+	defaults := ogimage.Options{
+		Width:     1200,
+		Height:    628,
+		BgColor:   "#1a1a2e",
+		TitleFont: "/default.ttf",
+		URLFont:   "/default-url.ttf",
+		TitleSize: 72,
+	}
+
+	t.Run("empty fields use defaults", func(t *testing.T) {
+		opts := Job{Title: "T", URL: "U", Output: "o.png"}.options(defaults)
+		if opts.Title != "T" || opts.URL != "U" {
+			t.Errorf("unexpected title/url: %+v", opts)
+		}
+		if opts.BgColor != defaults.BgColor || opts.TitleFont != defaults.TitleFont || opts.TitleSize != defaults.TitleSize {
+			t.Errorf("defaults not applied: %+v", opts)
+		}
+	})
+
+	t.Run("row fields override defaults", func(t *testing.T) {
+		row := Job{Title: "T", URL: "U", Output: "o.png", Author: "Ada", Tags: []string{"go"}, BgColor: "#fff000", BgImage: "row.png", URLFont: "/row.ttf", TitleSize: 50, Width: 800, Height: 400}
+		opts := row.options(defaults)
+		if opts.Author != "Ada" || !slices.Equal(opts.Tags, []string{"go"}) {
+			t.Errorf("Author, Tags = %q, %q, want row values", opts.Author, opts.Tags)
+		}
+		if opts.BgColor != "#fff000" || opts.BgImage != "row.png" || opts.URLFont != "/row.ttf" || opts.TitleSize != 50 || opts.Width != 800 || opts.Height != 400 {
+			t.Errorf("row values not applied: %+v", opts)
+		}
+		if opts.TitleFont != defaults.TitleFont {
+			t.Errorf("TitleFont = %q, want default %q", opts.TitleFont, defaults.TitleFont)
+		}
+	})
+}
+
+func TestParseBatchFlags(t *testing.T) {
+	t.Run("manifest and defaults", func(t *testing.T) {
+		opts, err := parseBatchFlags([]string{"-bg", "#ff0000", "-title-size", "60", "-title-fit", "-verbose", "cards.csv"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Manifest != "cards.csv" {
+			t.Errorf("Manifest = %q, want %q", opts.Manifest, "cards.csv")
+		}
+		if opts.Defaults.BgColor != "#ff0000" || opts.Defaults.TitleSize != 60 || !opts.Defaults.TitleFit || !opts.Verbose {
+			t.Errorf("unexpected defaults: %+v", opts.Defaults)
+		}
+		if opts.Defaults.Width != ogimage.DefaultWidth || opts.Defaults.Height != ogimage.DefaultHeight {
+			t.Errorf("unexpected default dimensions: %+v", opts.Defaults)
+		}
+	})
+
+	t.Run("negative max lines", func(t *testing.T) {
+		_, err := parseBatchFlags([]string{"-max-lines", "-1", "cards.csv"})
+		if err == nil || !strings.Contains(err.Error(), "max-lines must not be negative") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing manifest", func(t *testing.T) {
+		_, err := parseBatchFlags(nil)
+		if err == nil || !strings.Contains(err.Error(), "exactly one manifest") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRunBatch(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("renders every row", func(t *testing.T) {
+		outDir := t.TempDir()
+		manifest := writeManifest(t, "cards.csv", "title,url,output\n"+
+			"First,https://example.com/a,"+filepath.Join(outDir, "a.png")+"\n"+
+			"Second,https://example.com/b,"+filepath.Join(outDir, "nested", "b.png")+"\n")
+
+		err := runBatch([]string{"-title-font", fontPath, "-url-font", fontPath, manifest}, ogimage.ResolveFontPath)
+		if err != nil {
+			t.Fatalf("runBatch() unexpected error: %v", err)
+		}
+
+		for _, name := range []string{"a.png", filepath.Join("nested", "b.png")} {
+			if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+				t.Errorf("output %s was not created: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("failed rows do not stop the batch", func(t *testing.T) {
+		outDir := t.TempDir()
+		manifest := writeManifest(t, "cards.jsonl",
+			`{"title": "Bad", "url": "https://example.com/a", "output": "`+filepath.Join(outDir, "a.png")+`", "title_font": "/nonexistent/font.ttf"}`+"\n"+
+				`{"title": "Good", "url": "https://example.com/b", "output": "`+filepath.Join(outDir, "b.png")+`"}`+"\n")
+
+		err := runBatch([]string{"-title-font", fontPath, "-url-font", fontPath, manifest}, ogimage.ResolveFontPath)
+		if err == nil || !strings.Contains(err.Error(), "1 of 2 images failed") {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "b.png")); err != nil {
+			t.Errorf("good row was not rendered: %v", err)
+		}
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		manifest := writeManifest(t, "cards.csv", "title,url\n")
+		if err := runBatch([]string{manifest}, ogimage.ResolveFontPath); err == nil {
+			t.Error("expected error for invalid manifest")
+		}
+	})
+}
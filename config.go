@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are the config files looked for in the working
+// directory when -config is not given
+var defaultConfigFiles = []string{".og-image.yaml", ".og-image.yml", ".og-image.toml"}
+
+// Config holds default flag values loaded from a YAML or TOML file.
+// Keys are flag names with underscores, e.g. title_size for -title-size.
+type Config struct {
+	Theme          string
+	Bg             string
+	BgImage        string
+	BgFit          string
+	BgBlur         float64
+	BgDarken       float64
+	TextColor      string
+	URLColor       string
+	ShadowColor    string
+	OverlayColor   string
+	OverlayOpacity float64
+	HighlightColor string
+	Logo           string
+	LogoPosition   string
+	LogoSize       float64
+	LogoPadding    float64
+	LogoOpacity    float64
+	LogoCircle     bool
+	TitleFont      string
+	URLFont        string
+	BoldFont       string
+	ItalicFont     string
+	CodeFont       string
+	TitleWeight    float64
+	TitleAxes      string
+	TitleSize      float64
+	TitleFit       bool
+	TitleMinSize   float64
+	TitleMaxSize   float64
+	MaxLines       int
+	Wrap           string
+	Hyphenate      string
+	Align          string
+	VAlign         string
+	URLAlign       string
+	URLVAlign      string
+	TagPosition    string
+	TagColor       string
+	TagColors      string
+	Width          int
+	Height         int
+
+	// set lists the keys present in the file, in file order
+	set []string
+}
+
+// fields maps each config key to the field it decodes into
+func (c *Config) fields() map[string]any {
+	return map[string]any{
+		"theme":           &c.Theme,
+		"bg":              &c.Bg,
+		"bg_image":        &c.BgImage,
+		"bg_fit":          &c.BgFit,
+		"bg_blur":         &c.BgBlur,
+		"bg_darken":       &c.BgDarken,
+		"text_color":      &c.TextColor,
+		"url_color":       &c.URLColor,
+		"shadow_color":    &c.ShadowColor,
+		"overlay_color":   &c.OverlayColor,
+		"overlay_opacity": &c.OverlayOpacity,
+		"highlight_color": &c.HighlightColor,
+		"logo":            &c.Logo,
+		"logo_position":   &c.LogoPosition,
+		"logo_size":       &c.LogoSize,
+		"logo_padding":    &c.LogoPadding,
+		"logo_opacity":    &c.LogoOpacity,
+		"logo_circle":     &c.LogoCircle,
+		"title_font":      &c.TitleFont,
+		"url_font":        &c.URLFont,
+		"bold_font":       &c.BoldFont,
+		"italic_font":     &c.ItalicFont,
+		"code_font":       &c.CodeFont,
+		"title_weight":    &c.TitleWeight,
+		"title_axes":      &c.TitleAxes,
+		"title_size":      &c.TitleSize,
+		"title_fit":       &c.TitleFit,
+		"title_min_size":  &c.TitleMinSize,
+		"title_max_size":  &c.TitleMaxSize,
+		"max_lines":       &c.MaxLines,
+		"wrap":            &c.Wrap,
+		"hyphenate":       &c.Hyphenate,
+		"align":           &c.Align,
+		"valign":          &c.VAlign,
+		"url_align":       &c.URLAlign,
+		"url_valign":      &c.URLVAlign,
+		"tag_position":    &c.TagPosition,
+		"tag_color":       &c.TagColor,
+		"tag_colors":      &c.TagColors,
+		"width":           &c.Width,
+		"height":          &c.Height,
+	}
+}
+
+// LoadConfig reads a config file. The format is chosen by extension:
+// .toml for TOML, anything else for YAML.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		err = cfg.decodeTOML(path, data)
+	} else {
+		err = cfg.decodeYAML(path, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// yamlErrorLine matches the line number in yaml.v3 syntax errors
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// decodeYAML decodes a YAML mapping key by key so errors can name the
+// line and field
+func (c *Config) decodeYAML(path string, data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			return fmt.Errorf("%s:%s: %s", path, m[1], m[2])
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected a mapping of settings", path, root.Line)
+	}
+
+	fields := c.fields()
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		ptr, ok := fields[key.Value]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown field %q", path, key.Line, key.Value)
+		}
+		if value.Kind != yaml.ScalarNode || value.Decode(ptr) != nil {
+			return fmt.Errorf("%s:%d: field %q: expected %s", path, value.Line, key.Value, describeField(ptr))
+		}
+		c.set = append(c.set, key.Value)
+	}
+	return nil
+}
+
+// decodeTOML decodes top-level TOML keys one at a time so errors can name
+// the line and field
+func (c *Config) decodeTOML(path string, data []byte) error {
+	var raw map[string]toml.Primitive
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("%s:%d: %s", path, perr.Position.Line, perr.Message)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	fields := c.fields()
+	for _, key := range md.Keys() {
+		if len(key) != 1 {
+			continue
+		}
+		name := key[0]
+		line := tomlKeyLine(data, name)
+		ptr, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown field %q", path, line, name)
+		}
+		if err := md.PrimitiveDecode(raw[name], ptr); err != nil {
+			return fmt.Errorf("%s:%d: field %q: expected %s", path, line, name, describeField(ptr))
+		}
+		c.set = append(c.set, name)
+	}
+	return nil
+}
+
+// tomlKeyLine returns the line on which a top-level key is assigned,
+// or 0 if it cannot be found
+func tomlKeyLine(data []byte, key string) int {
+	re := regexp.MustCompile(`^\s*"?` + regexp.QuoteMeta(key) + `"?\s*=`)
+	for i, line := range strings.Split(string(data), "\n") {
+		if re.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// describeField names the kind of value a config field expects
+func describeField(ptr any) string {
+	switch ptr.(type) {
+	case *int:
+		return "an integer"
+	case *float64:
+		return "a number"
+	case *bool:
+		return "true or false"
+	default:
+		return "a string"
+	}
+}
+
+// apply sets every flag in fs that the config file provides a value for,
+// unless the flag was given explicitly on the command line
+func (c *Config) apply(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	fields := c.fields()
+	for _, key := range c.set {
+		name := strings.ReplaceAll(key, "_", "-")
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		value := fmt.Sprint(deref(fields[key]))
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config field %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// deref returns the value a config field pointer points to
+func deref(ptr any) any {
+	switch p := ptr.(type) {
+	case *int:
+		return *p
+	case *float64:
+		return *p
+	case *string:
+		return *p
+	case *bool:
+		return *p
+	}
+	return nil
+}
+
+// applyConfigFile loads the config file at path, or the first default
+// config file in the working directory when path is empty, and applies it
+// to fs. It is a no-op when no path is given and no default file exists.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			if fileExists(name) {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return cfg.apply(fs)
+}
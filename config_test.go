@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	want := Config{Bg: "#336699", TitleFont: "/fonts/Title.ttf", TitleSize: 64, Width: 1000, Height: 500}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "yaml",
+			file:    ".og-image.yaml",
+			content: "bg: \"#336699\"\ntitle_font: /fonts/Title.ttf\ntitle_size: 64\nwidth: 1000\nheight: 500\n",
+		},
+		{
+			name:    "toml",
+			file:    ".og-image.toml",
+			content: "bg = \"#336699\"\ntitle_font = \"/fonts/Title.ttf\"\ntitle_size = 64.0\nwidth = 1000\nheight = 500\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeManifest(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Bg != want.Bg || cfg.TitleFont != want.TitleFont || cfg.URLFont != "" ||
+				cfg.TitleSize != want.TitleSize || cfg.Width != want.Width || cfg.Height != want.Height {
+				t.Errorf("LoadConfig() = %+v, want %+v", *cfg, want)
+			}
+			if len(cfg.set) != 5 {
+				t.Errorf("set = %v, want 5 keys", cfg.set)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"yaml unknown field", "c.yaml", "bg: \"#000000\"\ncolour: red\n", "c.yaml:2: unknown field \"colour\""},
+		{"yaml wrong type", "c.yaml", "width: 1200\nheight: tall\n", "c.yaml:2: field \"height\": expected an integer"},
+		{"yaml list value", "c.yaml", "title_font:\n  - a.ttf\n", "c.yaml:2: field \"title_font\": expected a string"},
+		{"yaml syntax", "c.yaml", "bg: \"#000000\"\n\twidth: 1200\n", "c.yaml:2: found character that cannot start any token"},
+		{"yaml not a mapping", "c.yaml", "- bg\n", "c.yaml:1: expected a mapping of settings"},
+		{"yaml not a bool", "c.yaml", "logo_circle: round\n", "c.yaml:1: field \"logo_circle\": expected true or false"},
+		{"toml unknown field", "c.toml", "width = 1200\n\ncolour = \"red\"\n", "c.toml:3: unknown field \"colour\""},
+		{"toml wrong type", "c.toml", "title_size = \"big\"\n", "c.toml:1: field \"title_size\": expected a number"},
+		{"toml syntax", "c.toml", "bg = \"#000000\"\nwidth = \n", "c.toml:2:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeManifest(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadConfig("/nonexistent/.og-image.yaml")
+		if err == nil || !strings.Contains(err.Error(), "read config") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestConfigApply(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	bg := fs.String("bg", "#1a1a2e", "")
+	width := fs.Int("width", 1200, "")
+	height := fs.Int("height", 628, "")
+	titleSize := fs.Float64("title-size", 72, "")
+
+	if err := fs.Parse([]string{"-width", "800"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(writeManifest(t, ".og-image.yaml", "bg: \"#ffffff\"\nwidth: 1000\ntitle_size: 48.5\nurl_font: /fonts/URL.ttf\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.apply(fs); err != nil {
+		t.Fatalf("apply() unexpected error: %v", err)
+	}
+
+	if *bg != "#ffffff" {
+		t.Errorf("bg = %q, want value from config", *bg)
+	}
+	if *width != 800 {
+		t.Errorf("width = %d, want command-line value 800", *width)
+	}
+	if *height != 628 {
+		t.Errorf("height = %d, want flag default 628", *height)
+	}
+	if *titleSize != 48.5 {
+		t.Errorf("title-size = %v, want 48.5", *titleSize)
+	}
+}
+
+func TestParseFlagsConfig(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("explicit config file", func(t *testing.T) {
+		path := writeManifest(t, "og.toml", "bg = \"#112233\"\ntitle_size = 60.0\n")
+		os.Args = []string{"og-image-generator", "-config", path, "-title", "T", "-url", "https://example.com", "-title-size", "80"}
+		resetFlags()
+
+		opts, err := parseFlags()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.BgColor != "#112233" {
+			t.Errorf("BgColor = %q, want value from config", opts.BgColor)
+		}
+		if opts.TitleSize != 80 {
+			t.Errorf("TitleSize = %v, want command-line value 80", opts.TitleSize)
+		}
+	})
+
+	t.Run("discovered in working directory", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, ".og-image.yaml"), []byte("width: 900\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(dir)
+		os.Args = []string{"og-image-generator", "-title", "T", "-url", "https://example.com"}
+		resetFlags()
+
+		opts, err := parseFlags()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Width != 900 {
+			t.Errorf("Width = %d, want 900 from .og-image.yaml", opts.Width)
+		}
+	})
+
+	t.Run("invalid config file", func(t *testing.T) {
+		path := writeManifest(t, "og.yaml", "width: wide\n")
+		os.Args = []string{"og-image-generator", "-config", path, "-title", "T", "-url", "https://example.com"}
+		resetFlags()
+
+		_, err := parseFlags()
+		if err == nil || !strings.Contains(err.Error(), "og.yaml:1: field \"width\"") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestParseBatchFlagsConfig(t *testing.T) {
+	path := writeManifest(t, "og.yaml", "bg: \"#445566\"\nworkers: 3\n")
+	_, err := parseBatchFlags([]string{"-config", path, "cards.csv"})
+	if err == nil || !strings.Contains(err.Error(), "unknown field \"workers\"") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	path = writeManifest(t, "og.yaml", "bg: \"#445566\"\nheight: 400\n")
+	opts, err := parseBatchFlags([]string{"-config", path, "-height", "300", "cards.csv"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Defaults.BgColor != "#445566" || opts.Defaults.Height != 300 {
+		t.Errorf("Defaults = %+v", opts.Defaults)
+	}
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"og-image-generator/ogimage"
+)
+
+// ContentOptions holds the configuration for content mode
+type ContentOptions struct {
+	Dir       string
+	OutDir    string
+	BaseURL   string
+	CachePath string
+	Force     bool
+	Workers   int
+	Verbose   bool
+	// DateFormat is the Go time layout front matter dates are shown in
+	DateFormat string
+	Defaults   ogimage.Options
+}
+
+// frontMatter holds the fields read from a post's front matter
+type frontMatter struct {
+	Title string `yaml:"title" toml:"title"`
+	URL   string `yaml:"url" toml:"url"`
+	Slug  string `yaml:"slug" toml:"slug"`
+	OGBg  string `yaml:"og_bg" toml:"og_bg"`
+
+	// Description is the card's subtitle. Date is a TOML date, or a
+	// string that is shown as written if it isn't a date.
+	Description string `yaml:"description" toml:"description"`
+	Author      string `yaml:"author" toml:"author"`
+	Date        any    `yaml:"date" toml:"date"`
+	// Tags are drawn as pills
+	Tags []string `yaml:"tags" toml:"tags"`
+
+	// OGBgImage is relative to the post's directory
+	OGBgImage string `yaml:"og_bg_image" toml:"og_bg_image"`
+}
+
+// contentCacheFile is the default name of the file that records which
+// posts have already been rendered
+const contentCacheFile = ".og-image-cache.json"
+
+// contentCache records the state of each post when its image was rendered,
+// so unchanged posts can be skipped on the next run
+type contentCache struct {
+	// Settings identifies the flags the images were rendered with and the
+	// fonts, logo and background image files they name; when they change
+	// every post is rendered again
+	Settings string                       `json:"settings"`
+	Files    map[string]contentCacheEntry `json:"files"`
+}
+
+type contentCacheEntry struct {
+	ModTime time.Time `json:"mtime"`
+	Card    string    `json:"card"`
+}
+
+func parseContentFlags(args []string) (*ContentOptions, error) {
+	fs := flag.NewFlagSet("content", flag.ContinueOnError)
+	outDir := fs.String("out-dir", "", "Write images into a mirrored tree under this directory instead of next to each post")
+	baseURL := fs.String("base-url", "", "Site URL prepended to slugs and relative urls")
+	cachePath := fs.String("cache", "", "Cache file of rendered posts (default "+contentCacheFile+" in the output directory)")
+	force := fs.Bool("force", false, "Render every post, even if unchanged")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "Number of images to render concurrently")
+	verbose := fs.Bool("verbose", false, "Report layout details, such as the size chosen by -title-fit")
+	dateFormat := fs.String("date-format", defaultDateFormat, "Go time layout that front matter dates are shown in")
+	width := fs.Int("width", ogimage.DefaultWidth, "Image width in pixels")
+	height := fs.Int("height", ogimage.DefaultHeight, "Image height in pixels")
+	resolveTheme := themeFlags(fs)
+	resolveBgImage := bgImageFlags(fs)
+	resolveLogo := logoFlags(fs)
+	resolveTitleLayout := titleLayoutFlags(fs)
+	resolveTags := tagFlags(fs)
+	resolveInlineFonts := inlineFontFlags(fs)
+	resolveFontAxes := fontAxesFlags(fs)
+	titleFont := fs.String("title-font", "", "Title font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	urlFont := fs.String("url-font", "", "URL font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	titleSize := fs.Float64("title-size", ogimage.TitleFontSize, "Title font size in points")
+	maxLines := fs.Int("max-lines", 0, "Cut the title to this many lines, ending with an ellipsis (0 for no limit)")
+	configPath := fs.String("config", "", "Config file of default flag values (default .og-image.yaml if present)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := applyConfigFile(fs, *configPath); err != nil {
+		return nil, err
+	}
+	theme, err := resolveTheme()
+	if err != nil {
+		return nil, err
+	}
+	logo, err := resolveLogo()
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("content requires exactly one content directory")
+	}
+	if *workers < 1 {
+		return nil, fmt.Errorf("workers must be at least 1")
+	}
+	if *maxLines < 0 {
+		return nil, fmt.Errorf("max-lines must not be negative")
+	}
+
+	opts := &ContentOptions{
+		Dir:        fs.Arg(0),
+		OutDir:     *outDir,
+		BaseURL:    *baseURL,
+		CachePath:  *cachePath,
+		Force:      *force,
+		Workers:    *workers,
+		Verbose:    *verbose,
+		DateFormat: *dateFormat,
+		Defaults: ogimage.Options{
+			Width:     *width,
+			Height:    *height,
+			BgColor:   theme.Background,
+			Theme:     theme,
+			TitleFont: *titleFont,
+			URLFont:   *urlFont,
+			TitleSize: *titleSize,
+			MaxLines:  *maxLines,
+			Logo:      logo,
+		},
+	}
+	if err := resolveBgImage(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	if err := resolveTitleLayout(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	if err := resolveTags(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	resolveInlineFonts(&opts.Defaults)
+	if err := resolveFontAxes(&opts.Defaults); err != nil {
+		return nil, err
+	}
+	if opts.CachePath == "" {
+		cacheDir := opts.Dir
+		if opts.OutDir != "" {
+			cacheDir = opts.OutDir
+		}
+		opts.CachePath = filepath.Join(cacheDir, contentCacheFile)
+	}
+	return opts, nil
+}
+
+func runContent(args []string, resolver ogimage.FontResolver) error {
+	opts, err := parseContentFlags(args)
+	if err != nil {
+		return err
+	}
+
+	cache, err := loadContentCache(opts.CachePath)
+	if err != nil {
+		return err
+	}
+	d := opts.Defaults
+	assets := append(fontFiles(resolver, d.TitleFont, d.URLFont, d.BoldFont, d.ItalicFont, d.CodeFont), d.Logo.Path, d.BgImage)
+	settings := hashValues(opts.BaseURL, opts.DateFormat, opts.Defaults, fileStamps(assets...))
+	if opts.Force || cache.Settings != settings {
+		cache = &contentCache{Settings: settings, Files: make(map[string]contentCacheEntry)}
+	}
+
+	var rows []Job
+	pending := make(map[string]contentCacheEntry)
+	walked := make(map[string]bool)
+	skipped, invalid := 0, 0
+
+	err = filepath.WalkDir(opts.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isMarkdown(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(opts.Dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		output := contentOutputPath(opts, rel)
+		walked[rel] = true
+
+		// Unchanged source: skip without re-reading the front matter
+		entry, seen := cache.Files[rel]
+		if seen && entry.ModTime.Equal(info.ModTime()) && fileExists(output) {
+			skipped++
+			return nil
+		}
+
+		fm, ok, err := readFrontMatter(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", path, err)
+			invalid++
+			return nil
+		}
+		if !ok || fm.Title == "" {
+			return nil
+		}
+
+		row := Job{
+			Title:    fm.Title,
+			URL:      postURL(opts.BaseURL, rel, fm),
+			Output:   output,
+			Subtitle: fm.Description,
+			Author:   fm.Author,
+			Date:     postDate(fm.Date, opts.DateFormat),
+			Tags:     fm.Tags,
+			BgColor:  fm.OGBg,
+			source:   path,
+			line:     1,
+		}
+		if fm.OGBgImage != "" {
+			row.BgImage = filepath.Join(filepath.Dir(path), filepath.FromSlash(fm.OGBgImage))
+		}
+
+		// Source touched but front matter unchanged: skip the render
+		card := hashValues(row.Title, row.URL, row.Subtitle, row.Author, row.Date, row.Tags, row.BgColor, row.BgImage, fileStamps(row.BgImage))
+		if seen && entry.Card == card && fileExists(output) {
+			cache.Files[rel] = contentCacheEntry{ModTime: info.ModTime(), Card: card}
+			skipped++
+			return nil
+		}
+
+		pending[row.Output] = contentCacheEntry{ModTime: info.ModTime(), Card: card}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk %s: %w", opts.Dir, err)
+	}
+
+	// Forget posts that were deleted or renamed
+	for rel := range cache.Files {
+		if !walked[rel] {
+			delete(cache.Files, rel)
+		}
+	}
+
+	if err := createOutputDirs(rows); err != nil {
+		return err
+	}
+
+	renderer := &ogimage.Renderer{ResolveFont: resolver}
+	if opts.Verbose {
+		renderer.Logf = logVerbose
+	}
+	failed := renderJobs(renderer, rows, opts.Defaults, opts.Workers, func(row Job, err error) {
+		printJobResult(row, err)
+		if err == nil {
+			rel, _ := filepath.Rel(opts.Dir, row.source)
+			cache.Files[rel] = pending[row.Output]
+		}
+	})
+
+	if err := saveContentCache(opts.CachePath, cache); err != nil {
+		return err
+	}
+
+	fmt.Printf("Rendered %d images, %d unchanged\n", len(rows)-failed, skipped)
+	if failed+invalid > 0 {
+		return fmt.Errorf("%d of %d posts failed", failed+invalid, len(rows)+invalid)
+	}
+	return nil
+}
+
+// isMarkdown reports whether path is a Markdown source file
+func isMarkdown(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// contentOutputPath returns where the image for the post at rel is written:
+// next to the post, or at the mirrored location under OutDir
+func contentOutputPath(opts *ContentOptions, rel string) string {
+	name := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".og.png"
+	if opts.OutDir != "" {
+		return filepath.Join(opts.OutDir, name)
+	}
+	return filepath.Join(opts.Dir, name)
+}
+
+// postURL returns the URL shown on the card. An absolute url from the front
+// matter is used as is; otherwise the path is built the way Hugo does, from
+// the post's section and its slug (or file name) and joined to baseURL.
+func postURL(baseURL, rel string, fm frontMatter) string {
+	if strings.Contains(fm.URL, "://") {
+		return fm.URL
+	}
+
+	urlPath := fm.URL
+	if urlPath == "" {
+		dir, slug := path.Split(filepath.ToSlash(rel))
+		slug = strings.TrimSuffix(slug, path.Ext(slug))
+		// Page bundles (posts/foo/index.md) take their name from the directory
+		if slug == "index" || slug == "_index" {
+			dir, slug = path.Split(strings.TrimSuffix(dir, "/"))
+		}
+		if fm.Slug != "" {
+			slug = fm.Slug
+		}
+		urlPath = path.Clean("/"+dir+slug) + "/"
+		if urlPath == "//" {
+			urlPath = "/"
+		}
+	} else if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+
+	return strings.TrimRight(baseURL, "/") + urlPath
+}
+
+// defaultDateFormat is the layout front matter dates are shown in unless
+// -date-format is given
+const defaultDateFormat = "January 2, 2006"
+
+// postDate formats a front matter date with layout. Dates written as
+// strings are parsed as RFC 3339 timestamps or plain dates, and shown as
+// written if they are neither.
+func postDate(date any, layout string) string {
+	switch d := date.(type) {
+	case time.Time:
+		return d.Format(layout)
+	case string:
+		for _, l := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(l, d); err == nil {
+				return t.Format(layout)
+			}
+		}
+		return d
+	}
+	return ""
+}
+
+// readFrontMatter parses the YAML (---) or TOML (+++) front matter at the
+// start of a Markdown file. ok is false when the file has none.
+func readFrontMatter(path string) (fm frontMatter, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fm, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return fm, false, scanner.Err()
+	}
+	delim := strings.TrimSpace(scanner.Text())
+	if delim != "---" && delim != "+++" {
+		return fm, false, nil
+	}
+
+	var buf bytes.Buffer
+	closed := false
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == delim {
+			closed = true
+			break
+		}
+		buf.Write(scanner.Bytes())
+		buf.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fm, false, err
+	}
+	if !closed {
+		return fm, false, fmt.Errorf("front matter is not closed with %s", delim)
+	}
+
+	if delim == "+++" {
+		if _, err := toml.Decode(buf.String(), &fm); err != nil {
+			return fm, false, fmt.Errorf("parse toml front matter: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(buf.Bytes(), &fm); err != nil {
+			return fm, false, fmt.Errorf("parse yaml front matter: %w", err)
+		}
+	}
+	return fm, true, nil
+}
+
+// hashValues returns a short digest of the JSON encoding of values
+func hashValues(values ...any) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// fontFiles returns the files the comma-separated font lists resolve to,
+// leaving out fonts that don't resolve
+func fontFiles(resolver ogimage.FontResolver, lists ...string) []string {
+	var files []string
+	for _, list := range lists {
+		for _, name := range strings.Split(list, ",") {
+			if path, _, err := resolver(strings.TrimSpace(name)); err == nil {
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
+
+// fileStamps returns the size and modification time of each file of
+// paths, so that a hash of them changes when a file is replaced. Empty
+// paths and missing files have empty stamps.
+func fileStamps(paths ...string) []string {
+	stamps := make([]string, len(paths))
+	for i, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			stamps[i] = fmt.Sprintf("%s %d %d", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamps
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// loadContentCache reads the cache file, returning an empty cache if it
+// does not exist yet
+func loadContentCache(path string) (*contentCache, error) {
+	cache := &contentCache{Files: make(map[string]contentCacheEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("parse cache %s: %w", path, err)
+	}
+	if cache.Files == nil {
+		cache.Files = make(map[string]contentCacheEntry)
+	}
+	return cache, nil
+}
+
+func saveContentCache(path string, cache *contentCache) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"og-image-generator/ogimage"
+)
+
+// writeContentFile writes a Markdown file under dir, creating parents
+func writeContentFile(t *testing.T, dir, rel, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestPNG writes a small gray PNG to path and returns path
+func writeTestPNG(t *testing.T, path string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    frontMatter
+		wantOK  bool
+		wantErr string
+	}{
+		{
+			name:    "yaml",
+			content: "---\ntitle: \"Hello: World\"\nslug: hello\nog_bg: \"#ff0000\"\nog_bg_image: hero.jpg\ntags: [go]\n---\nBody\n",
+			want:    frontMatter{Title: "Hello: World", Slug: "hello", OGBg: "#ff0000", OGBgImage: "hero.jpg", Tags: []string{"go"}},
+			wantOK:  true,
+		},
+		{
+			name:    "toml",
+			content: "+++\ntitle = \"Hello TOML\"\nurl = \"/custom/\"\ndraft = false\ntags = [\"go\", \"toml\"]\n+++\nBody\n",
+			want:    frontMatter{Title: "Hello TOML", URL: "/custom/", Tags: []string{"go", "toml"}},
+			wantOK:  true,
+		},
+		{
+			name:    "no front matter",
+			content: "# Just a heading\n",
+			wantOK:  false,
+		},
+		{
+			name:    "empty file",
+			content: "",
+			wantOK:  false,
+		},
+		{
+			name:    "unclosed",
+			content: "---\ntitle: Hello\n",
+			wantErr: "not closed",
+		},
+		{
+			name:    "invalid yaml",
+			content: "---\ntitle: [unclosed\n---\n",
+			wantErr: "parse yaml front matter",
+		},
+		{
+			name:    "invalid toml",
+			content: "+++\ntitle = \n+++\n",
+			wantErr: "parse toml front matter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeContentFile(t, t.TempDir(), "post.md", tt.content)
+			fm, ok, err := readFrontMatter(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readFrontMatter() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(fm, tt.want) {
+				t.Errorf("front matter = %+v, want %+v", fm, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrontMatterByline(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantSubtitle string
+		wantAuthor   string
+		wantDate     string
+	}{
+		{"yaml date", "---\ntitle: Hello\ndescription: A short tour\nauthor: Ada\ndate: 2024-03-05\n---\n", "A short tour", "Ada", "March 5, 2024"},
+		{"yaml timestamp", "---\ntitle: Hello\ndate: 2024-03-05T10:00:00Z\n---\n", "", "", "March 5, 2024"},
+		{"toml date", "+++\ntitle = \"Hello\"\nauthor = \"Ada\"\ndate = 2024-03-05T10:00:00Z\n+++\n", "", "Ada", "March 5, 2024"},
+		{"toml local date", "+++\ntitle = \"Hello\"\ndate = 2024-03-05\n+++\n", "", "", "March 5, 2024"},
+		{"not a date", "---\ntitle: Hello\ndate: Spring 2024\n---\n", "", "", "Spring 2024"},
+		{"no date", "---\ntitle: Hello\n---\n", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeContentFile(t, t.TempDir(), "post.md", tt.content)
+			fm, _, err := readFrontMatter(path)
+			if err != nil {
+				t.Fatalf("readFrontMatter() error: %v", err)
+			}
+			if fm.Description != tt.wantSubtitle || fm.Author != tt.wantAuthor {
+				t.Errorf("description, author = %q, %q, want %q, %q", fm.Description, fm.Author, tt.wantSubtitle, tt.wantAuthor)
+			}
+			if got := postDate(fm.Date, defaultDateFormat); got != tt.wantDate {
+				t.Errorf("postDate(%v) = %q, want %q", fm.Date, got, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestPostURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		rel     string
+		fm      frontMatter
+		want    string
+	}{
+		{"file name", "https://example.com", "posts/hello-world.md", frontMatter{}, "https://example.com/posts/hello-world/"},
+		{"slug replaces file name", "https://example.com/", "posts/2024-01-01-hello.md", frontMatter{Slug: "hello"}, "https://example.com/posts/hello/"},
+		{"page bundle", "https://example.com", "posts/hello/index.md", frontMatter{}, "https://example.com/posts/hello/"},
+		{"section index", "https://example.com", "posts/_index.md", frontMatter{}, "https://example.com/posts/"},
+		{"root index", "https://example.com", "_index.md", frontMatter{}, "https://example.com/"},
+		{"relative url", "https://example.com", "posts/hello.md", frontMatter{URL: "/about/"}, "https://example.com/about/"},
+		{"relative url without slash", "https://example.com", "posts/hello.md", frontMatter{URL: "about/"}, "https://example.com/about/"},
+		{"absolute url", "https://example.com", "posts/hello.md", frontMatter{URL: "https://other.com/x"}, "https://other.com/x"},
+		{"no base url", "", "posts/hello.md", frontMatter{}, "/posts/hello/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postURL(tt.baseURL, tt.rel, tt.fm); got != tt.want {
+				t.Errorf("postURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentOutputPath(t *testing.T) {
+	opts := &ContentOptions{Dir: "content"}
+	if got := contentOutputPath(opts, filepath.Join("posts", "hello.md")); got != filepath.Join("content", "posts", "hello.og.png") {
+		t.Errorf("next to post: got %q", got)
+	}
+
+	opts.OutDir = "static/og"
+	if got := contentOutputPath(opts, filepath.Join("posts", "hello", "index.md")); got != filepath.Join("static", "og", "posts", "hello", "index.og.png") {
+		t.Errorf("mirrored tree: got %q", got)
+	}
+}
+
+func TestParseContentFlags(t *testing.T) {
+	t.Run("cache defaults to content directory", func(t *testing.T) {
+		opts, err := parseContentFlags([]string{"content"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.CachePath != filepath.Join("content", contentCacheFile) {
+			t.Errorf("CachePath = %q", opts.CachePath)
+		}
+	})
+
+	t.Run("cache follows out-dir", func(t *testing.T) {
+		opts, err := parseContentFlags([]string{"-out-dir", "public/og", "-base-url", "https://example.com", "content"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.CachePath != filepath.Join("public/og", contentCacheFile) {
+			t.Errorf("CachePath = %q", opts.CachePath)
+		}
+		if opts.BaseURL != "https://example.com" {
+			t.Errorf("BaseURL = %q", opts.BaseURL)
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := parseContentFlags(nil)
+		if err == nil || !strings.Contains(err.Error(), "exactly one content directory") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRunContent(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	contentDir := t.TempDir()
+	outDir := t.TempDir()
+	post := writeContentFile(t, contentDir, filepath.Join("posts", "hello.md"), "---\ntitle: Hello World\n---\nBody\n")
+	writeContentFile(t, contentDir, filepath.Join("posts", "bundle", "index.md"), "+++\ntitle = \"Bundle Post\"\nog_bg = \"#336699\"\n+++\n")
+	writeContentFile(t, contentDir, "notes.md", "No front matter here\n")
+	writeContentFile(t, contentDir, "readme.txt", "---\ntitle: Not markdown\n---\n")
+
+	args := []string{"-out-dir", outDir, "-title-font", fontPath, "-url-font", fontPath, contentDir}
+	helloOut := filepath.Join(outDir, "posts", "hello.og.png")
+	bundleOut := filepath.Join(outDir, "posts", "bundle", "index.og.png")
+
+	modTime := func(path string) time.Time {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		return info.ModTime()
+	}
+
+	t.Run("renders posts with front matter", func(t *testing.T) {
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		for _, out := range []string{helloOut, bundleOut} {
+			if !fileExists(out) {
+				t.Errorf("expected %s to be rendered", out)
+			}
+		}
+		if fileExists(filepath.Join(outDir, "notes.og.png")) || fileExists(filepath.Join(outDir, "readme.og.png")) {
+			t.Error("files without front matter should not be rendered")
+		}
+	})
+
+	t.Run("unchanged posts are skipped", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(helloOut, past, past)
+
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if !modTime(helloOut).Equal(past) {
+			t.Error("unchanged post was rendered again")
+		}
+	})
+
+	t.Run("touched post with same front matter is skipped", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(helloOut, past, past)
+		writeContentFile(t, contentDir, filepath.Join("posts", "hello.md"), "---\ntitle: Hello World\n---\nEdited body\n")
+		future := time.Now().Add(time.Hour)
+		os.Chtimes(post, future, future)
+
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if !modTime(helloOut).Equal(past) {
+			t.Error("post with unchanged front matter was rendered again")
+		}
+	})
+
+	t.Run("changed front matter is rendered", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(helloOut, past, past)
+		writeContentFile(t, contentDir, filepath.Join("posts", "hello.md"), "---\ntitle: Hello Again\n---\n")
+		future := time.Now().Add(2 * time.Hour)
+		os.Chtimes(post, future, future)
+
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if modTime(helloOut).Equal(past) {
+			t.Error("post with changed front matter was not rendered")
+		}
+	})
+
+	t.Run("force renders everything", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(bundleOut, past, past)
+
+		if err := runContent(append([]string{"-force"}, args...), ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if modTime(bundleOut).Equal(past) {
+			t.Error("-force did not render unchanged post")
+		}
+	})
+
+	t.Run("changed background image renders every post", func(t *testing.T) {
+		bg := writeTestPNG(t, filepath.Join(t.TempDir(), "bg.png"))
+		bgArgs := append([]string{"-bg-image", bg}, args...)
+		if err := runContent(bgArgs, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(helloOut, past, past)
+		future := time.Now().Add(time.Hour)
+		os.Chtimes(bg, future, future)
+		if err := runContent(bgArgs, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if modTime(helloOut).Equal(past) {
+			t.Error("post was not rendered again with the replaced background image")
+		}
+	})
+
+	t.Run("changed post background image renders the post", func(t *testing.T) {
+		bundle := filepath.Join(contentDir, "posts", "bundle")
+		cover := writeTestPNG(t, filepath.Join(bundle, "cover.png"))
+		writeContentFile(t, contentDir, filepath.Join("posts", "bundle", "index.md"), "+++\ntitle = \"Bundle Post\"\nog_bg_image = \"cover.png\"\n+++\n")
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(helloOut, past, past)
+		os.Chtimes(bundleOut, past, past)
+		future := time.Now().Add(3 * time.Hour)
+		os.Chtimes(cover, future, future)
+		os.Chtimes(filepath.Join(bundle, "index.md"), future, future)
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		if modTime(bundleOut).Equal(past) {
+			t.Error("post was not rendered again with its replaced background image")
+		}
+		if !modTime(helloOut).Equal(past) {
+			t.Error("other post was rendered again")
+		}
+	})
+
+	t.Run("deleted posts are pruned from the cache", func(t *testing.T) {
+		extra := writeContentFile(t, contentDir, "extra.md", "---\ntitle: Extra\n---\n")
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+		os.Remove(extra)
+		if err := runContent(args, ogimage.ResolveFontPath); err != nil {
+			t.Fatalf("runContent() unexpected error: %v", err)
+		}
+
+		cache, err := loadContentCache(filepath.Join(outDir, contentCacheFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := cache.Files["extra.md"]; ok {
+			t.Error("cache still has the deleted post")
+		}
+		if _, ok := cache.Files[filepath.Join("posts", "hello.md")]; !ok {
+			t.Error("cache lost a post that still exists")
+		}
+	})
+
+	t.Run("invalid front matter is reported", func(t *testing.T) {
+		writeContentFile(t, contentDir, "broken.md", "---\ntitle: [oops\n---\n")
+		err := runContent(args, ogimage.ResolveFontPath)
+		if err == nil || !strings.Contains(err.Error(), "posts failed") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
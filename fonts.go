@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"og-image-generator/ogimage"
+)
+
+// runFonts runs the fonts subcommand. fonts list prints the fonts found in
+// dirs, by the name the font flags accept, optionally only those whose
+// family contains the given text.
+func runFonts(args []string, dirs []string, w io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("usage: og-image-generator fonts list [family]")
+	}
+	fs := flag.NewFlagSet("fonts list", flag.ContinueOnError)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: og-image-generator fonts list [family]")
+	}
+	filter := strings.ToLower(fs.Arg(0))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTYLE\tWEIGHT\tPATH")
+	for _, f := range ogimage.ScanFonts(dirs) {
+		if !strings.Contains(strings.ToLower(f.Family), filter) {
+			continue
+		}
+		weight := fmt.Sprint(f.Weight)
+		if f.MinWeight != f.MaxWeight {
+			weight = fmt.Sprintf("%d-%d", f.MinWeight, f.MaxWeight)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Name(), f.Style, weight, f.Path)
+	}
+	return tw.Flush()
+}
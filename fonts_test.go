@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"og-image-generator/ogimage"
+)
+
+func TestRunFonts(t *testing.T) {
+	data, err := os.ReadFile(testFontPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "Bold.ttf")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fonts := ogimage.ScanFonts([]string{dir})
+	if len(fonts) != 1 {
+		t.Fatalf("ScanFonts() = %+v, want the test font", fonts)
+	}
+	family := strings.ToUpper(fonts[0].Family)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{name: "list", args: []string{"list"}, want: 1},
+		{name: "matching family", args: []string{"list", family}, want: 1},
+		{name: "other family", args: []string{"list", "Helvetica"}, want: 0},
+		{name: "no command", args: nil, wantErr: true},
+		{name: "unknown command", args: []string{"show"}, wantErr: true},
+		{name: "two families", args: []string{"list", "a", "b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runFonts(tt.args, []string{dir}, &out)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "usage: og-image-generator fonts list") {
+					t.Errorf("runFonts() error = %v, want usage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runFonts() error: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if !strings.HasPrefix(lines[0], "NAME") || len(lines)-1 != tt.want {
+				t.Fatalf("runFonts() printed %q, want a header and %d fonts", out.String(), tt.want)
+			}
+			if tt.want > 0 && (!strings.Contains(lines[1], ":bold") || !strings.HasSuffix(lines[1], path)) {
+				t.Errorf("font line = %q, want a bold font at %s", lines[1], path)
+			}
+		})
+	}
+}
@@ -2,9 +2,14 @@ module og-image-generator
 
 go 1.25
 
-require github.com/fogleman/gg v1.3.0
-
 require (
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	golang.org/x/image v0.35.0 // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/andybalholm/brotli v1.2.0
+	github.com/fogleman/gg v1.3.0
+	github.com/go-text/typesetting v0.2.1
+	golang.org/x/image v0.35.0
+	golang.org/x/text v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
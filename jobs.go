@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/gg"
+
+	"og-image-generator/ogimage"
+)
+
+// Job is a single image to render and the file to write it to.
+// Empty optional fields take the invocation-wide defaults.
+type Job struct {
+	Title     string   `json:"title"`
+	URL       string   `json:"url"`
+	Output    string   `json:"output"`
+	Subtitle  string   `json:"subtitle"`
+	Author    string   `json:"author"`
+	Date      string   `json:"date"`
+	Tags      []string `json:"tags"`
+	BgColor   string   `json:"bg"`
+	BgImage   string   `json:"bg_image"`
+	TitleFont string   `json:"title_font"`
+	URLFont   string   `json:"url_font"`
+	TitleSize float64  `json:"title_size"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+
+	// source and line locate the job in the file it was read from,
+	// for error messages
+	source string
+	line   int
+}
+
+// label identifies the job in progress and error output
+func (row Job) label() string {
+	if row.source != "" {
+		return fmt.Sprintf("%s:%d", row.source, row.line)
+	}
+	return row.Output
+}
+
+// options merges the row over the invocation-wide defaults
+func (row Job) options(defaults ogimage.Options) ogimage.Options {
+	opts := defaults
+	opts.Title = row.Title
+	opts.URL = row.URL
+	if row.Subtitle != "" {
+		opts.Subtitle = row.Subtitle
+	}
+	if row.Author != "" {
+		opts.Author = row.Author
+	}
+	if row.Date != "" {
+		opts.Date = row.Date
+	}
+	if len(row.Tags) > 0 {
+		opts.Tags = row.Tags
+	}
+	if row.BgColor != "" {
+		opts.BgColor = row.BgColor
+	}
+	if row.BgImage != "" {
+		opts.BgImage = row.BgImage
+	}
+	if row.TitleFont != "" {
+		opts.TitleFont = row.TitleFont
+	}
+	if row.URLFont != "" {
+		opts.URLFont = row.URLFont
+	}
+	if row.TitleSize != 0 {
+		opts.TitleSize = row.TitleSize
+	}
+	if row.Width != 0 {
+		opts.Width = row.Width
+	}
+	if row.Height != 0 {
+		opts.Height = row.Height
+	}
+	return opts
+}
+
+// validate checks that the row has the fields every image needs
+func (row Job) validate() error {
+	if row.Title == "" || row.URL == "" || row.Output == "" {
+		return fmt.Errorf("title, url and output are required")
+	}
+	if row.TitleSize < 0 || row.Width < 0 || row.Height < 0 {
+		return fmt.Errorf("title_size, width and height must not be negative")
+	}
+	// NaN passes the check above; infinity would draw nothing useful
+	if math.IsNaN(row.TitleSize) || math.IsInf(row.TitleSize, 0) {
+		return fmt.Errorf("title_size must be a number")
+	}
+	if row.BgColor != "" {
+		if err := ogimage.ValidateBackground(row.BgColor); err != nil {
+			return fmt.Errorf("bg: %w", err)
+		}
+	}
+	return nil
+}
+
+// renderJob renders one job and writes it to row.Output
+func renderJob(renderer *ogimage.Renderer, row Job, defaults ogimage.Options) error {
+	img, err := renderer.Render(context.Background(), row.options(defaults))
+	if err != nil {
+		return err
+	}
+
+	if err := gg.SavePNG(row.Output, img); err != nil {
+		return fmt.Errorf("save png: %w", err)
+	}
+	return nil
+}
+
+// renderJobs renders rows concurrently on the given number of workers.
+// Each image gets its own drawing context; a failed job does not stop the
+// others. report is called once per job as it finishes, never concurrently.
+// It returns the number of failed jobs.
+func renderJobs(renderer *ogimage.Renderer, rows []Job, defaults ogimage.Options, workers int, report func(row Job, err error)) int {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu     sync.Mutex
+		failed int
+		wg     sync.WaitGroup
+	)
+	queue := make(chan Job)
+
+	for range min(workers, len(rows)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range queue {
+				err := renderJob(renderer, row, defaults)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+				}
+				report(row, err)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, row := range rows {
+		queue <- row
+	}
+	close(queue)
+	wg.Wait()
+
+	return failed
+}
+
+// printJobResult reports the outcome of a job on stdout or stderr
+func printJobResult(row Job, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", row.label(), err)
+		return
+	}
+	fmt.Printf("Social image generated: %s\n", row.Output)
+}
+
+// logVerbose prints a -verbose message on stderr
+func logVerbose(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// readJobsFile reads a jobs file of tab-separated title, url and output
+// lines. Blank lines and lines starting with # are skipped.
+func readJobsFile(path string) ([]Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open jobs file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var rows []Job
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected title, url and output separated by tabs, got %d fields", path, line, len(fields))
+		}
+
+		row := Job{
+			Title:  strings.TrimSpace(fields[0]),
+			URL:    strings.TrimSpace(fields[1]),
+			Output: strings.TrimSpace(fields[2]),
+			source: path,
+			line:   line,
+		}
+		if err := row.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rows, nil
+}
+
+// stringList is a flag.Value that collects every occurrence of a
+// repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"og-image-generator/ogimage"
+)
+
+func TestReadJobsFile(t *testing.T) {
+	t.Run("tab separated lines", func(t *testing.T) {
+		path := writeManifest(t, "jobs.txt", "# title\turl\toutput\n"+
+			"First Post\thttps://example.com/a\tout/a.png\n"+
+			"\n"+
+			"Second Post\thttps://example.com/b\tout/b.png\n")
+
+		rows, err := readJobsFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("got %d jobs, want 2", len(rows))
+		}
+		if rows[0].Title != "First Post" || rows[0].URL != "https://example.com/a" || rows[0].Output != "out/a.png" {
+			t.Errorf("unexpected first job: %+v", rows[0])
+		}
+		if rows[1].label() != path+":4" {
+			t.Errorf("second job label = %q, want %q", rows[1].label(), path+":4")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"wrong field count", "Title\thttps://example.com\n", "jobs.txt:1: expected title, url and output"},
+		{"empty field", "Title\t\tout.png\n", "jobs.txt:1: title, url and output are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeManifest(t, "jobs.txt", tt.content)
+			_, err := readJobsFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readJobsFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := readJobsFile("/nonexistent/jobs.txt")
+		if err == nil || !strings.Contains(err.Error(), "open jobs file") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestJobLabel(t *testing.T) {
+	if got := (Job{Output: "out.png"}).label(); got != "out.png" {
+		t.Errorf("label() = %q, want output path", got)
+	}
+	if got := (Job{Output: "out.png", source: "cards.csv", line: 3}).label(); got != "cards.csv:3" {
+		t.Errorf("label() = %q, want %q", got, "cards.csv:3")
+	}
+}
+
+func TestRenderJobs(t *testing.T) {
+	fontPath := testFontPath(t)
+	defaults := ogimage.Options{TitleFont: fontPath, URLFont: fontPath}
+
+	t.Run("renders all jobs across workers", func(t *testing.T) {
+		outDir := t.TempDir()
+		var rows []Job
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			rows = append(rows, Job{
+				Title:  "Title " + name,
+				URL:    "https://example.com/" + name,
+				Output: filepath.Join(outDir, name+".png"),
+			})
+		}
+
+		var mu sync.Mutex
+		reported := make(map[string]error)
+		failed := renderJobs(ogimage.NewRenderer(), rows, defaults, 3, func(row Job, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported[row.Output] = err
+		})
+
+		if failed != 0 {
+			t.Errorf("renderJobs() failed = %d, want 0", failed)
+		}
+		if len(reported) != len(rows) {
+			t.Errorf("reported %d jobs, want %d", len(reported), len(rows))
+		}
+		for _, row := range rows {
+			if _, err := os.Stat(row.Output); err != nil {
+				t.Errorf("output %s was not created: %v", row.Output, err)
+			}
+		}
+	})
+
+	t.Run("failures do not abort other jobs", func(t *testing.T) {
+		outDir := t.TempDir()
+		rows := []Job{
+			{Title: "Bad", URL: "https://example.com/a", Output: filepath.Join(outDir, "missing", "a.png")},
+			{Title: "Good", URL: "https://example.com/b", Output: filepath.Join(outDir, "b.png")},
+			{Title: "Bad font", URL: "https://example.com/c", Output: filepath.Join(outDir, "c.png"), TitleFont: "/nonexistent/font.ttf"},
+		}
+
+		var errs []error
+		failed := renderJobs(ogimage.NewRenderer(), rows, defaults, 2, func(row Job, err error) {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		})
+
+		if failed != 2 || len(errs) != 2 {
+			t.Errorf("renderJobs() failed = %d (reported %d), want 2", failed, len(errs))
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "b.png")); err != nil {
+			t.Errorf("good job was not rendered: %v", err)
+		}
+	})
+
+	t.Run("no jobs", func(t *testing.T) {
+		failed := renderJobs(ogimage.NewRenderer(), nil, defaults, 4, func(Job, error) {
+			t.Error("report should not be called")
+		})
+		if failed != 0 {
+			t.Errorf("renderJobs() failed = %d, want 0", failed)
+		}
+	})
+}
+
+func TestParseFlagsMultipleJobs(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("repeated triples", func(t *testing.T) {
+		os.Args = []string{
+			"og-image-generator",
+			"-title", "First", "-url", "https://example.com/a", "-output", "a.png",
+			"-title", "Second", "-url", "https://example.com/b", "-output", "b.png",
+			"-workers", "2",
+		}
+		resetFlags()
+
+		opts, err := parseFlags()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(opts.Jobs) != 2 {
+			t.Fatalf("got %d jobs, want 2", len(opts.Jobs))
+		}
+		if opts.Jobs[1].Title != "Second" || opts.Jobs[1].URL != "https://example.com/b" || opts.Jobs[1].Output != "b.png" {
+			t.Errorf("unexpected second job: %+v", opts.Jobs[1])
+		}
+		if opts.Workers != 2 {
+			t.Errorf("Workers = %d, want 2", opts.Workers)
+		}
+	})
+
+	t.Run("jobs file combined with flags", func(t *testing.T) {
+		jobsFile := writeManifest(t, "jobs.txt", "From File\thttps://example.com/f\tf.png\n")
+		os.Args = []string{
+			"og-image-generator",
+			"-title", "First", "-url", "https://example.com/a", "-output", "a.png",
+			"-jobs", jobsFile,
+		}
+		resetFlags()
+
+		opts, err := parseFlags()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(opts.Jobs) != 2 || opts.Jobs[1].Title != "From File" {
+			t.Errorf("unexpected jobs: %+v", opts.Jobs)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"more titles than urls", []string{"-title", "A", "-title", "B", "-url", "https://example.com", "-output", "a.png", "-output", "b.png"}, "got 2 -title and 1 -url"},
+		{"multiple jobs need outputs", []string{"-title", "A", "-url", "https://a.com", "-title", "B", "-url", "https://b.com"}, "each -title needs its own -output"},
+		{"empty title", []string{"-title", "", "-url", "https://a.com"}, "title and url are required"},
+		{"zero workers", []string{"-title", "A", "-url", "https://a.com", "-workers", "0"}, "workers must be at least 1"},
+		{"empty jobs file", []string{"-jobs", "EMPTY"}, "no images to render"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"og-image-generator"}, tt.args...)
+			for i, a := range args {
+				if a == "EMPTY" {
+					args[i] = writeManifest(t, "jobs.txt", "# nothing here\n")
+				}
+			}
+			os.Args = args
+			resetFlags()
+
+			_, err := parseFlags()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlags() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunMultipleJobs(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	t.Run("renders every image", func(t *testing.T) {
+		outDir := t.TempDir()
+		os.Args = []string{
+			"og-image-generator",
+			"-title", "First", "-url", "https://example.com/a", "-output", filepath.Join(outDir, "a.png"),
+			"-title", "Second", "-url", "https://example.com/b", "-output", filepath.Join(outDir, "b.png"),
+			"-title-font", fontPath,
+			"-url-font", fontPath,
+		}
+		resetFlags()
+
+		if err := run(); err != nil {
+			t.Fatalf("run() unexpected error: %v", err)
+		}
+		for _, name := range []string{"a.png", "b.png"} {
+			if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+				t.Errorf("output %s was not created: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("reports failures without aborting", func(t *testing.T) {
+		outDir := t.TempDir()
+		os.Args = []string{
+			"og-image-generator",
+			"-title", "First", "-url", "https://example.com/a", "-output", filepath.Join(outDir, "missing", "a.png"),
+			"-title", "Second", "-url", "https://example.com/b", "-output", filepath.Join(outDir, "b.png"),
+			"-title-font", fontPath,
+			"-url-font", fontPath,
+		}
+		resetFlags()
+
+		err := run()
+		if err == nil || !strings.Contains(err.Error(), "1 of 2 images failed") {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "b.png")); err != nil {
+			t.Errorf("second image was not created: %v", err)
+		}
+	})
+}
@@ -3,13 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
-	"image/color"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
-	"github.com/fogleman/gg"
+	"og-image-generator/ogimage"
 )
 
 // testFontPath returns a valid font path for testing
@@ -31,83 +30,6 @@ func testFontPath(t *testing.T) string {
 	return ""
 }
 
-func TestHexToRGB(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected color.Color
-	}{
-		{
-			name:     "valid hex color",
-			input:    "#1a1a2e",
-			expected: color.RGBA{0x1a, 0x1a, 0x2e, 0xff},
-		},
-		{
-			name:     "valid hex without hash",
-			input:    "16a085",
-			expected: color.RGBA{0x16, 0xa0, 0x85, 0xff},
-		},
-		{
-			name:     "black",
-			input:    "#000000",
-			expected: color.RGBA{0x00, 0x00, 0x00, 0xff},
-		},
-		{
-			name:     "white",
-			input:    "#ffffff",
-			expected: color.RGBA{0xff, 0xff, 0xff, 0xff},
-		},
-		{
-			name:     "invalid hex - too short",
-			input:    "#fff",
-			expected: color.RGBA{26, 26, 46, 255}, // default
-		},
-		{
-			name:     "invalid hex - non-hex chars",
-			input:    "#gggggg",
-			expected: color.RGBA{26, 26, 46, 255}, // default
-		},
-		{
-			name:     "empty string",
-			input:    "",
-			expected: color.RGBA{26, 26, 46, 255}, // default
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := hexToRGB(tt.input)
-			resultRGBA := result.(color.RGBA)
-			expectedRGBA := tt.expected.(color.RGBA)
-
-			if resultRGBA != expectedRGBA {
-				t.Errorf("hexToRGB(%q) = %v, want %v", tt.input, resultRGBA, expectedRGBA)
-			}
-		})
-	}
-}
-
-func TestHexToRGBCaseInsensitive(t *testing.T) {
-	// Test that hex parsing is case-insensitive
-	tests := []struct {
-		input1 string
-		input2 string
-	}{
-		{"#1A1A2E", "#1a1a2e"},
-		{"#FFFFFF", "#ffffff"},
-		{"#AbCdEf", "#abcdef"},
-	}
-
-	for _, tt := range tests {
-		c1 := hexToRGB(tt.input1)
-		c2 := hexToRGB(tt.input2)
-
-		if c1 != c2 {
-			t.Errorf("hexToRGB should be case-insensitive: %v != %v", c1, c2)
-		}
-	}
-}
-
 func TestFlagValidation(t *testing.T) {
 	// Test that required flags are documented
 	// This is a meta-test to ensure the help text is clear
@@ -127,295 +49,6 @@ func TestFlagValidation(t *testing.T) {
 	}
 }
 
-func TestResolveFontPath(t *testing.T) {
-	t.Run("custom font path provided", func(t *testing.T) {
-		customPath := "/custom/font/path.ttf"
-		result, err := resolveFontPath(customPath)
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		if result != customPath {
-			t.Errorf("expected %q, got %q", customPath, result)
-		}
-	})
-
-	t.Run("empty path uses system font", func(t *testing.T) {
-		result, err := resolveFontPath("")
-		// Should either find a system font or return an error
-		if err != nil {
-			if !strings.Contains(err.Error(), "font file not found") {
-				t.Errorf("unexpected error: %v", err)
-			}
-		} else {
-			if result == "" {
-				t.Error("expected non-empty font path")
-			}
-		}
-	})
-
-	t.Run("local fonts directory", func(t *testing.T) {
-		// Create a temporary fonts directory with a font file
-		tmpDir := t.TempDir()
-		fontsDir := filepath.Join(tmpDir, "fonts")
-		if err := os.MkdirAll(fontsDir, 0755); err != nil {
-			t.Fatal(err)
-		}
-
-		// Create a dummy font file
-		fontFile := filepath.Join(fontsDir, "OpenSans-Bold.ttf")
-		if err := os.WriteFile(fontFile, []byte("dummy"), 0644); err != nil {
-			t.Fatal(err)
-		}
-
-		// Change to the temp directory to test local font resolution
-		oldWd, _ := os.Getwd()
-		defer os.Chdir(oldWd)
-		os.Chdir(tmpDir)
-
-		result, err := resolveFontPath("")
-		if err != nil {
-			t.Errorf("unexpected error when local font exists: %v", err)
-		}
-		if result != filepath.Join("fonts", "OpenSans-Bold.ttf") {
-			t.Errorf("expected local font path, got %q", result)
-		}
-	})
-}
-
-func TestDrawBackground(t *testing.T) {
-	tests := []struct {
-		name    string
-		bgColor string
-		width   int
-		height  int
-	}{
-		{"default color", "#1a1a2e", 1200, 628},
-		{"white background", "#ffffff", 800, 600},
-		{"red background", "#ff0000", 1920, 1080},
-		{"invalid color falls back to default", "#invalid", 1200, 628},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dc := gg.NewContext(tt.width, tt.height)
-			// Should not panic
-			drawBackground(dc, tt.bgColor, tt.width, tt.height)
-
-			// Verify the context was modified (image should have content)
-			img := dc.Image()
-			if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
-				t.Errorf("unexpected image dimensions: got %dx%d, want %dx%d",
-					img.Bounds().Dx(), img.Bounds().Dy(), tt.width, tt.height)
-			}
-		})
-	}
-}
-
-func TestDrawTitle(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	tests := []struct {
-		name    string
-		title   string
-		width   int
-		wantErr bool
-	}{
-		{"simple title", "Hello World", 1200, false},
-		{"long title", "This is a very long title that should wrap across multiple lines in the image", 1200, false},
-		{"unicode title", "日本語タイトル", 1200, false},
-		{"empty title", "", 1200, false},
-		{"narrow width", "Test Title", 200, false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dc := gg.NewContext(tt.width, 628)
-			err := drawTitle(dc, tt.title, fontPath, tt.width, TitleFontSize)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("drawTitle() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-
-	t.Run("invalid font path", func(t *testing.T) {
-		dc := gg.NewContext(1200, 628)
-		err := drawTitle(dc, "Test", "/nonexistent/font.ttf", 1200, TitleFontSize)
-		if err == nil {
-			t.Error("expected error for invalid font path")
-		}
-		if !strings.Contains(err.Error(), "load font") {
-			t.Errorf("expected 'load font' error, got: %v", err)
-		}
-	})
-}
-
-func TestDrawURL(t *testing.T) {
-	titleFontPath := testFontPath(t)
-	urlFontPath := testFontPath(t)
-
-	tests := []struct {
-		name    string
-		url     string
-		width   int
-		height  int
-		wantErr bool
-	}{
-		{"simple url", "https://example.com", 1200, 628, false},
-		{"long url", "https://example.com/very/long/path/to/article/that/might/need/smaller/font", 1200, 628, false},
-		{"very long url forces minimum font", "https://example.com/" + strings.Repeat("a", 200), 1200, 628, false},
-		{"narrow width", "https://example.com", 300, 628, false},
-		{"empty url", "", 1200, 628, false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dc := gg.NewContext(tt.width, tt.height)
-			err := drawURL(dc, tt.url, titleFontPath, urlFontPath, tt.width, tt.height, TitleFontSize)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("drawURL() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-
-	t.Run("invalid font path", func(t *testing.T) {
-		dc := gg.NewContext(1200, 628)
-		err := drawURL(dc, "https://example.com", "/nonexistent/title-font.ttf", "/nonexistent/font.ttf", 1200, 628, TitleFontSize)
-		if err == nil {
-			t.Error("expected error for invalid font path")
-		}
-		if !strings.Contains(err.Error(), "load font") {
-			t.Errorf("expected 'load font' error, got: %v", err)
-		}
-	})
-}
-
-func TestDrawURLPositionDynamic(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	// Test that URL is positioned dynamically based on image height
-	// and sits on the baseline grid established by the title font
-	tests := []struct {
-		name   string
-		height int
-	}{
-		{"standard height", 628},
-		{"short height", 400},
-		{"tall height", 1080},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dc := gg.NewContext(1200, tt.height)
-			err := drawURL(dc, "https://example.com/article", fontPath, fontPath, 1200, tt.height, TitleFontSize)
-			if err != nil {
-				t.Fatalf("drawURL() error: %v", err)
-			}
-
-			// Load title font to calculate the baseline grid
-			if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
-				t.Fatalf("failed to load font: %v", err)
-			}
-			titleFontHeight := measureFontHeight(dc)
-
-			// Calculate the baseline grid
-			firstBaseline := TextTopMargin + titleFontHeight
-			baselineStep := titleFontHeight * LineSpacing
-			// URL should not be drawn within TextTopMargin from the bottom
-			maxY := float64(tt.height) - TextTopMargin/2
-
-			// Find the last baseline that fits
-			expectedY := firstBaseline
-			for y := firstBaseline; y <= maxY; y += baselineStep {
-				expectedY = y
-			}
-
-			// Verify the URL baseline is within bounds
-			if expectedY > maxY {
-				t.Errorf("URL baseline %f exceeds max allowed Y %f", expectedY, maxY)
-			}
-
-			// Verify the baseline is on the grid (should be firstBaseline + n*baselineStep)
-			stepsFromFirst := (expectedY - firstBaseline) / baselineStep
-			if stepsFromFirst < 0 {
-				t.Errorf("URL baseline is before first baseline")
-			}
-
-			// The URL should be visible - check for non-background pixels
-			img := dc.Image()
-
-			// Check around the expected baseline position
-			foundURLPixels := false
-			searchStart := int(expectedY) - 30
-			if searchStart < 0 {
-				searchStart = 0
-			}
-			searchEnd := int(expectedY) + 10
-			if searchEnd > tt.height {
-				searchEnd = tt.height
-			}
-
-			for y := searchStart; y < searchEnd; y++ {
-				for x := int(TextSideMargin); x < 400; x++ {
-					r, g, b, a := img.At(x, y).RGBA()
-					// Look for non-transparent, non-black pixels (the muted text color)
-					if a > 0 && (r > 0 || g > 0 || b > 0) {
-						foundURLPixels = true
-						break
-					}
-				}
-				if foundURLPixels {
-					break
-				}
-			}
-
-			if !foundURLPixels {
-				t.Errorf("URL text not found near expected baseline %f (height=%d)", expectedY, tt.height)
-			}
-		})
-	}
-}
-
-func TestDrawURLRespectsBottomMargin(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	// Test that the URL is not drawn within TextTopMargin from the bottom of the image
-	t.Run("URL respects bottom margin equal to TextTopMargin", func(t *testing.T) {
-		width := 1200
-		height := 628
-		dc := gg.NewContext(width, height)
-
-		err := drawURL(dc, "https://example.com/article", fontPath, fontPath, width, height, TitleFontSize)
-		if err != nil {
-			t.Fatalf("drawURL() error: %v", err)
-		}
-
-		// Load title font to calculate the baseline grid
-		if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
-			t.Fatalf("failed to load font: %v", err)
-		}
-		titleFontHeight := measureFontHeight(dc)
-
-		// Calculate the baseline grid
-		firstBaseline := TextTopMargin + titleFontHeight
-		baselineStep := titleFontHeight * LineSpacing
-		// The max Y should be height - TextTopMargin (not height - BackgroundMargin)
-		maxY := float64(height) - TextTopMargin
-
-		// Find the last baseline that fits within the margin
-		expectedY := firstBaseline
-		for y := firstBaseline; y <= maxY; y += baselineStep {
-			expectedY = y
-		}
-
-		// The URL baseline should be at least TextTopMargin away from the bottom
-		bottomDistance := float64(height) - expectedY
-		if bottomDistance < TextTopMargin {
-			t.Errorf("URL baseline at y=%f is only %f pixels from bottom (height=%d), should be at least %f",
-				expectedY, bottomDistance, height, TextTopMargin)
-		}
-	})
-}
-
 func TestRun(t *testing.T) {
 	fontPath := testFontPath(t)
 
@@ -558,14 +191,18 @@ func TestParseFlags(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if opts.Title != "My Title" {
-			t.Errorf("Title = %q, want %q", opts.Title, "My Title")
+		if len(opts.Jobs) != 1 {
+			t.Fatalf("got %d jobs, want 1", len(opts.Jobs))
+		}
+		job := opts.Jobs[0]
+		if job.Title != "My Title" {
+			t.Errorf("Title = %q, want %q", job.Title, "My Title")
 		}
-		if opts.URL != "https://example.com" {
-			t.Errorf("URL = %q, want %q", opts.URL, "https://example.com")
+		if job.URL != "https://example.com" {
+			t.Errorf("URL = %q, want %q", job.URL, "https://example.com")
 		}
-		if opts.Output != "custom.png" {
-			t.Errorf("Output = %q, want %q", opts.Output, "custom.png")
+		if job.Output != "custom.png" {
+			t.Errorf("Output = %q, want %q", job.Output, "custom.png")
 		}
 		if opts.Width != 1920 {
 			t.Errorf("Width = %d, want %d", opts.Width, 1920)
@@ -600,8 +237,8 @@ func TestParseFlags(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if opts.Output != "social-image.png" {
-			t.Errorf("Output = %q, want default %q", opts.Output, "social-image.png")
+		if opts.Jobs[0].Output != "social-image.png" {
+			t.Errorf("Output = %q, want default %q", opts.Jobs[0].Output, "social-image.png")
 		}
 		if opts.Width != 1200 {
 			t.Errorf("Width = %d, want default %d", opts.Width, 1200)
@@ -711,95 +348,6 @@ func TestGetVersionString(t *testing.T) {
 	})
 }
 
-func TestResolveFontPathNoFontsFound(t *testing.T) {
-	// Test the case where no fonts are found
-	// We need to be in a directory without the local fonts folder
-	// and use empty system font paths
-
-	tmpDir := t.TempDir()
-	oldWd, _ := os.Getwd()
-	defer os.Chdir(oldWd)
-	os.Chdir(tmpDir)
-
-	// Test with no system fonts available
-	result, err := resolveFontPathWithPaths("", []string{})
-	if err == nil {
-		t.Errorf("expected error when no fonts found, got result: %q", result)
-	}
-	if !strings.Contains(err.Error(), "font file not found") {
-		t.Errorf("unexpected error message: %v", err)
-	}
-}
-
-func TestResolveFontPathWithPaths(t *testing.T) {
-	t.Run("custom font takes precedence", func(t *testing.T) {
-		result, err := resolveFontPathWithPaths("/custom/font.ttf", []string{"/system/font.ttf"})
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		if result != "/custom/font.ttf" {
-			t.Errorf("expected custom font path, got %q", result)
-		}
-	})
-
-	t.Run("finds system font when no custom font", func(t *testing.T) {
-		// Create a temp directory and change to it (no local fonts)
-		tmpDir := t.TempDir()
-		oldWd, _ := os.Getwd()
-		defer os.Chdir(oldWd)
-		os.Chdir(tmpDir)
-
-		// Use actual system font path
-		fontPath := testFontPath(t)
-		result, err := resolveFontPathWithPaths("", []string{fontPath})
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		if result != fontPath {
-			t.Errorf("expected system font path %q, got %q", fontPath, result)
-		}
-	})
-
-	t.Run("searches multiple paths", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		oldWd, _ := os.Getwd()
-		defer os.Chdir(oldWd)
-		os.Chdir(tmpDir)
-
-		fontPath := testFontPath(t)
-		// First path doesn't exist, second does
-		result, err := resolveFontPathWithPaths("", []string{"/nonexistent/font.ttf", fontPath})
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		if result != fontPath {
-			t.Errorf("expected %q, got %q", fontPath, result)
-		}
-	})
-
-	t.Run("local fonts directory takes precedence over system", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		fontsDir := filepath.Join(tmpDir, "fonts")
-		os.MkdirAll(fontsDir, 0755)
-		localFont := filepath.Join(fontsDir, "OpenSans-Bold.ttf")
-		os.WriteFile(localFont, []byte("dummy"), 0644)
-
-		oldWd, _ := os.Getwd()
-		defer os.Chdir(oldWd)
-		os.Chdir(tmpDir)
-
-		systemFont := testFontPath(t)
-		result, err := resolveFontPathWithPaths("", []string{systemFont})
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		// Should find local font first
-		if result != filepath.Join("fonts", "OpenSans-Bold.ttf") {
-			t.Errorf("expected local font, got %q", result)
-		}
-	})
-}
-
 func TestRunWithURLFontError(t *testing.T) {
 	fontPath := testFontPath(t)
 	tmpDir := t.TempDir()
@@ -883,282 +431,6 @@ func TestRunDrawURLError(t *testing.T) {
 	}
 }
 
-func TestPreventOrphans(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    []string
-		expected []string
-	}{
-		{
-			name:     "no lines",
-			input:    []string{},
-			expected: []string{},
-		},
-		{
-			name:     "single line",
-			input:    []string{"Hello World"},
-			expected: []string{"Hello World"},
-		},
-		{
-			name:     "two lines no orphan",
-			input:    []string{"Hello World", "Foo Bar"},
-			expected: []string{"Hello World", "Foo Bar"},
-		},
-		{
-			name:     "orphan on last line",
-			input:    []string{"Hello World Foo", "Bar"},
-			expected: []string{"Hello World", "Foo Bar"},
-		},
-		{
-			name:     "three lines with orphan",
-			input:    []string{"First Line Here", "Second Line Words", "Orphan"},
-			expected: []string{"First Line Here", "Second Line", "Words Orphan"},
-		},
-		{
-			name:     "previous line has only one word - cannot fix",
-			input:    []string{"Hello", "World"},
-			expected: []string{"Hello", "World"},
-		},
-		{
-			name:     "last line already has multiple words",
-			input:    []string{"Hello World", "Foo Bar Baz"},
-			expected: []string{"Hello World", "Foo Bar Baz"},
-		},
-		{
-			name:     "nil input",
-			input:    nil,
-			expected: nil,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := preventOrphans(tt.input)
-
-			if len(result) != len(tt.expected) {
-				t.Errorf("preventOrphans() returned %d lines, want %d", len(result), len(tt.expected))
-				return
-			}
-
-			for i := range result {
-				if result[i] != tt.expected[i] {
-					t.Errorf("preventOrphans()[%d] = %q, want %q", i, result[i], tt.expected[i])
-				}
-			}
-		})
-	}
-}
-
-func TestWrapText(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	tests := []struct {
-		name           string
-		text           string
-		maxWidth       float64
-		minLines       int // minimum expected lines
-		checkNoOrphans bool
-	}{
-		{
-			name:           "empty text",
-			text:           "",
-			maxWidth:       500,
-			minLines:       0,
-			checkNoOrphans: false,
-		},
-		{
-			name:           "single word",
-			text:           "Hello",
-			maxWidth:       500,
-			minLines:       1,
-			checkNoOrphans: false,
-		},
-		{
-			name:           "short text fits on one line",
-			text:           "Hello World",
-			maxWidth:       500,
-			minLines:       1,
-			checkNoOrphans: false,
-		},
-		{
-			name:           "text wraps to multiple lines",
-			text:           "This is a longer title that should wrap across multiple lines",
-			maxWidth:       300,
-			minLines:       2,
-			checkNoOrphans: true,
-		},
-		{
-			name:           "title ending with single word should not orphan",
-			text:           "Building High-Performance Web Services Today",
-			maxWidth:       400,
-			minLines:       2,
-			checkNoOrphans: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			dc := gg.NewContext(1200, 628)
-			if err := dc.LoadFontFace(fontPath, 72); err != nil {
-				t.Fatalf("failed to load font: %v", err)
-			}
-
-			lines := wrapText(dc, tt.text, tt.maxWidth)
-
-			if len(lines) < tt.minLines {
-				t.Errorf("wrapText() returned %d lines, want at least %d", len(lines), tt.minLines)
-			}
-
-			if tt.checkNoOrphans && len(lines) >= 2 {
-				lastLine := lines[len(lines)-1]
-				words := strings.Fields(lastLine)
-				if len(words) == 1 {
-					// Check if previous line has only one word (unavoidable orphan)
-					prevLine := lines[len(lines)-2]
-					prevWords := strings.Fields(prevLine)
-					if len(prevWords) >= 2 {
-						t.Errorf("wrapText() created orphan: last line has only one word %q", lastLine)
-					}
-				}
-			}
-
-			// Verify all words are preserved
-			originalWords := strings.Fields(tt.text)
-			var resultWords []string
-			for _, line := range lines {
-				resultWords = append(resultWords, strings.Fields(line)...)
-			}
-
-			if len(originalWords) != len(resultWords) {
-				t.Errorf("wrapText() lost words: got %d, want %d", len(resultWords), len(originalWords))
-			}
-		})
-	}
-}
-
-func TestWrapTextOrphanPrevention(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	// This test specifically verifies orphan prevention behavior
-	dc := gg.NewContext(1200, 628)
-	if err := dc.LoadFontFace(fontPath, 72); err != nil {
-		t.Fatalf("failed to load font: %v", err)
-	}
-
-	// Test with a title that would naturally create an orphan
-	// "Advanced Patterns for Building High-Performance Web Services"
-	// At certain widths, "Services" might end up alone on the last line
-	title := "Advanced Patterns for Building High-Performance Web Services"
-
-	// Use a width that would cause wrapping
-	lines := wrapText(dc, title, 600)
-
-	if len(lines) < 2 {
-		t.Skip("text did not wrap at this width, cannot test orphan prevention")
-	}
-
-	// Check that last line doesn't have a single word (unless unavoidable)
-	lastLine := lines[len(lines)-1]
-	lastWords := strings.Fields(lastLine)
-
-	if len(lastWords) == 1 {
-		// Verify this is unavoidable (previous line has only one word)
-		prevLine := lines[len(lines)-2]
-		prevWords := strings.Fields(prevLine)
-		if len(prevWords) >= 2 {
-			t.Errorf("orphan detected: last line %q has only one word, but previous line %q has %d words",
-				lastLine, prevLine, len(prevWords))
-		}
-	}
-}
-
-func TestPreventOrphansLineBalancing(t *testing.T) {
-	// Test the improved orphan algorithm that balances lines when a word is moved.
-	// When a word is moved from line N to line N+1, we check if line N-1 ends with
-	// two words that both start after the length of line N. If so, we move one word
-	// down to balance the lines.
-	//
-	// Example scenario:
-	// Before orphan prevention:
-	//   Line 1: "The as via or"      (length ~X)
-	//   Line 2: "with can alt"       (length ~Y, shorter)
-	//   Line 3: "vip"                (orphan)
-	//
-	// After basic orphan prevention (move "alt" down):
-	//   Line 1: "The as via or"      (length ~X)
-	//   Line 2: "with can"           (length ~Z, now even shorter)
-	//   Line 3: "alt vip"            (no longer orphan)
-	//
-	// With improved balancing, we check if line 1 ends with two words ("via or")
-	// that both start after the length of line 2 ("with can"). If "via" starts
-	// after the end of "with can", we should move "or" down to balance:
-	//   Line 1: "The as via"
-	//   Line 2: "or with can"
-	//   Line 3: "alt vip"
-
-	tests := []struct {
-		name     string
-		input    []string
-		expected []string
-	}{
-		{
-			name: "balance lines when previous line has trailing short words",
-			// Line 1: "aaaa bb cc" is longer than line 2: "dd ee"
-			// After orphan fix: line 2 becomes "dd" and line 3 becomes "ee ff"
-			// Now line 1 ends with "bb cc" - check if "bb" starts after len("dd")
-			// If so, move "cc" down to balance
-			input:    []string{"aaaa bb cc", "dd ee", "ff"},
-			expected: []string{"aaaa bb", "cc dd", "ee ff"},
-		},
-		{
-			name:     "no balancing needed when lines are already balanced",
-			input:    []string{"aaaa bbbb", "cccc dddd", "ee ff"},
-			expected: []string{"aaaa bbbb", "cccc dddd", "ee ff"},
-		},
-		{
-			name: "balance propagates up multiple lines",
-			// After orphan fix on line 3, line 2 becomes short, triggering balance from line 1
-			input:    []string{"aa bb cc dd", "ee ff gg", "hh"},
-			expected: []string{"aa bb cc", "dd ee ff", "gg hh"},
-		},
-		{
-			name:     "single line unchanged",
-			input:    []string{"hello world"},
-			expected: []string{"hello world"},
-		},
-		{
-			name:     "two lines no orphan unchanged",
-			input:    []string{"hello world", "foo bar"},
-			expected: []string{"hello world", "foo bar"},
-		},
-		{
-			name: "orphan fixed but no balancing needed",
-			// After orphan fix, line 1 doesn't have trailing words past line 2's length
-			input:    []string{"aa bb", "cc dd ee", "ff"},
-			expected: []string{"aa bb", "cc dd", "ee ff"},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := preventOrphans(tt.input)
-
-			if len(result) != len(tt.expected) {
-				t.Errorf("preventOrphans() returned %d lines, want %d\ngot: %v\nwant: %v",
-					len(result), len(tt.expected), result, tt.expected)
-				return
-			}
-
-			for i := range result {
-				if result[i] != tt.expected[i] {
-					t.Errorf("preventOrphans()[%d] = %q, want %q\nfull result: %v",
-						i, result[i], tt.expected[i], result)
-				}
-			}
-		})
-	}
-}
-
 func TestMain(m *testing.M) {
 	// This runs all tests
 	os.Exit(m.Run())
@@ -1248,74 +520,8 @@ func TestTitleSizeFlag(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if opts.TitleSize != TitleFontSize {
-			t.Errorf("expected TitleSize to default to %f, got %f", TitleFontSize, opts.TitleSize)
-		}
-	})
-}
-
-func TestDrawDebugBaselines(t *testing.T) {
-	fontPath := testFontPath(t)
-
-	t.Run("draws baseline at correct position", func(t *testing.T) {
-		dc := gg.NewContext(1200, 628)
-
-		// Load font to get proper metrics
-		if err := dc.LoadFontFace(fontPath, 72); err != nil {
-			t.Fatalf("failed to load font: %v", err)
-		}
-
-		textTopMargin := 90.0
-		lineSpacing := 1.5
-		_, fontHeight := dc.MeasureString("Mg")
-		verticalOffset := fontHeight
-
-		// Calculate expected first baseline position (same as drawTitle)
-		expectedFirstBaseline := textTopMargin + verticalOffset
-
-		// Draw debug baselines
-		drawDebugBaselines(dc, fontHeight, lineSpacing, textTopMargin, 1200, 628)
-
-		// Verify a red pixel exists at the baseline position
-		// Check at x=100 (middle of the line) and y=expectedFirstBaseline
-		img := dc.Image()
-		r, g, b, _ := img.At(100, int(expectedFirstBaseline)).RGBA()
-
-		// Red should be high, green and blue should be low
-		if r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
-			t.Errorf("expected red pixel at baseline y=%d, got RGBA(%d, %d, %d, _)",
-				int(expectedFirstBaseline), r>>8, g>>8, b>>8)
-		}
-	})
-
-	t.Run("draws multiple baselines at line height intervals", func(t *testing.T) {
-		dc := gg.NewContext(1200, 628)
-
-		if err := dc.LoadFontFace(fontPath, 72); err != nil {
-			t.Fatalf("failed to load font: %v", err)
-		}
-
-		textTopMargin := 90.0
-		lineSpacing := 1.5
-		_, fontHeight := dc.MeasureString("Mg")
-		verticalOffset := fontHeight
-
-		drawDebugBaselines(dc, fontHeight, lineSpacing, textTopMargin, 1200, 628)
-
-		img := dc.Image()
-
-		// Check first baseline
-		firstBaseline := textTopMargin + verticalOffset
-		r1, g1, b1, _ := img.At(100, int(firstBaseline)).RGBA()
-		if r1>>8 < 200 || g1>>8 > 50 || b1>>8 > 50 {
-			t.Errorf("expected red pixel at first baseline y=%d", int(firstBaseline))
-		}
-
-		// Check second baseline (one line height * spacing down)
-		secondBaseline := firstBaseline + fontHeight*lineSpacing
-		r2, g2, b2, _ := img.At(100, int(secondBaseline)).RGBA()
-		if r2>>8 < 200 || g2>>8 > 50 || b2>>8 > 50 {
-			t.Errorf("expected red pixel at second baseline y=%d", int(secondBaseline))
+		if opts.TitleSize != ogimage.TitleFontSize {
+			t.Errorf("expected TitleSize to default to %f, got %f", ogimage.TitleFontSize, opts.TitleSize)
 		}
 	})
 }
@@ -1366,12 +572,12 @@ func TestRunWithResolverTitleFontError(t *testing.T) {
 
 	// Create a resolver that fails on title font (first call)
 	callCount := 0
-	failingResolver := func(customFont string) (string, error) {
+	failingResolver := func(customFont string) (string, map[string]float64, error) {
 		callCount++
 		if callCount == 1 {
-			return "", fmt.Errorf("title font not found")
+			return "", nil, fmt.Errorf("title font not found")
 		}
-		return testFontPath(t), nil
+		return testFontPath(t), nil, nil
 	}
 
 	err := runWithResolver(failingResolver)
@@ -1396,12 +602,12 @@ func TestRunWithResolverURLFontError(t *testing.T) {
 
 	// Create a resolver that succeeds on title font but fails on URL font
 	callCount := 0
-	failingResolver := func(customFont string) (string, error) {
+	failingResolver := func(customFont string) (string, map[string]float64, error) {
 		callCount++
 		if callCount == 2 {
-			return "", fmt.Errorf("url font not found")
+			return "", nil, fmt.Errorf("url font not found")
 		}
-		return testFontPath(t), nil
+		return testFontPath(t), nil, nil
 	}
 
 	err := runWithResolver(failingResolver)
@@ -0,0 +1,124 @@
+package ogimage
+
+// Horizontal alignments of the title lines and the URL
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// Vertical placements of the title block and the URL
+const (
+	VAlignTop    = "top"
+	VAlignMiddle = "middle"
+	VAlignBottom = "bottom"
+)
+
+// validAlign reports whether align is empty or a known horizontal alignment
+func validAlign(align string) bool {
+	switch align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+		return true
+	}
+	return false
+}
+
+// validVAlign reports whether valign is empty or a known vertical placement
+func validVAlign(valign string) bool {
+	switch valign {
+	case "", VAlignTop, VAlignMiddle, VAlignBottom:
+		return true
+	}
+	return false
+}
+
+// defaultAlign returns the alignment of a title and URL left empty:
+// AlignRight if the title is right-to-left, and AlignLeft otherwise
+func defaultAlign(title string) string {
+	if isRTL(title) {
+		return AlignRight
+	}
+	return AlignLeft
+}
+
+// alignOffset returns how far from the left of a column maxWidth wide a
+// line lineWidth wide starts. Lines wider than the column start at its left.
+func alignOffset(align string, maxWidth, lineWidth float64) float64 {
+	slack := max(maxWidth-lineWidth, 0)
+	switch align {
+	case AlignCenter:
+		return slack / 2
+	case AlignRight:
+		return slack
+	}
+	return 0
+}
+
+// baselineGrid is the grid of baselines, one title line apart, that the
+// title and URL are drawn on. It starts one title line below TextTopMargin
+// and ends at the last baseline that leaves half of TextTopMargin below it.
+type baselineGrid struct {
+	fontHeight float64
+	// lines is the number of baselines, at least one
+	lines int
+}
+
+// newBaselineGrid returns the grid for a title font of the given height on
+// a card height pixels high. A font height that isn't positive, which
+// Render rules out, gets a single line rather than an endless count.
+func newBaselineGrid(fontHeight float64, height int) baselineGrid {
+	g := baselineGrid{fontHeight: fontHeight, lines: 1}
+	if !(fontHeight > 0) {
+		return g
+	}
+	maxY := float64(height) - TextTopMargin/2.0
+	for g.baseline(g.lines) <= maxY {
+		g.lines++
+	}
+	return g
+}
+
+// baseline returns the y coordinate of grid line i
+func (g baselineGrid) baseline(i int) float64 {
+	return TextTopMargin + float64(i)*g.fontHeight*LineSpacing + g.fontHeight
+}
+
+// urlLine returns the grid line the URL is drawn on: the first, the middle
+// or, by default, the last
+func (g baselineGrid) urlLine(valign string) int {
+	switch valign {
+	case VAlignTop:
+		return 0
+	case VAlignMiddle:
+		return (g.lines - 1) / 2
+	}
+	return g.lines - 1
+}
+
+// titleLines returns the first and last grid lines the title may use: the
+// lines below the URL if it is at the top, and the lines above it
+// otherwise
+func (g baselineGrid) titleLines(urlVAlign string) (first, last int) {
+	url := g.urlLine(urlVAlign)
+	if url == 0 && g.lines > 1 {
+		return 1, g.lines - 1
+	}
+	return 0, url - 1
+}
+
+// placeBlock returns the grid line that the first of n title lines is
+// drawn on, placing them at the top, middle or bottom of the lines from
+// first to last. A block that doesn't fit starts at first.
+func placeBlock(valign string, n, first, last int) int {
+	spare := last - first + 1 - n
+	if spare <= 0 {
+		return first
+	}
+	switch valign {
+	case VAlignMiddle:
+		return first + spare/2
+	case VAlignBottom:
+		return first + spare
+	}
+	return first
+}
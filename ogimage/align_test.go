@@ -0,0 +1,194 @@
+package ogimage
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestAlignOffset(t *testing.T) {
+	tests := []struct {
+		align     string
+		lineWidth float64
+		want      float64
+	}{
+		{"", 600, 0},
+		{AlignLeft, 600, 0},
+		{AlignCenter, 600, 200},
+		{AlignRight, 600, 400},
+		{AlignRight, 1200, 0},
+	}
+
+	for _, tt := range tests {
+		if got := alignOffset(tt.align, 1000, tt.lineWidth); got != tt.want {
+			t.Errorf("alignOffset(%q, 1000, %v) = %v, want %v", tt.align, tt.lineWidth, got, tt.want)
+		}
+	}
+}
+
+func TestBaselineGrid(t *testing.T) {
+	// 40px lines, 60px apart: baselines at 175, 235, ..., 535 on a 628px card
+	g := newBaselineGrid(40, 628)
+	if g.lines != 7 {
+		t.Fatalf("lines = %d, want 7", g.lines)
+	}
+	if got := g.baseline(g.lines - 1); got != 535 {
+		t.Errorf("last baseline = %v, want 535", got)
+	}
+
+	tests := []struct {
+		urlVAlign string
+		wantURL   int
+		wantFirst int
+		wantLast  int
+	}{
+		{"", 6, 0, 5},
+		{VAlignBottom, 6, 0, 5},
+		{VAlignMiddle, 3, 0, 2},
+		{VAlignTop, 0, 1, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run("url "+tt.urlVAlign, func(t *testing.T) {
+			if got := g.urlLine(tt.urlVAlign); got != tt.wantURL {
+				t.Errorf("urlLine() = %d, want %d", got, tt.wantURL)
+			}
+			if first, last := g.titleLines(tt.urlVAlign); first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("titleLines() = %d, %d, want %d, %d", first, last, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+
+	if g := newBaselineGrid(400, 300); g.lines != 1 {
+		t.Errorf("lines = %d for a card too short for one line, want 1", g.lines)
+	}
+	for _, height := range []float64{0, -40, math.NaN()} {
+		if g := newBaselineGrid(height, 628); g.lines != 1 {
+			t.Errorf("lines = %d for a font height of %g, want 1", g.lines, height)
+		}
+	}
+}
+
+func TestPlaceBlock(t *testing.T) {
+	tests := []struct {
+		valign string
+		n      int
+		want   int
+	}{
+		{"", 2, 0},
+		{VAlignTop, 2, 0},
+		{VAlignMiddle, 2, 2},
+		{VAlignMiddle, 3, 2},
+		{VAlignBottom, 2, 5},
+		{VAlignBottom, 9, 0},
+	}
+
+	for _, tt := range tests {
+		if got := placeBlock(tt.valign, tt.n, 0, 6); got != tt.want {
+			t.Errorf("placeBlock(%q, %d, 0, 6) = %d, want %d", tt.valign, tt.n, got, tt.want)
+		}
+	}
+}
+
+// inkBounds returns the bounds of the opaque pixels in img
+func inkBounds(img image.Image) image.Rectangle {
+	var ink image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a > 0 {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return ink
+}
+
+func TestDrawTitleAlignment(t *testing.T) {
+	fontPath := testFontPath(t)
+	colors := testPalette(t)
+	colors.shadow = color.Transparent
+
+	tests := []struct {
+		name   string
+		style  titleStyle
+		inside func(ink image.Rectangle) bool
+	}{
+		{"left", titleStyle{}, func(ink image.Rectangle) bool {
+			return ink.Min.X < int(TextSideMargin)+10 && ink.Max.X < 600
+		}},
+		{"center", titleStyle{align: AlignCenter}, func(ink image.Rectangle) bool {
+			return abs(ink.Min.X+ink.Max.X-1200) < 20
+		}},
+		{"right", titleStyle{align: AlignRight}, func(ink image.Rectangle) bool {
+			return ink.Max.X > 1200-int(TextSideMargin)-10 && ink.Min.X > 600
+		}},
+		{"top", titleStyle{valign: VAlignTop}, func(ink image.Rectangle) bool {
+			return ink.Min.Y < int(TextTopMargin)+20
+		}},
+		{"bottom", titleStyle{valign: VAlignBottom}, func(ink image.Rectangle) bool {
+			return ink.Min.Y > 300
+		}},
+		{"middle", titleStyle{valign: VAlignMiddle}, func(ink image.Rectangle) bool {
+			return ink.Min.Y > 150 && ink.Max.Y < 450
+		}},
+		{"below a top URL", titleStyle{urlVAlign: VAlignTop}, func(ink image.Rectangle) bool {
+			return ink.Min.Y > 200
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(1200, 628)
+			if _, err := drawTitle(dc, &fontCache{}, colors, "Hello World", fontPath, 1200, 628, TitleFontSize, tt.style, image.Rectangle{}); err != nil {
+				t.Fatalf("drawTitle() error: %v", err)
+			}
+			if ink := inkBounds(dc.Image()); !tt.inside(ink) {
+				t.Errorf("title drawn at %v", ink)
+			}
+		})
+	}
+}
+
+func TestDrawURLAlignment(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	tests := []struct {
+		name   string
+		align  string
+		valign string
+		inside func(ink image.Rectangle) bool
+	}{
+		{"bottom left", "", "", func(ink image.Rectangle) bool {
+			return ink.Min.X < int(TextSideMargin)+10 && ink.Min.Y > 450
+		}},
+		{"top right", AlignRight, VAlignTop, func(ink image.Rectangle) bool {
+			return ink.Max.X > 1200-int(TextSideMargin)-10 && ink.Max.Y < 200
+		}},
+		{"middle center", AlignCenter, VAlignMiddle, func(ink image.Rectangle) bool {
+			return abs(ink.Min.X+ink.Max.X-1200) < 20 && ink.Min.Y > 150 && ink.Max.Y < 450
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(1200, 628)
+			if err := drawURL(dc, &fontCache{}, testPalette(t), "https://example.com", fontPath, fontPath, 1200, 628, TitleFontSize, tt.align, tt.valign, tagSet{}, image.Rectangle{}); err != nil {
+				t.Fatalf("drawURL() error: %v", err)
+			}
+			if ink := inkBounds(dc.Image()); !tt.inside(ink) {
+				t.Errorf("URL drawn at %v", ink)
+			}
+		})
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
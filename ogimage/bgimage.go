@@ -0,0 +1,174 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+
+	// Decoders for background images and logos
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/draw"
+)
+
+// Background image fit modes
+const (
+	// FitCover scales the image to cover the whole card, cropping the
+	// overflow equally on both sides
+	FitCover = "cover"
+	// FitContain scales the image to fit inside the card, leaving the
+	// background color visible around it
+	FitContain = "contain"
+	// FitFill stretches the image to the card's size
+	FitFill = "fill"
+)
+
+// backgroundImage is a decoded background image and how to draw it
+type backgroundImage struct {
+	img    image.Image
+	fit    string
+	blur   float64
+	darken float64
+}
+
+// loadBackgroundImage validates the background image options and decodes
+// the image. It returns nil if opts has no background image.
+func loadBackgroundImage(opts Options) (*backgroundImage, error) {
+	if opts.BgImage == "" {
+		return nil, nil
+	}
+
+	switch opts.BgFit {
+	case FitCover, FitContain, FitFill:
+	default:
+		return nil, fmt.Errorf("unknown background fit %q: want %s, %s or %s", opts.BgFit, FitCover, FitContain, FitFill)
+	}
+	if math.IsNaN(opts.BgBlur) {
+		return nil, fmt.Errorf("background blur must be a number")
+	}
+	if opts.BgBlur < 0 {
+		return nil, fmt.Errorf("background blur must not be negative")
+	}
+	if !(opts.BgDarken >= 0 && opts.BgDarken <= 1) {
+		return nil, fmt.Errorf("background darken must be between 0 and 1")
+	}
+
+	img, err := decodeImageFile("background image", opts.BgImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backgroundImage{img: img, fit: opts.BgFit, blur: opts.BgBlur, darken: opts.BgDarken}, nil
+}
+
+// decodeImageFile decodes a PNG, JPEG, GIF or WebP file. GIFs decode to
+// their first frame. kind names the image in errors.
+func decodeImageFile(kind, path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", kind, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s %s: %w", kind, path, err)
+	}
+	return img, nil
+}
+
+// draw scales the image into the card according to its fit mode, then
+// blurs and darkens it
+func (bg *backgroundImage) draw(dc *gg.Context, width, height int) {
+	layer := image.NewRGBA(image.Rect(0, 0, width, height))
+	src := bg.img.Bounds()
+	draw.CatmullRom.Scale(layer, fitRect(src.Dx(), src.Dy(), width, height, bg.fit), bg.img, src, draw.Over, nil)
+
+	if bg.blur > 0 {
+		blurRGBA(layer, bg.blur)
+	}
+	dc.DrawImage(layer, 0, 0)
+
+	if bg.darken > 0 {
+		dc.SetColor(color.NRGBA{0, 0, 0, uint8(math.Round(bg.darken * 255))})
+		dc.DrawRectangle(0, 0, float64(width), float64(height))
+		dc.Fill()
+	}
+}
+
+// fitRect returns where an image of size iw x ih is drawn on a card of
+// size w x h for the given fit mode
+func fitRect(iw, ih, w, h int, fit string) image.Rectangle {
+	if fit == FitFill || iw == 0 || ih == 0 {
+		return image.Rect(0, 0, w, h)
+	}
+
+	sx, sy := float64(w)/float64(iw), float64(h)/float64(ih)
+	scale := math.Max(sx, sy)
+	if fit == FitContain {
+		scale = math.Min(sx, sy)
+	}
+
+	dw := int(math.Round(float64(iw) * scale))
+	dh := int(math.Round(float64(ih) * scale))
+	x := (w - dw) / 2
+	y := (h - dh) / 2
+	return image.Rect(x, y, x+dw, y+dh)
+}
+
+// blurRGBA blurs img in place with three passes of a box blur in each
+// direction, which approximates a Gaussian blur whose standard deviation
+// is radius. Boxes wider than the image average all of it, so the radius
+// is capped at the image's larger side.
+func blurRGBA(img *image.RGBA, radius float64) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	radius = min(radius, float64(max(w, h)))
+
+	// Three boxes of width 2r+1 have a combined variance of (2r+1)²-1)/4
+	r := int(math.Round((math.Sqrt(4*radius*radius+1) - 1) / 2))
+	if r < 1 {
+		r = 1
+	}
+	buf := make([]uint8, len(img.Pix))
+
+	for range 3 {
+		// Rows, then columns
+		boxBlur(img.Pix, buf, w, h, 4, img.Stride, r)
+		boxBlur(buf, img.Pix, h, w, img.Stride, 4, r)
+	}
+}
+
+// boxBlur averages each pixel of src with its r neighbors on either side
+// along one axis and writes the result to dst. Each of the lines has
+// pixels pixels; pixelStep and lineStep are the byte distances between
+// neighboring pixels and lines. Edge pixels repeat beyond the image.
+func boxBlur(src, dst []uint8, pixels, lines, pixelStep, lineStep, r int) {
+	window := float64(2*r + 1)
+
+	for line := range lines {
+		base := line * lineStep
+		for c := range 4 {
+			at := func(i int) float64 {
+				i = max(0, min(pixels-1, i))
+				return float64(src[base+i*pixelStep+c])
+			}
+
+			var sum float64
+			for i := -r; i <= r; i++ {
+				sum += at(i)
+			}
+			for i := range pixels {
+				dst[base+i*pixelStep+c] = uint8(math.Round(sum / window))
+				sum += at(i+r+1) - at(i-r)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ogimage
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// writeTestImage writes a w x h image of a single color to dir in the
+// format named by ext and returns its path
+func writeTestImage(t *testing.T, dir, ext string, w, h int, c color.Color) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, c)
+		}
+	}
+
+	path := filepath.Join(dir, "bg"+ext)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	switch ext {
+	case ".png":
+		err = png.Encode(f, img)
+	case ".jpg":
+		err = jpeg.Encode(f, img, nil)
+	case ".gif":
+		err = gif.Encode(f, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBackgroundImage(t *testing.T) {
+	dir := t.TempDir()
+	red := color.RGBA{255, 0, 0, 255}
+
+	for _, ext := range []string{".png", ".jpg", ".gif"} {
+		t.Run(ext, func(t *testing.T) {
+			path := writeTestImage(t, t.TempDir(), ext, 20, 10, red)
+			bg, err := loadBackgroundImage(Options{BgImage: path, BgFit: FitCover})
+			if err != nil {
+				t.Fatalf("loadBackgroundImage() error: %v", err)
+			}
+			if b := bg.img.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+				t.Errorf("image size = %dx%d, want 20x10", b.Dx(), b.Dy())
+			}
+		})
+	}
+
+	t.Run("no image", func(t *testing.T) {
+		bg, err := loadBackgroundImage(Options{})
+		if bg != nil || err != nil {
+			t.Errorf("loadBackgroundImage() = %v, %v, want nil, nil", bg, err)
+		}
+	})
+
+	path := writeTestImage(t, dir, ".png", 4, 4, red)
+	notImage := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notImage, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{"unknown fit", Options{BgImage: path, BgFit: "tile"}, `unknown background fit "tile"`},
+		{"negative blur", Options{BgImage: path, BgFit: FitCover, BgBlur: -1}, "blur must not be negative"},
+		{"NaN blur", Options{BgImage: path, BgFit: FitCover, BgBlur: math.NaN()}, "blur must be a number"},
+		{"darken out of range", Options{BgImage: path, BgFit: FitCover, BgDarken: 1.5}, "darken must be between 0 and 1"},
+		{"NaN darken", Options{BgImage: path, BgFit: FitCover, BgDarken: math.NaN()}, "darken must be between 0 and 1"},
+		{"missing file", Options{BgImage: filepath.Join(dir, "missing.png"), BgFit: FitCover}, "load background image"},
+		{"not an image", Options{BgImage: notImage, BgFit: FitCover}, "decode background image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadBackgroundImage(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadBackgroundImage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFitRect(t *testing.T) {
+	tests := []struct {
+		name   string
+		iw, ih int
+		fit    string
+		want   image.Rectangle
+	}{
+		{"cover crops wide image", 400, 100, FitCover, image.Rect(-100, 0, 300, 100)},
+		{"cover crops tall image", 100, 400, FitCover, image.Rect(0, -350, 200, 450)},
+		{"contain letterboxes wide image", 400, 100, FitContain, image.Rect(0, 25, 200, 75)},
+		{"contain pillarboxes tall image", 100, 400, FitContain, image.Rect(87, 0, 112, 100)},
+		{"fill stretches", 400, 100, FitFill, image.Rect(0, 0, 200, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitRect(tt.iw, tt.ih, 200, 100, tt.fit); got != tt.want {
+				t.Errorf("fitRect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackgroundImageDraw(t *testing.T) {
+	// Left half white, right half black
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := range 20 {
+		for x := range 20 {
+			src.Set(x, y, color.White)
+		}
+	}
+
+	pixel := func(bg *backgroundImage, x, y int) color.RGBA {
+		dc := gg.NewContext(40, 20)
+		dc.SetColor(color.Black)
+		dc.Clear()
+		bg.draw(dc, 40, 20)
+		return color.RGBAModel.Convert(dc.Image().At(x, y)).(color.RGBA)
+	}
+
+	t.Run("sharp", func(t *testing.T) {
+		bg := &backgroundImage{img: src, fit: FitFill}
+		if got := pixel(bg, 19, 10); got.R != 255 {
+			t.Errorf("pixel left of edge = %v, want white", got)
+		}
+	})
+
+	t.Run("blur softens edges", func(t *testing.T) {
+		bg := &backgroundImage{img: src, fit: FitFill, blur: 4}
+		got := pixel(bg, 19, 10)
+		if got.R == 255 || got.R == 0 {
+			t.Errorf("pixel left of edge = %v, want gray", got)
+		}
+		if far := pixel(bg, 0, 10); far.R < 250 {
+			t.Errorf("pixel far from edge = %v, want white", far)
+		}
+	})
+
+	t.Run("huge blur is capped at the image size", func(t *testing.T) {
+		got := pixel(&backgroundImage{img: src, fit: FitFill, blur: math.Inf(1)}, 0, 10)
+		if want := pixel(&backgroundImage{img: src, fit: FitFill, blur: 40}, 0, 10); got != want {
+			t.Errorf("pixel = %v, want %v as at the largest radius", got, want)
+		}
+	})
+
+	t.Run("darken", func(t *testing.T) {
+		bg := &backgroundImage{img: src, fit: FitFill, darken: 0.5}
+		if got := pixel(bg, 0, 10); colorDistance(got, color.RGBA{127, 127, 127, 255}) > 2 {
+			t.Errorf("darkened white = %v, want about 50%% gray", got)
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package ogimage
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// isRTL reports whether the first strongly directional character of s is
+// right-to-left, as in a Hebrew or Arabic title
+func isRTL(s string) bool {
+	for _, r := range s {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// hasRTL reports whether s has any right-to-left characters
+func hasRTL(s string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool {
+		props, _ := bidi.LookupRune(r)
+		return props.Class() == bidi.R || props.Class() == bidi.AL
+	})
+}
+
+// displayText returns a line as it is drawn left to right: Arabic letters
+// in their joined forms, and the characters in visual order for a line
+// whose paragraph direction is right-to-left if rtl is set
+func displayText(line string, rtl bool) string {
+	return visualOrder(shapeArabic(line), rtl)
+}
+
+// bidiRun is a run of a line in one direction and its embedding level
+type bidiRun struct {
+	text  string
+	level int
+}
+
+// visualOrder reorders a line from logical to visual order with the
+// Unicode bidirectional algorithm, in a paragraph of the given direction.
+// Right-to-left runs are reversed by grapheme, keeping combining marks
+// after their base, and their brackets mirrored. A left-to-right line
+// without right-to-left characters is returned unchanged.
+func visualOrder(line string, rtl bool) string {
+	if !rtl && !hasRTL(line) {
+		return line
+	}
+	var b strings.Builder
+	for _, run := range visualRuns(line, rtl) {
+		if run.level%2 == 1 {
+			b.WriteString(reverseGraphemes(run.text))
+		} else {
+			b.WriteString(run.text)
+		}
+	}
+	return b.String()
+}
+
+// visualRuns splits a line into runs of one direction with the Unicode
+// bidirectional algorithm, in a paragraph of the given direction, and
+// returns them in visual order, left to right. The text of each run stays
+// in logical order.
+func visualRuns(line string, rtl bool) []bidiRun {
+	// A leading mark fixes the paragraph direction
+	mark := "\u200e"
+	if rtl {
+		mark = "\u200f"
+	}
+	var p bidi.Paragraph
+	if _, err := p.SetString(mark + line); err != nil {
+		return []bidiRun{{text: line}}
+	}
+	o, err := p.Order()
+	if err != nil {
+		return []bidiRun{{text: line}}
+	}
+
+	// The ordering only tells runs apart by direction, so the levels are
+	// rebuilt: right-to-left runs are level 1, and left-to-right runs are
+	// level 2 inside right-to-left text. In a left-to-right paragraph that
+	// is only a run of numbers after right-to-left text.
+	runs := make([]bidiRun, 0, o.NumRuns())
+	for i := range o.NumRuns() {
+		r := o.Run(i)
+		run := bidiRun{text: r.String(), level: 0}
+		if i == 0 {
+			run.text = strings.TrimPrefix(run.text, mark)
+		}
+		switch {
+		case r.Direction() == bidi.RightToLeft:
+			run.level = 1
+		case rtl:
+			run.level = 2
+		case len(runs) > 0 && runs[len(runs)-1].level == 1 && !strings.ContainsFunc(run.text, unicode.IsLetter):
+			run.level = 2
+		}
+		if run.text != "" {
+			runs = append(runs, run)
+		}
+	}
+
+	// From the highest level down to 1, reverse every sequence of runs at
+	// that level or above
+	for level := 2; level >= 1; level-- {
+		for i := 0; i < len(runs); {
+			if runs[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runs) && runs[j].level >= level {
+				j++
+			}
+			slices.Reverse(runs[i:j])
+			i = j
+		}
+	}
+	return runs
+}
+
+// reverseGraphemes reverses s, keeping combining marks after the
+// character they modify and mirroring brackets
+func reverseGraphemes(s string) string {
+	var clusters []string
+	for _, r := range s {
+		if len(clusters) > 0 && unicode.In(r, unicode.Mn, unicode.Me) {
+			clusters[len(clusters)-1] += string(r)
+			continue
+		}
+		clusters = append(clusters, bidi.ReverseString(string(r)))
+	}
+	slices.Reverse(clusters)
+	return strings.Join(clusters, "")
+}
+
+// arabicForms holds the presentation forms of an Arabic letter: isolated,
+// final, initial and medial. Letters that only join to the letter before
+// them have no initial or medial form.
+type arabicForms [4]rune
+
+// arabicLetters maps the Arabic letters, and the extra letters of Persian
+// and Urdu, to their presentation forms
+var arabicLetters = map[rune]arabicForms{
+	'ء': {0xFE80, 0, 0, 0},
+	'آ': {0xFE81, 0xFE82, 0, 0},
+	'أ': {0xFE83, 0xFE84, 0, 0},
+	'ؤ': {0xFE85, 0xFE86, 0, 0},
+	'إ': {0xFE87, 0xFE88, 0, 0},
+	'ئ': {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	'ا': {0xFE8D, 0xFE8E, 0, 0},
+	'ب': {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	'ة': {0xFE93, 0xFE94, 0, 0},
+	'ت': {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	'ث': {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	'ج': {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	'ح': {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	'خ': {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	'د': {0xFEA9, 0xFEAA, 0, 0},
+	'ذ': {0xFEAB, 0xFEAC, 0, 0},
+	'ر': {0xFEAD, 0xFEAE, 0, 0},
+	'ز': {0xFEAF, 0xFEB0, 0, 0},
+	'س': {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	'ش': {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	'ص': {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	'ض': {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	'ط': {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	'ظ': {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	'ع': {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	'غ': {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	'ف': {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	'ق': {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	'ك': {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	'ل': {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	'م': {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	'ن': {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	'ه': {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	'و': {0xFEED, 0xFEEE, 0, 0},
+	'ى': {0xFEEF, 0xFEF0, 0, 0},
+	'ي': {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	'پ': {0xFB56, 0xFB57, 0xFB58, 0xFB59},
+	'چ': {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D},
+	'ژ': {0xFB8A, 0xFB8B, 0, 0},
+	'ک': {0xFB8E, 0xFB8F, 0xFB90, 0xFB91},
+	'گ': {0xFB92, 0xFB93, 0xFB94, 0xFB95},
+	'ی': {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF},
+}
+
+// lamAlef maps the alefs that form a ligature after lam to the isolated
+// and final forms of the ligature
+var lamAlef = map[rune][2]rune{
+	'آ': {0xFEF5, 0xFEF6},
+	'أ': {0xFEF7, 0xFEF8},
+	'إ': {0xFEF9, 0xFEFA},
+	'ا': {0xFEFB, 0xFEFC},
+}
+
+// tatweel is the Arabic joining stroke, which joins on both sides
+const tatweel = 'ـ'
+
+// joinsBefore reports whether r connects to the letter before it
+func joinsBefore(r rune) bool {
+	if r == tatweel {
+		return true
+	}
+	forms, ok := arabicLetters[r]
+	return ok && forms[1] != 0
+}
+
+// joinsAfter reports whether r connects to the letter after it
+func joinsAfter(r rune) bool {
+	if r == tatweel {
+		return true
+	}
+	forms, ok := arabicLetters[r]
+	return ok && forms[2] != 0
+}
+
+// shapeArabic replaces the Arabic letters of s with the presentation forms
+// for their position in a word, and lam followed by alef with their
+// ligature, so that fonts without shaping tables still draw joined
+// script. Combining marks between letters don't break a join. Text
+// without Arabic letters is returned unchanged.
+func shapeArabic(s string) string {
+	if !hasArabic(s) {
+		return s
+	}
+
+	runes := []rune(s)
+	// neighbor returns the nearest rune from i in direction step that is
+	// not a combining mark, or 0
+	neighbor := func(i, step int) rune {
+		for i += step; i >= 0 && i < len(runes); i += step {
+			if !unicode.Is(unicode.Mn, runes[i]) {
+				return runes[i]
+			}
+		}
+		return 0
+	}
+
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicLetters[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+		prev := joinsAfter(neighbor(i, -1))
+
+		if r == 'ل' {
+			if j := i + 1; j < len(runes) {
+				if lig, ok := lamAlef[runes[j]]; ok {
+					if prev {
+						out = append(out, lig[1])
+					} else {
+						out = append(out, lig[0])
+					}
+					i = j
+					continue
+				}
+			}
+		}
+
+		next := forms[2] != 0 && joinsBefore(neighbor(i, 1))
+		switch {
+		case prev && forms[1] != 0 && next:
+			out = append(out, forms[3])
+		case prev && forms[1] != 0:
+			out = append(out, forms[1])
+		case next:
+			out = append(out, forms[2])
+		default:
+			out = append(out, forms[0])
+		}
+	}
+	return string(out)
+}
+
+// hasArabic reports whether s has letters that shapeArabic joins
+func hasArabic(s string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool {
+		_, ok := arabicLetters[r]
+		return ok
+	})
+}
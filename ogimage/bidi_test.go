@@ -0,0 +1,94 @@
+package ogimage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsRTL(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Hello world", false},
+		{"שלום עולם", true},
+		{"مرحبا بالعالم", true},
+		{"2024: שנה טובה", true},
+		{"Go בעברית", false},
+		{"123 !?", false},
+	}
+
+	for _, tt := range tests {
+		if got := isRTL(tt.text); got != tt.want {
+			t.Errorf("isRTL(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		rtl  bool
+		want string
+	}{
+		{"latin unchanged", "Hello (world)", false, "Hello (world)"},
+		{"hebrew paragraph", "שלום עולם", true, "םלוע םולש"},
+		{"hebrew in english", "Say שלום today", false, "Say םולש today"},
+		{"english in hebrew", "אני אוהב Go מאוד", true, "דואמ Go בהוא ינא"},
+		{"numbers in hebrew", "גרסה 1.25 יצאה", true, "האצי 1.25 הסרג"},
+		{"brackets mirrored", "שלום (עולם)", true, "(םלוע) םולש"},
+		{"marks stay on their base", "שָׁלוֹם", true, "םוֹלשָׁ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visualOrder(tt.line, tt.rtl); got != tt.want {
+				t.Errorf("visualOrder(%q, %v) = %q, want %q", tt.line, tt.rtl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"latin unchanged", "Hello", "Hello"},
+		{"isolated", "ب", "ﺏ"},
+		{"initial medial final", "بيت", "ﺑﻴﺖ"},
+		{"non-joining letter breaks the word", "دار", "ﺩﺍﺭ"},
+		{"lam alef ligature", "لا", "ﻻ"},
+		{"final lam alef", "سلام", "ﺳﻼﻡ"},
+		{"marks keep the join", "بَت", "ﺑَﺖ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shapeArabic(tt.text); got != tt.want {
+				t.Errorf("shapeArabic(%q) = %+q, want %+q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderRTLDefaultsToRight(t *testing.T) {
+	fontPath := testFontPath(t)
+	for _, tt := range []struct {
+		title string
+		want  string
+	}{
+		{"Hello world", AlignLeft},
+		{"שלום עולם", AlignRight},
+	} {
+		opts := Options{Title: tt.title, URL: "example.com", TitleFont: fontPath, URLFont: fontPath}.withDefaults()
+		if opts.Align != tt.want || opts.URLAlign != tt.want {
+			t.Errorf("%q: Align, URLAlign = %q, %q, want %q", tt.title, opts.Align, opts.URLAlign, tt.want)
+		}
+		if _, err := NewRenderer().Render(context.Background(), opts); err != nil {
+			t.Errorf("%q: Render() error: %v", tt.title, err)
+		}
+	}
+}
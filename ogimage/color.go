@@ -0,0 +1,439 @@
+package ogimage
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseColor parses a CSS color: #rgb, #rgba, #rrggbb or #rrggbbaa hex,
+// rgb()/rgba(), hsl()/hsla(), or a named color such as "steelblue".
+// The leading # of a hex color may be omitted.
+func ParseColor(s string) (color.NRGBA, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	if value == "" {
+		return color.NRGBA{}, fmt.Errorf("empty color")
+	}
+
+	if c, ok := namedColors[value]; ok {
+		return c, nil
+	}
+
+	if open := strings.IndexByte(value, '('); open > 0 && strings.HasSuffix(value, ")") {
+		name := strings.TrimSpace(value[:open])
+		args, err := colorArgs(value[open+1 : len(value)-1])
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+		}
+
+		var c color.NRGBA
+		switch name {
+		case "rgb", "rgba":
+			c, err = parseRGBFunc(args)
+		case "hsl", "hsla":
+			c, err = parseHSLFunc(args)
+		default:
+			return c, fmt.Errorf("invalid color %q: unknown function %s()", s, name)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid color %q: %w", s, err)
+		}
+		return c, nil
+	}
+
+	c, ok := parseHexColor(value)
+	if !ok {
+		return c, fmt.Errorf("invalid color %q", s)
+	}
+	return c, nil
+}
+
+// parseHexColor parses a #rgb, #rgba, #rrggbb or #rrggbbaa color
+func parseHexColor(hexColor string) (color.NRGBA, bool) {
+	hexColor = strings.TrimPrefix(hexColor, "#")
+
+	// Expand the short forms so each channel has two digits
+	if len(hexColor) == 3 || len(hexColor) == 4 {
+		var long strings.Builder
+		for _, r := range hexColor {
+			long.WriteRune(r)
+			long.WriteRune(r)
+		}
+		hexColor = long.String()
+	}
+	if len(hexColor) == 6 {
+		hexColor += "ff"
+	}
+	if len(hexColor) != 8 {
+		return color.NRGBA{}, false
+	}
+
+	val, err := strconv.ParseUint(hexColor, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+
+	return color.NRGBA{
+		R: uint8(val >> 24),
+		G: uint8(val >> 16),
+		B: uint8(val >> 8),
+		A: uint8(val),
+	}, true
+}
+
+// colorArgs splits the arguments of a color function. Both the legacy comma
+// form, rgba(255, 0, 0, 0.5), and the space form, rgb(255 0 0 / 50%), are
+// accepted. An empty value between commas, or a slash without one alpha
+// after it, is an error rather than skipped.
+func colorArgs(body string) ([]string, error) {
+	if strings.Contains(body, ",") {
+		args := strings.Split(body, ",")
+		for i, arg := range args {
+			args[i] = strings.TrimSpace(arg)
+			if args[i] == "" {
+				return nil, fmt.Errorf("value %d is empty", i+1)
+			}
+		}
+		return args, nil
+	}
+
+	channels, alpha, slash := strings.Cut(body, "/")
+	args := strings.Fields(channels)
+	if slash {
+		a := strings.Fields(alpha)
+		if len(a) != 1 {
+			return nil, fmt.Errorf("/ must be followed by one alpha value")
+		}
+		args = append(args, a[0])
+	}
+	return args, nil
+}
+
+// parseFinite parses a number, rejecting the NaN and infinities that
+// strconv.ParseFloat accepts, as no color, angle or offset can be one
+func parseFinite(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseRGBFunc parses the arguments of rgb() or rgba()
+func parseRGBFunc(args []string) (color.NRGBA, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, fmt.Errorf("rgb() takes 3 or 4 values, got %d", len(args))
+	}
+
+	var channels [3]uint8
+	for i, arg := range args[:3] {
+		v, err := parseChannel(arg)
+		if err != nil {
+			return color.NRGBA{}, err
+		}
+		channels[i] = v
+	}
+
+	alpha, err := parseAlpha(args[3:])
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	return color.NRGBA{R: channels[0], G: channels[1], B: channels[2], A: alpha}, nil
+}
+
+// parseHSLFunc parses the arguments of hsl() or hsla()
+func parseHSLFunc(args []string) (color.NRGBA, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, fmt.Errorf("hsl() takes 3 or 4 values, got %d", len(args))
+	}
+
+	hue, err := parseAngle(args[0])
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("hue: %w", err)
+	}
+	sat, err := parsePercent(args[1])
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	light, err := parsePercent(args[2])
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	alpha, err := parseAlpha(args[3:])
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	r, g, b := hslToRGB(hue, sat, light)
+	return color.NRGBA{R: r, G: g, B: b, A: alpha}, nil
+}
+
+// parseChannel parses an rgb() channel: 0-255 or a percentage
+func parseChannel(arg string) (uint8, error) {
+	if strings.HasSuffix(arg, "%") {
+		p, err := parsePercent(arg)
+		if err != nil {
+			return 0, err
+		}
+		return uint8(math.Round(p * 255)), nil
+	}
+
+	v, ok := parseFinite(arg)
+	if !ok {
+		return 0, fmt.Errorf("%q is not a number", arg)
+	}
+	if v < 0 || v > 255 {
+		return 0, fmt.Errorf("%s is out of range 0-255", arg)
+	}
+	return uint8(math.Round(v)), nil
+}
+
+// parsePercent parses a percentage, with or without the % sign, as a
+// fraction from 0 to 1
+func parsePercent(arg string) (float64, error) {
+	v, ok := parseFinite(strings.TrimSuffix(arg, "%"))
+	if !ok {
+		return 0, fmt.Errorf("%q is not a percentage", arg)
+	}
+	if v < 0 || v > 100 {
+		return 0, fmt.Errorf("%s is out of range 0%%-100%%", arg)
+	}
+	return v / 100, nil
+}
+
+// parseAlpha parses the optional alpha argument: 0-1 or a percentage.
+// A missing alpha is opaque.
+func parseAlpha(args []string) (uint8, error) {
+	if len(args) == 0 {
+		return 255, nil
+	}
+
+	arg := args[0]
+	var a float64
+	if strings.HasSuffix(arg, "%") {
+		p, err := parsePercent(arg)
+		if err != nil {
+			return 0, err
+		}
+		a = p
+	} else {
+		v, ok := parseFinite(arg)
+		if !ok {
+			return 0, fmt.Errorf("alpha %q is not a number", arg)
+		}
+		if v < 0 || v > 1 {
+			return 0, fmt.Errorf("alpha %s is out of range 0-1", arg)
+		}
+		a = v
+	}
+	return uint8(math.Round(a * 255)), nil
+}
+
+// parseAngle parses an angle in degrees, with an optional deg, turn or rad
+// unit, normalized to [0, 360)
+func parseAngle(arg string) (float64, error) {
+	scale := 1.0
+	value := arg
+	switch {
+	case strings.HasSuffix(arg, "deg"):
+		value = strings.TrimSuffix(arg, "deg")
+	case strings.HasSuffix(arg, "turn"):
+		value = strings.TrimSuffix(arg, "turn")
+		scale = 360
+	case strings.HasSuffix(arg, "rad"):
+		value = strings.TrimSuffix(arg, "rad")
+		scale = 180 / math.Pi
+	}
+
+	v, ok := parseFinite(value)
+	if !ok {
+		return 0, fmt.Errorf("%q is not an angle", arg)
+	}
+	h := math.Mod(v*scale, 360)
+	if h < 0 {
+		h += 360
+	}
+	return h, nil
+}
+
+// hslToRGB converts a hue in degrees and saturation and lightness from
+// 0 to 1 to RGB
+func hslToRGB(h, s, l float64) (r, g, b uint8) {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+
+	to8 := func(v float64) uint8 { return uint8(math.Round((v + m) * 255)) }
+	return to8(rf), to8(gf), to8(bf)
+}
+
+// namedColors are the CSS named colors
+var namedColors = map[string]color.NRGBA{
+	"transparent":          {0, 0, 0, 0},
+	"aliceblue":            {240, 248, 255, 255},
+	"antiquewhite":         {250, 235, 215, 255},
+	"aqua":                 {0, 255, 255, 255},
+	"aquamarine":           {127, 255, 212, 255},
+	"azure":                {240, 255, 255, 255},
+	"beige":                {245, 245, 220, 255},
+	"bisque":               {255, 228, 196, 255},
+	"black":                {0, 0, 0, 255},
+	"blanchedalmond":       {255, 235, 205, 255},
+	"blue":                 {0, 0, 255, 255},
+	"blueviolet":           {138, 43, 226, 255},
+	"brown":                {165, 42, 42, 255},
+	"burlywood":            {222, 184, 135, 255},
+	"cadetblue":            {95, 158, 160, 255},
+	"chartreuse":           {127, 255, 0, 255},
+	"chocolate":            {210, 105, 30, 255},
+	"coral":                {255, 127, 80, 255},
+	"cornflowerblue":       {100, 149, 237, 255},
+	"cornsilk":             {255, 248, 220, 255},
+	"crimson":              {220, 20, 60, 255},
+	"cyan":                 {0, 255, 255, 255},
+	"darkblue":             {0, 0, 139, 255},
+	"darkcyan":             {0, 139, 139, 255},
+	"darkgoldenrod":        {184, 134, 11, 255},
+	"darkgray":             {169, 169, 169, 255},
+	"darkgreen":            {0, 100, 0, 255},
+	"darkgrey":             {169, 169, 169, 255},
+	"darkkhaki":            {189, 183, 107, 255},
+	"darkmagenta":          {139, 0, 139, 255},
+	"darkolivegreen":       {85, 107, 47, 255},
+	"darkorange":           {255, 140, 0, 255},
+	"darkorchid":           {153, 50, 204, 255},
+	"darkred":              {139, 0, 0, 255},
+	"darksalmon":           {233, 150, 122, 255},
+	"darkseagreen":         {143, 188, 143, 255},
+	"darkslateblue":        {72, 61, 139, 255},
+	"darkslategray":        {47, 79, 79, 255},
+	"darkslategrey":        {47, 79, 79, 255},
+	"darkturquoise":        {0, 206, 209, 255},
+	"darkviolet":           {148, 0, 211, 255},
+	"deeppink":             {255, 20, 147, 255},
+	"deepskyblue":          {0, 191, 255, 255},
+	"dimgray":              {105, 105, 105, 255},
+	"dimgrey":              {105, 105, 105, 255},
+	"dodgerblue":           {30, 144, 255, 255},
+	"firebrick":            {178, 34, 34, 255},
+	"floralwhite":          {255, 250, 240, 255},
+	"forestgreen":          {34, 139, 34, 255},
+	"fuchsia":              {255, 0, 255, 255},
+	"gainsboro":            {220, 220, 220, 255},
+	"ghostwhite":           {248, 248, 255, 255},
+	"gold":                 {255, 215, 0, 255},
+	"goldenrod":            {218, 165, 32, 255},
+	"gray":                 {128, 128, 128, 255},
+	"green":                {0, 128, 0, 255},
+	"greenyellow":          {173, 255, 47, 255},
+	"grey":                 {128, 128, 128, 255},
+	"honeydew":             {240, 255, 240, 255},
+	"hotpink":              {255, 105, 180, 255},
+	"indianred":            {205, 92, 92, 255},
+	"indigo":               {75, 0, 130, 255},
+	"ivory":                {255, 255, 240, 255},
+	"khaki":                {240, 230, 140, 255},
+	"lavender":             {230, 230, 250, 255},
+	"lavenderblush":        {255, 240, 245, 255},
+	"lawngreen":            {124, 252, 0, 255},
+	"lemonchiffon":         {255, 250, 205, 255},
+	"lightblue":            {173, 216, 230, 255},
+	"lightcoral":           {240, 128, 128, 255},
+	"lightcyan":            {224, 255, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210, 255},
+	"lightgray":            {211, 211, 211, 255},
+	"lightgreen":           {144, 238, 144, 255},
+	"lightgrey":            {211, 211, 211, 255},
+	"lightpink":            {255, 182, 193, 255},
+	"lightsalmon":          {255, 160, 122, 255},
+	"lightseagreen":        {32, 178, 170, 255},
+	"lightskyblue":         {135, 206, 250, 255},
+	"lightslategray":       {119, 136, 153, 255},
+	"lightslategrey":       {119, 136, 153, 255},
+	"lightsteelblue":       {176, 196, 222, 255},
+	"lightyellow":          {255, 255, 224, 255},
+	"lime":                 {0, 255, 0, 255},
+	"limegreen":            {50, 205, 50, 255},
+	"linen":                {250, 240, 230, 255},
+	"magenta":              {255, 0, 255, 255},
+	"maroon":               {128, 0, 0, 255},
+	"mediumaquamarine":     {102, 205, 170, 255},
+	"mediumblue":           {0, 0, 205, 255},
+	"mediumorchid":         {186, 85, 211, 255},
+	"mediumpurple":         {147, 112, 219, 255},
+	"mediumseagreen":       {60, 179, 113, 255},
+	"mediumslateblue":      {123, 104, 238, 255},
+	"mediumspringgreen":    {0, 250, 154, 255},
+	"mediumturquoise":      {72, 209, 204, 255},
+	"mediumvioletred":      {199, 21, 133, 255},
+	"midnightblue":         {25, 25, 112, 255},
+	"mintcream":            {245, 255, 250, 255},
+	"mistyrose":            {255, 228, 225, 255},
+	"moccasin":             {255, 228, 181, 255},
+	"navajowhite":          {255, 222, 173, 255},
+	"navy":                 {0, 0, 128, 255},
+	"oldlace":              {253, 245, 230, 255},
+	"olive":                {128, 128, 0, 255},
+	"olivedrab":            {107, 142, 35, 255},
+	"orange":               {255, 165, 0, 255},
+	"orangered":            {255, 69, 0, 255},
+	"orchid":               {218, 112, 214, 255},
+	"palegoldenrod":        {238, 232, 170, 255},
+	"palegreen":            {152, 251, 152, 255},
+	"paleturquoise":        {175, 238, 238, 255},
+	"palevioletred":        {219, 112, 147, 255},
+	"papayawhip":           {255, 239, 213, 255},
+	"peachpuff":            {255, 218, 185, 255},
+	"peru":                 {205, 133, 63, 255},
+	"pink":                 {255, 192, 203, 255},
+	"plum":                 {221, 160, 221, 255},
+	"powderblue":           {176, 224, 230, 255},
+	"purple":               {128, 0, 128, 255},
+	"rebeccapurple":        {102, 51, 153, 255},
+	"red":                  {255, 0, 0, 255},
+	"rosybrown":            {188, 143, 143, 255},
+	"royalblue":            {65, 105, 225, 255},
+	"saddlebrown":          {139, 69, 19, 255},
+	"salmon":               {250, 128, 114, 255},
+	"sandybrown":           {244, 164, 96, 255},
+	"seagreen":             {46, 139, 87, 255},
+	"seashell":             {255, 245, 238, 255},
+	"sienna":               {160, 82, 45, 255},
+	"silver":               {192, 192, 192, 255},
+	"skyblue":              {135, 206, 235, 255},
+	"slateblue":            {106, 90, 205, 255},
+	"slategray":            {112, 128, 144, 255},
+	"slategrey":            {112, 128, 144, 255},
+	"snow":                 {255, 250, 250, 255},
+	"springgreen":          {0, 255, 127, 255},
+	"steelblue":            {70, 130, 180, 255},
+	"tan":                  {210, 180, 140, 255},
+	"teal":                 {0, 128, 128, 255},
+	"thistle":              {216, 191, 216, 255},
+	"tomato":               {255, 99, 71, 255},
+	"turquoise":            {64, 224, 208, 255},
+	"violet":               {238, 130, 238, 255},
+	"wheat":                {245, 222, 179, 255},
+	"white":                {255, 255, 255, 255},
+	"whitesmoke":           {245, 245, 245, 255},
+	"yellow":               {255, 255, 0, 255},
+	"yellowgreen":          {154, 205, 50, 255},
+}
@@ -0,0 +1,181 @@
+package ogimage
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected color.NRGBA
+	}{
+		{
+			name:     "valid hex color",
+			input:    "#1a1a2e",
+			expected: color.NRGBA{0x1a, 0x1a, 0x2e, 0xff},
+		},
+		{
+			name:     "valid hex without hash",
+			input:    "16a085",
+			expected: color.NRGBA{0x16, 0xa0, 0x85, 0xff},
+		},
+		{
+			name:     "black",
+			input:    "#000000",
+			expected: color.NRGBA{0x00, 0x00, 0x00, 0xff},
+		},
+		{
+			name:     "white",
+			input:    "#ffffff",
+			expected: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		},
+		{
+			name:     "short hex",
+			input:    "#fa0",
+			expected: color.NRGBA{0xff, 0xaa, 0x00, 0xff},
+		},
+		{
+			name:     "short hex with alpha",
+			input:    "#fa08",
+			expected: color.NRGBA{0xff, 0xaa, 0x00, 0x88},
+		},
+		{
+			name:     "hex with alpha",
+			input:    "#e8e8e8dc",
+			expected: color.NRGBA{0xe8, 0xe8, 0xe8, 0xdc},
+		},
+		{
+			name:     "rgb",
+			input:    "rgb(255, 128, 0)",
+			expected: color.NRGBA{255, 128, 0, 255},
+		},
+		{
+			name:     "rgba",
+			input:    "rgba(255, 128, 0, 0.5)",
+			expected: color.NRGBA{255, 128, 0, 128},
+		},
+		{
+			name:     "rgb percentages",
+			input:    "rgb(100%, 50%, 0%)",
+			expected: color.NRGBA{255, 128, 0, 255},
+		},
+		{
+			name:     "rgb space syntax with alpha",
+			input:    "rgb(255 128 0 / 25%)",
+			expected: color.NRGBA{255, 128, 0, 64},
+		},
+		{
+			name:     "hsl",
+			input:    "hsl(120, 100%, 25%)",
+			expected: color.NRGBA{0, 128, 0, 255},
+		},
+		{
+			name:     "hsla with deg",
+			input:    "hsla(240deg, 100%, 50%, 0.5)",
+			expected: color.NRGBA{0, 0, 255, 128},
+		},
+		{
+			name:     "hsl negative hue wraps",
+			input:    "hsl(-120, 100%, 50%)",
+			expected: color.NRGBA{0, 0, 255, 255},
+		},
+		{
+			name:     "hsl turn",
+			input:    "hsl(0.5turn 100% 50%)",
+			expected: color.NRGBA{0, 255, 255, 255},
+		},
+		{
+			name:     "named color",
+			input:    "rebeccapurple",
+			expected: color.NRGBA{102, 51, 153, 255},
+		},
+		{
+			name:     "transparent",
+			input:    "transparent",
+			expected: color.NRGBA{0, 0, 0, 0},
+		},
+		{
+			name:     "surrounding space",
+			input:    "  SteelBlue ",
+			expected: color.NRGBA{70, 130, 180, 255},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseColor(tt.input)
+			if err != nil {
+				t.Fatalf("ParseColor(%q) unexpected error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseColorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"empty string", "", "empty color"},
+		{"wrong length", "#12345", `invalid color "#12345"`},
+		{"non-hex chars", "#gggggg", `invalid color "#gggggg"`},
+		{"unknown name", "bleu", `invalid color "bleu"`},
+		{"unknown function", "cmyk(0, 0, 0, 0)", "unknown function cmyk()"},
+		{"too few values", "rgb(1, 2)", "rgb() takes 3 or 4 values, got 2"},
+		{"channel out of range", "rgb(256, 0, 0)", "256 is out of range 0-255"},
+		{"channel not a number", "rgb(red, 0, 0)", `"red" is not a number`},
+		{"alpha out of range", "rgba(0, 0, 0, 2)", "alpha 2 is out of range 0-1"},
+		{"percent out of range", "hsl(0, 120%, 50%)", "120% is out of range"},
+		{"bad hue", "hsl(red, 50%, 50%)", `hue: "red" is not an angle`},
+		{"NaN channel", "rgb(nan, 0, 0)", `"nan" is not a number`},
+		{"infinite channel", "rgb(inf, 0, 0)", `"inf" is not a number`},
+		{"NaN hue", "hsl(nan, 50%, 50%)", `hue: "nan" is not an angle`},
+		{"infinite hue", "hsl(infdeg, 50%, 50%)", `hue: "infdeg" is not an angle`},
+		{"NaN alpha", "rgba(0, 0, 0, nan)", `alpha "nan" is not a number`},
+		{"NaN percent", "hsl(120, nan%, 50%)", `"nan%" is not a percentage`},
+		{"NaN percent alpha", "rgb(0 0 0 / nan%)", `"nan%" is not a percentage`},
+		{"empty values", "rgb(,,,1,2,3)", "value 1 is empty"},
+		{"trailing comma", "rgb(1, 2, 3,)", "value 4 is empty"},
+		{"slash without alpha", "rgb(1 2 3 /)", "/ must be followed by one alpha value"},
+		{"two alphas", "rgb(1 2 3 / 0.5 1)", "/ must be followed by one alpha value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseColor(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseColor(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseColorCaseInsensitive(t *testing.T) {
+	// Test that color parsing is case-insensitive
+	tests := []struct {
+		input1 string
+		input2 string
+	}{
+		{"#1A1A2E", "#1a1a2e"},
+		{"#FFFFFF", "#ffffff"},
+		{"#AbCdEf", "#abcdef"},
+		{"RGB(1, 2, 3)", "rgb(1, 2, 3)"},
+		{"Navy", "navy"},
+	}
+
+	for _, tt := range tests {
+		c1, err1 := ParseColor(tt.input1)
+		c2, err2 := ParseColor(tt.input2)
+
+		if err1 != nil || err2 != nil || c1 != c2 {
+			t.Errorf("ParseColor should be case-insensitive: %v (%v) != %v (%v)", c1, err1, c2, err2)
+		}
+	}
+}
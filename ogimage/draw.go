@@ -0,0 +1,363 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// drawBackground fills the card with the background color or gradient,
+// draws the background image over it if there is one, and then the
+// translucent overlay panel
+func drawBackground(dc *gg.Context, colors palette, bgImage *backgroundImage, width, height int) {
+	if colors.gradient != nil {
+		dc.SetFillStyle(colors.gradient.pattern(width, height))
+		dc.DrawRectangle(0, 0, float64(width), float64(height))
+		dc.Fill()
+	} else {
+		dc.SetColor(colors.background)
+		dc.Clear()
+	}
+
+	if bgImage != nil {
+		bgImage.draw(dc, width, height)
+	}
+
+	dc.SetColor(colors.overlay)
+	drawRoundedRect(dc, BackgroundMargin, BackgroundMargin, float64(width)-(2*BackgroundMargin), float64(height)-(2*BackgroundMargin), BackgroundCornerRadius, 0)
+	dc.Fill()
+}
+
+// drawRoundedRect draws a rectangle whose top corners are rounded with
+// radius top and bottom corners with radius bottom. A radius of zero
+// leaves those corners square; a pill has both radii at half its height.
+func drawRoundedRect(dc *gg.Context, x, y, w, h, top, bottom float64) {
+	// Start where the bottom-left curve ends, on the left side
+	dc.MoveTo(x, y+h-bottom)
+	// Bottom-left corner
+	corner(dc, x+bottom, y+h-bottom, bottom, 180, 90)
+	// Line to where the bottom-right curve starts
+	dc.LineTo(x+w-bottom, y+h)
+	// Bottom-right corner
+	corner(dc, x+w-bottom, y+h-bottom, bottom, 90, 0)
+	// Line up to where top-right curve starts
+	dc.LineTo(x+w, y+top)
+	// Top-right corner
+	corner(dc, x+w-top, y+top, top, 0, -90)
+	// Line to where top-left curve starts
+	dc.LineTo(x+top, y)
+	// Top-left corner
+	corner(dc, x+top, y+top, top, 270, 180)
+	// Close path back to the start
+	dc.ClosePath()
+}
+
+// corner continues the path with a quarter circle of the given radius
+// around (x, y), between two angles in degrees. A zero radius is the
+// square corner at (x, y).
+func corner(dc *gg.Context, x, y, radius, from, to float64) {
+	if radius <= 0 {
+		dc.LineTo(x, y)
+		return
+	}
+	dc.DrawArc(x, y, radius, gg.Radians(from), gg.Radians(to))
+}
+
+// drawTextWithShadow draws text with a shadow effect at the specified
+// position, in face, the face loaded in dc, in a paragraph that is
+// right-to-left if rtl is set. Color emoji cast no shadow.
+func drawTextWithShadow(dc *gg.Context, face font.Face, colors palette, text string, rtl bool, x, y float64) {
+	// Draw shadow
+	dc.SetColor(colors.shadow)
+	drawText(dc, face, text, rtl, x+ShadowOffset, y+ShadowOffset)
+
+	// Draw text
+	dc.SetColor(colors.text)
+	drawText(dc, face, text, rtl, x, y)
+	drawEmoji(dc, face, text, rtl, x, y)
+}
+
+// titleLayout is the wrapped title and where its lines are drawn
+type titleLayout struct {
+	// x and maxWidth are the column the lines are aligned in
+	x        float64
+	maxWidth float64
+	align    string
+	lines    []string
+	grid     baselineGrid
+	// first is the grid line of the first line, and last the lowest grid
+	// line the title may use without pushing the lines reserved below it
+	// into the URL
+	first, last int
+	// clamped is set if lines were cut to the maximum number of lines
+	clamped bool
+}
+
+// baseline returns the baseline of line i
+func (l titleLayout) baseline(i int) float64 {
+	return l.grid.baseline(l.first + i)
+}
+
+// lineX returns the left edge of line i, measured with dc
+func (l titleLayout) lineX(dc measurer, i int) float64 {
+	lineWidth, _ := dc.MeasureString(l.lines[i])
+	return l.x + alignOffset(l.align, l.maxWidth, lineWidth)
+}
+
+// fits reports whether every line, and the lines reserved below the
+// title, are above the URL's grid line, or above the bottom of the grid if
+// the URL is at the top
+func (l titleLayout) fits() bool {
+	return l.first+len(l.lines)-1 <= l.last
+}
+
+// titleStyle holds the options that change how the title is laid out
+type titleStyle struct {
+	wrap string
+	// maxLines, if positive, is the number of lines the title is cut to
+	maxLines int
+	// hyphenate is the language used to hyphenate words too wide for a line
+	hyphenate string
+	// align and valign place the lines in their column and the block on
+	// the grid; urlVAlign is where the URL is, which the title keeps clear of
+	align     string
+	valign    string
+	urlVAlign string
+	// reserve is the number of grid lines kept below the title for the
+	// subtitle and byline
+	reserve int
+	// fonts, set if the title has inline markup, are the fonts of its
+	// styles, and text measures and draws it at the current size
+	fonts *inlineFonts
+	text  *richText
+	// rtl is set for a right-to-left title, and shape for one in a complex
+	// script, which is measured and drawn shaped in face, the title face
+	// at the current size
+	rtl   bool
+	shape bool
+	face  font.Face
+}
+
+// withSize returns the style with text loaded at size, for a marked-up title
+func (s titleStyle) withSize(dc *gg.Context, fonts *fontCache, size float64) (titleStyle, error) {
+	if s.fonts == nil {
+		return s, nil
+	}
+	text, err := newRichText(dc, fonts, *s.fonts, size)
+	if err != nil {
+		return s, err
+	}
+	text.rtl = s.rtl
+	s.text = text
+	return s, nil
+}
+
+// measurer returns what the title's lines are measured with: the font
+// loaded in dc, or each run's face for a marked-up title
+func (s titleStyle) measurer(dc *gg.Context) measurer {
+	switch {
+	case s.text != nil:
+		return s.text
+	case s.shape:
+		return shapedText{m: dc, face: s.face, rtl: s.rtl}
+	}
+	return dc
+}
+
+// layoutTitle wraps the title in the font loaded in dc, or the faces of its
+// inline styles, to the width of the card, clamps it to style.maxLines
+// lines and places it, followed by style.reserve lines, on the baseline
+// grid. If a wrapped line would run into avoid, the title is wrapped again
+// in a column narrowed to clear it.
+func layoutTitle(dc *gg.Context, title string, width, height int, style titleStyle, avoid image.Rectangle) titleLayout {
+	m := style.measurer(dc)
+	layout := titleLayout{
+		x:        TextSideMargin,
+		maxWidth: float64(width) - (2 * TextSideMargin),
+		align:    style.align,
+		grid:     newBaselineGrid(measureFontHeight(dc), height),
+	}
+	top, bottom := layout.grid.titleLines(style.urlVAlign)
+	layout.last = bottom - style.reserve
+	layout.lines = wrapLines(m, title, layout.maxWidth, style)
+	layout.first = placeBlock(style.valign, len(layout.lines)+style.reserve, top, bottom)
+
+	fontHeight := layout.grid.fontHeight
+	for i, line := range layout.lines {
+		lineWidth, _ := m.MeasureString(line)
+		y := layout.baseline(i)
+		if cx, cw := textColumn(avoid, width, y-fontHeight, y+fontHeight*(LineSpacing-1), lineWidth, style.align); cw != layout.maxWidth {
+			layout.x = cx
+			layout.maxWidth = cw
+			layout.lines = wrapLines(m, title, layout.maxWidth, style)
+			break
+		}
+	}
+
+	if style.maxLines > 0 && len(layout.lines) > style.maxLines {
+		layout.lines = clampLines(m, layout.lines, style.maxLines, layout.maxWidth)
+		layout.clamped = true
+	}
+	layout.first = placeBlock(style.valign, len(layout.lines)+style.reserve, top, bottom)
+	return layout
+}
+
+// drawTitle draws the title laid out by layoutTitle and returns the layout
+func drawTitle(dc *gg.Context, fonts *fontCache, colors palette, title, fontPath string, width, height int, fontSize float64, style titleStyle, avoid image.Rectangle) (titleLayout, error) {
+	face, err := fonts.setFace(dc, fontPath, fontSize)
+	if err != nil {
+		return titleLayout{}, fmt.Errorf("load font: %w", err)
+	}
+	style.face = face
+	style, err = style.withSize(dc, fonts, fontSize)
+	if err != nil {
+		return titleLayout{}, err
+	}
+
+	layout := layoutTitle(dc, title, width, height, style, avoid)
+	for i, line := range layout.lines {
+		x := layout.lineX(style.measurer(dc), i)
+		if style.text != nil {
+			style.text.draw(colors, line, x, layout.baseline(i))
+		} else {
+			drawTextWithShadow(dc, face, colors, line, style.rtl, x, layout.baseline(i))
+		}
+	}
+
+	return layout, nil
+}
+
+// fitTitleSize returns the largest title font size from maxSize down to
+// minSize, in the same steps drawURL shrinks the URL, at which the wrapped
+// title fits on the grid lines left clear of the URL. Lines are not
+// clamped while fitting, so the title shrinks before it is cut. If no size
+// fits it returns minSize.
+func fitTitleSize(dc *gg.Context, fonts *fontCache, title, fontPath string, width, height int, minSize, maxSize float64, style titleStyle, avoid image.Rectangle) (float64, error) {
+	style.maxLines = 0
+
+	for size := maxSize; size > minSize; size -= 2.0 {
+		face, err := fonts.setFace(dc, fontPath, size)
+		if err != nil {
+			return 0, fmt.Errorf("load font: %w", err)
+		}
+		style.face = face
+		sized, err := style.withSize(dc, fonts, size)
+		if err != nil {
+			return 0, err
+		}
+
+		if layoutTitle(dc, title, width, height, sized, avoid).fits() {
+			return size, nil
+		}
+	}
+	return minSize, nil
+}
+
+// drawURL draws the URL on the first, middle or, by default, last line of
+// the title's baseline grid, shrinking the font until the URL fits its
+// column, and aligns it in the column. Tags placed beside the URL follow
+// it on the same baseline. The column is narrowed if the line would run
+// into avoid.
+func drawURL(dc *gg.Context, fonts *fontCache, colors palette, url string, titleFontPath string, urlFontPath string, width, height int, titleFontSize float64, align, valign string, tags tagSet, avoid image.Rectangle) error {
+	face, err := fonts.setFace(dc, urlFontPath, URLFontSize)
+	if err != nil {
+		return fmt.Errorf("load font for url: %w", err)
+	}
+	urlWidth := measureText(dc, face, url, false)
+	urlFontHeight := measureFontHeight(dc)
+
+	// Calculate the baseline grid using the title font metrics
+	titleFontHeight, err := getFontHeight(fonts, titleFontPath, titleFontSize, width, height)
+	if err != nil {
+		return fmt.Errorf("load title font for baseline: %w", err)
+	}
+
+	grid := newBaselineGrid(titleFontHeight, height)
+	targetY := grid.baseline(grid.urlLine(valign))
+
+	// Tags beside the URL take the space it leaves at its largest size,
+	// but at least half the column, and the URL shrinks into the rest
+	var (
+		pills      []pill
+		pillsWidth float64
+		pillsTop   float64
+	)
+	beside := len(tags.labels) > 0 && tags.position == TagsBeside
+	var tagFace font.Face
+	if beside {
+		if tagFace, err = fonts.setFace(dc, tags.fontPath, TagFontSize); err != nil {
+			return fmt.Errorf("load font for tags: %w", err)
+		}
+		pillsTop = targetY - TagPaddingY - measureFontHeight(dc)
+	}
+
+	// Narrow the column by the URL's extent at its largest size, or the
+	// whole line if tags follow it
+	lineWidth := urlWidth
+	if beside {
+		lineWidth = float64(width) - (2 * TextSideMargin)
+	}
+	x, maxWidth := textColumn(avoid, width, targetY-urlFontHeight, targetY+urlFontHeight*(LineSpacing-1), lineWidth, align)
+
+	if beside {
+		pills = tags.rows(shapedText{m: dc, face: tagFace}, max(maxWidth-urlWidth, maxWidth/2)-2*TagGap, 1)[0]
+		pillsWidth = rowWidth(pills) + 2*TagGap
+	}
+
+	// Find the appropriate font size that fits the URL
+	urlFontSize := URLFontSize
+	for urlFontSize >= URLMinFontSize {
+		if face, err = fonts.setFace(dc, urlFontPath, urlFontSize); err != nil {
+			return fmt.Errorf("load font for url: %w", err)
+		}
+
+		if measureText(dc, face, url, false) <= maxWidth-pillsWidth {
+			break
+		}
+		urlFontSize -= 2.0
+	}
+
+	// Ensure font is loaded at final size
+	face, err = fonts.setFace(dc, urlFontPath, urlFontSize)
+	if err != nil {
+		return fmt.Errorf("load font for url: %w", err)
+	}
+
+	textWidth := measureText(dc, face, url, false)
+	left := x + alignOffset(align, maxWidth, textWidth+pillsWidth)
+	dc.SetColor(colors.url)
+	drawText(dc, face, url, false, left, targetY)
+	drawEmoji(dc, face, url, false, left, targetY)
+
+	if beside {
+		face, err := fonts.setFace(dc, tags.fontPath, TagFontSize)
+		if err != nil {
+			return fmt.Errorf("load font for tags: %w", err)
+		}
+		drawPills(dc, face, pills, left+textWidth+2*TagGap, pillsTop)
+	}
+
+	return nil
+}
+
+// drawDebugBaselines draws hairline red lines at each typographic baseline
+func drawDebugBaselines(dc *gg.Context, fontHeight, lineSpacing, textTopMargin float64, width, height int) {
+	dc.SetColor(debugColor)
+	dc.SetLineWidth(2)
+
+	firstBaseline := textTopMargin + fontHeight
+
+	// Draw top margin line
+	dc.DrawLine(0, textTopMargin, float64(width), textTopMargin)
+	dc.Stroke()
+
+	// Draw baselines at each line height interval until we reach the bottom
+	for y := firstBaseline; y < float64(height); y += fontHeight * lineSpacing {
+		roundedY := math.Round(y*2) / 2
+		dc.DrawLine(0, roundedY, float64(width), roundedY)
+		dc.Stroke()
+	}
+}
@@ -0,0 +1,388 @@
+package ogimage
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// testPalette returns the parsed colors of the dark theme
+func testPalette(t *testing.T) palette {
+	t.Helper()
+	colors, err := DarkTheme.palette()
+	if err != nil {
+		t.Fatalf("palette() error: %v", err)
+	}
+	return colors
+}
+
+func TestDrawBackground(t *testing.T) {
+	tests := []struct {
+		name    string
+		bgColor string
+		width   int
+		height  int
+	}{
+		{"default color", "#1a1a2e", 1200, 628},
+		{"white background", "#ffffff", 800, 600},
+		{"red background", "#ff0000", 1920, 1080},
+		{"named color", "steelblue", 1200, 628},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(tt.width, tt.height)
+			// Should not panic
+			theme := DarkTheme
+			theme.Background = tt.bgColor
+			colors, err := theme.palette()
+			if err != nil {
+				t.Fatalf("palette() error: %v", err)
+			}
+			drawBackground(dc, colors, nil, tt.width, tt.height)
+
+			// Verify the context was modified (image should have content)
+			img := dc.Image()
+			if img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+				t.Errorf("unexpected image dimensions: got %dx%d, want %dx%d",
+					img.Bounds().Dx(), img.Bounds().Dy(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestDrawTitle(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	tests := []struct {
+		name    string
+		title   string
+		width   int
+		wantErr bool
+	}{
+		{"simple title", "Hello World", 1200, false},
+		{"long title", "This is a very long title that should wrap across multiple lines in the image", 1200, false},
+		{"unicode title", "日本語タイトル", 1200, false},
+		{"empty title", "", 1200, false},
+		{"narrow width", "Test Title", 200, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(tt.width, 628)
+			_, err := drawTitle(dc, &fontCache{}, testPalette(t), tt.title, fontPath, tt.width, 628, TitleFontSize, titleStyle{}, image.Rectangle{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("drawTitle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("invalid font path", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+		_, err := drawTitle(dc, &fontCache{}, testPalette(t), "Test", "/nonexistent/font.ttf", 1200, 628, TitleFontSize, titleStyle{}, image.Rectangle{})
+		if err == nil {
+			t.Error("expected error for invalid font path")
+		}
+		if !strings.Contains(err.Error(), "load font") {
+			t.Errorf("expected 'load font' error, got: %v", err)
+		}
+	})
+}
+
+func TestDrawURL(t *testing.T) {
+	titleFontPath := testFontPath(t)
+	urlFontPath := testFontPath(t)
+
+	tests := []struct {
+		name    string
+		url     string
+		width   int
+		height  int
+		wantErr bool
+	}{
+		{"simple url", "https://example.com", 1200, 628, false},
+		{"long url", "https://example.com/very/long/path/to/article/that/might/need/smaller/font", 1200, 628, false},
+		{"very long url forces minimum font", "https://example.com/" + strings.Repeat("a", 200), 1200, 628, false},
+		{"narrow width", "https://example.com", 300, 628, false},
+		{"empty url", "", 1200, 628, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(tt.width, tt.height)
+			err := drawURL(dc, &fontCache{}, testPalette(t), tt.url, titleFontPath, urlFontPath, tt.width, tt.height, TitleFontSize, "", "", tagSet{}, image.Rectangle{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("drawURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("invalid font path", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+		err := drawURL(dc, &fontCache{}, testPalette(t), "https://example.com", "/nonexistent/title-font.ttf", "/nonexistent/font.ttf", 1200, 628, TitleFontSize, "", "", tagSet{}, image.Rectangle{})
+		if err == nil {
+			t.Error("expected error for invalid font path")
+		}
+		if !strings.Contains(err.Error(), "load font") {
+			t.Errorf("expected 'load font' error, got: %v", err)
+		}
+	})
+}
+
+func TestDrawURLPositionDynamic(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	// Test that URL is positioned dynamically based on image height
+	// and sits on the baseline grid established by the title font
+	tests := []struct {
+		name   string
+		height int
+	}{
+		{"standard height", 628},
+		{"short height", 400},
+		{"tall height", 1080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(1200, tt.height)
+			err := drawURL(dc, &fontCache{}, testPalette(t), "https://example.com/article", fontPath, fontPath, 1200, tt.height, TitleFontSize, "", "", tagSet{}, image.Rectangle{})
+			if err != nil {
+				t.Fatalf("drawURL() error: %v", err)
+			}
+
+			// Load title font to calculate the baseline grid
+			if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
+				t.Fatalf("failed to load font: %v", err)
+			}
+			titleFontHeight := measureFontHeight(dc)
+
+			// Calculate the baseline grid
+			firstBaseline := TextTopMargin + titleFontHeight
+			baselineStep := titleFontHeight * LineSpacing
+			// URL should not be drawn within TextTopMargin from the bottom
+			maxY := float64(tt.height) - TextTopMargin/2
+
+			// Find the last baseline that fits
+			expectedY := firstBaseline
+			for y := firstBaseline; y <= maxY; y += baselineStep {
+				expectedY = y
+			}
+
+			// Verify the URL baseline is within bounds
+			if expectedY > maxY {
+				t.Errorf("URL baseline %f exceeds max allowed Y %f", expectedY, maxY)
+			}
+
+			// Verify the baseline is on the grid (should be firstBaseline + n*baselineStep)
+			stepsFromFirst := (expectedY - firstBaseline) / baselineStep
+			if stepsFromFirst < 0 {
+				t.Errorf("URL baseline is before first baseline")
+			}
+
+			// The URL should be visible - check for non-background pixels
+			img := dc.Image()
+
+			// Check around the expected baseline position
+			foundURLPixels := false
+			searchStart := int(expectedY) - 30
+			if searchStart < 0 {
+				searchStart = 0
+			}
+			searchEnd := int(expectedY) + 10
+			if searchEnd > tt.height {
+				searchEnd = tt.height
+			}
+
+			for y := searchStart; y < searchEnd; y++ {
+				for x := int(TextSideMargin); x < 400; x++ {
+					r, g, b, a := img.At(x, y).RGBA()
+					// Look for non-transparent, non-black pixels (the muted text color)
+					if a > 0 && (r > 0 || g > 0 || b > 0) {
+						foundURLPixels = true
+						break
+					}
+				}
+				if foundURLPixels {
+					break
+				}
+			}
+
+			if !foundURLPixels {
+				t.Errorf("URL text not found near expected baseline %f (height=%d)", expectedY, tt.height)
+			}
+		})
+	}
+}
+
+func TestDrawURLRespectsBottomMargin(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	// Test that the URL is not drawn within TextTopMargin from the bottom of the image
+	t.Run("URL respects bottom margin equal to TextTopMargin", func(t *testing.T) {
+		width := 1200
+		height := 628
+		dc := gg.NewContext(width, height)
+
+		err := drawURL(dc, &fontCache{}, testPalette(t), "https://example.com/article", fontPath, fontPath, width, height, TitleFontSize, "", "", tagSet{}, image.Rectangle{})
+		if err != nil {
+			t.Fatalf("drawURL() error: %v", err)
+		}
+
+		// Load title font to calculate the baseline grid
+		if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
+			t.Fatalf("failed to load font: %v", err)
+		}
+		titleFontHeight := measureFontHeight(dc)
+
+		// Calculate the baseline grid
+		firstBaseline := TextTopMargin + titleFontHeight
+		baselineStep := titleFontHeight * LineSpacing
+		// The max Y should be height - TextTopMargin (not height - BackgroundMargin)
+		maxY := float64(height) - TextTopMargin
+
+		// Find the last baseline that fits within the margin
+		expectedY := firstBaseline
+		for y := firstBaseline; y <= maxY; y += baselineStep {
+			expectedY = y
+		}
+
+		// The URL baseline should be at least TextTopMargin away from the bottom
+		bottomDistance := float64(height) - expectedY
+		if bottomDistance < TextTopMargin {
+			t.Errorf("URL baseline at y=%f is only %f pixels from bottom (height=%d), should be at least %f",
+				expectedY, bottomDistance, height, TextTopMargin)
+		}
+	})
+}
+
+func TestFitTitleSize(t *testing.T) {
+	fontPath := testFontPath(t)
+	long := "This is a very long title that should wrap across multiple lines in the image and keep going well past the URL"
+
+	tests := []struct {
+		name   string
+		title  string
+		height int
+		want   func(size float64) bool
+	}{
+		{"short title keeps max size", "Hello World", 628, func(size float64) bool { return size == 96 }},
+		{"long title shrinks", long, 628, func(size float64) bool { return size > 24 && size < 96 }},
+		{"title that never fits gets min size", long, 260, func(size float64) bool { return size == 24 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fonts := &fontCache{}
+			dc := gg.NewContext(1200, tt.height)
+			size, err := fitTitleSize(dc, fonts, tt.title, fontPath, 1200, tt.height, 24, 96, titleStyle{}, image.Rectangle{})
+			if err != nil {
+				t.Fatalf("fitTitleSize() error: %v", err)
+			}
+			if !tt.want(size) {
+				t.Errorf("fitTitleSize() = %v", size)
+			}
+		})
+	}
+
+	t.Run("fitted title ends above the URL", func(t *testing.T) {
+		fonts := &fontCache{}
+		dc := gg.NewContext(1200, 628)
+		size, err := fitTitleSize(dc, fonts, long, fontPath, 1200, 628, 24, 96, titleStyle{}, image.Rectangle{})
+		if err != nil {
+			t.Fatalf("fitTitleSize() error: %v", err)
+		}
+		if err := fonts.loadFontFace(dc, fontPath, size); err != nil {
+			t.Fatal(err)
+		}
+		layout := layoutTitle(dc, long, 1200, 628, titleStyle{}, image.Rectangle{})
+		last := layout.baseline(len(layout.lines) - 1)
+		if url := layout.grid.baseline(layout.grid.urlLine("")); last >= url {
+			t.Errorf("last title baseline %v is not above URL baseline %v", last, url)
+		}
+
+		// One step larger would not have fit
+		if err := fonts.loadFontFace(dc, fontPath, size+2); err != nil {
+			t.Fatal(err)
+		}
+		if larger := layoutTitle(dc, long, 1200, 628, titleStyle{}, image.Rectangle{}); larger.fits() {
+			t.Errorf("size %v also fits, want the largest size", size+2)
+		}
+	})
+
+	t.Run("invalid font path", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+		_, err := fitTitleSize(dc, &fontCache{}, "Test", "/nonexistent/font.ttf", 1200, 628, 24, 96, titleStyle{}, image.Rectangle{})
+		if err == nil || !strings.Contains(err.Error(), "load font") {
+			t.Errorf("expected 'load font' error, got: %v", err)
+		}
+	})
+}
+
+func TestDrawDebugBaselines(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("draws baseline at correct position", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+
+		// Load font to get proper metrics
+		if err := dc.LoadFontFace(fontPath, 72); err != nil {
+			t.Fatalf("failed to load font: %v", err)
+		}
+
+		textTopMargin := 90.0
+		lineSpacing := 1.5
+		_, fontHeight := dc.MeasureString("Mg")
+		verticalOffset := fontHeight
+
+		// Calculate expected first baseline position (same as drawTitle)
+		expectedFirstBaseline := textTopMargin + verticalOffset
+
+		// Draw debug baselines
+		drawDebugBaselines(dc, fontHeight, lineSpacing, textTopMargin, 1200, 628)
+
+		// Verify a red pixel exists at the baseline position
+		// Check at x=100 (middle of the line) and y=expectedFirstBaseline
+		img := dc.Image()
+		r, g, b, _ := img.At(100, int(expectedFirstBaseline)).RGBA()
+
+		// Red should be high, green and blue should be low
+		if r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+			t.Errorf("expected red pixel at baseline y=%d, got RGBA(%d, %d, %d, _)",
+				int(expectedFirstBaseline), r>>8, g>>8, b>>8)
+		}
+	})
+
+	t.Run("draws multiple baselines at line height intervals", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+
+		if err := dc.LoadFontFace(fontPath, 72); err != nil {
+			t.Fatalf("failed to load font: %v", err)
+		}
+
+		textTopMargin := 90.0
+		lineSpacing := 1.5
+		_, fontHeight := dc.MeasureString("Mg")
+		verticalOffset := fontHeight
+
+		drawDebugBaselines(dc, fontHeight, lineSpacing, textTopMargin, 1200, 628)
+
+		img := dc.Image()
+
+		// Check first baseline
+		firstBaseline := textTopMargin + verticalOffset
+		r1, g1, b1, _ := img.At(100, int(firstBaseline)).RGBA()
+		if r1>>8 < 200 || g1>>8 > 50 || b1>>8 > 50 {
+			t.Errorf("expected red pixel at first baseline y=%d", int(firstBaseline))
+		}
+
+		// Check second baseline (one line height * spacing down)
+		secondBaseline := firstBaseline + fontHeight*lineSpacing
+		r2, g2, b2, _ := img.At(100, int(secondBaseline)).RGBA()
+		if r2>>8 < 200 || g2>>8 > 50 || b2>>8 > 50 {
+			t.Errorf("expected red pixel at second baseline y=%d", int(secondBaseline))
+		}
+	})
+}
@@ -0,0 +1,452 @@
+package ogimage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+	"sync"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Characters that join and select emoji. A color emoji font claims them so
+// they take no space, though sequences are drawn as their parts.
+const (
+	zeroWidthJoiner   = '\u200d'
+	emojiPresentation = '\ufe0f'
+)
+
+// emojiFont is a color emoji font whose glyphs are PNG images, stored in
+// CBDT and CBLC tables as in Noto Color Emoji, or in an sbix table as in
+// Apple Color Emoji. The outline loader only draws outlines, so these fonts are read
+// here and their images drawn over the text by drawEmoji.
+type emojiFont struct {
+	glyphs  map[rune]uint16
+	strikes []emojiStrike
+
+	mu     sync.Mutex
+	images map[[2]int]*emojiGlyph
+}
+
+// emojiStrike is the set of glyph images drawn for one size, in pixels per
+// em. image returns the PNG data of a glyph and where it is drawn.
+type emojiStrike struct {
+	ppem  int
+	image func(g uint16) (data []byte, metrics emojiGlyph, ok bool)
+}
+
+// emojiGlyph is the image of an emoji and, in pixels of its strike, the
+// offset of its top left corner from the pen position on the baseline and
+// the advance after it. If fromBottom is set, y is the offset of the bottom
+// left corner, up from the baseline, until the image is decoded.
+type emojiGlyph struct {
+	img        image.Image
+	x, y       float64
+	advance    float64
+	fromBottom bool
+}
+
+// has reports whether the font has a glyph for r
+func (f *emojiFont) has(r rune) bool {
+	_, ok := f.glyphs[r]
+	return ok || r == zeroWidthJoiner || r == emojiPresentation
+}
+
+// strike returns the index of the strike to scale to points: the smallest
+// that is at least as large, or else the largest
+func (f *emojiFont) strike(points float64) int {
+	best := 0
+	for i, s := range f.strikes {
+		b := f.strikes[best]
+		switch {
+		case float64(b.ppem) < points && s.ppem > b.ppem:
+			best = i
+		case float64(s.ppem) >= points && s.ppem < b.ppem:
+			best = i
+		}
+	}
+	return best
+}
+
+// glyph returns the decoded image of r in strike i, or nil if it has none
+func (f *emojiFont) glyph(i int, r rune) *emojiGlyph {
+	g, ok := f.glyphs[r]
+	if !ok || i >= len(f.strikes) {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := [2]int{i, int(g)}
+	if img, ok := f.images[key]; ok {
+		return img
+	}
+
+	var glyph *emojiGlyph
+	if data, metrics, ok := f.strikes[i].image(g); ok {
+		if img, err := png.Decode(bytes.NewReader(data)); err == nil {
+			metrics.img = img
+			if metrics.fromBottom {
+				metrics.y = -metrics.y - float64(img.Bounds().Dy())
+				metrics.fromBottom = false
+			}
+			glyph = &metrics
+		}
+	}
+	if f.images == nil {
+		f.images = make(map[[2]int]*emojiGlyph)
+	}
+	f.images[key] = glyph
+	return glyph
+}
+
+// newFace returns a face drawing the font at points
+func (f *emojiFont) newFace(points float64) (font.Face, error) {
+	return &emojiFace{font: f, points: points, strike: f.strike(points), scaled: make(map[rune]*image.RGBA)}, nil
+}
+
+// emojiFace measures the emoji of an emojiFont at a size and leaves their
+// glyphs blank, for drawEmoji to draw the images over
+type emojiFace struct {
+	font   *emojiFont
+	points float64
+	strike int
+	scaled map[rune]*image.RGBA
+}
+
+// scale returns the size of a pixel of the face's strike in the face
+func (f *emojiFace) scale() float64 {
+	return f.points / float64(f.font.strikes[f.strike].ppem)
+}
+
+// image returns the image of r scaled to the face and where it is drawn
+// from the pen position
+func (f *emojiFace) image(r rune) (img *image.RGBA, x, y float64, ok bool) {
+	g := f.font.glyph(f.strike, r)
+	if g == nil {
+		return nil, 0, 0, false
+	}
+	s := f.scale()
+	img, ok = f.scaled[r]
+	if !ok {
+		b := g.img.Bounds()
+		w := max(1, int(math.Round(float64(b.Dx())*s)))
+		h := max(1, int(math.Round(float64(b.Dy())*s)))
+		img = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(img, img.Bounds(), g.img, b, draw.Src, nil)
+		f.scaled[r] = img
+	}
+	return img, g.x * s, g.y * s, true
+}
+
+func (f *emojiFace) Close() error { return nil }
+
+func (f *emojiFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	advance, _ := f.GlyphAdvance(r)
+	return image.Rectangle{}, image.Transparent, image.Point{}, advance, true
+}
+
+func (f *emojiFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	advance, _ := f.GlyphAdvance(r)
+	img, x, y, ok := f.image(r)
+	if !ok {
+		return fixed.Rectangle26_6{}, advance, true
+	}
+	b := img.Bounds()
+	return fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: fixed26(x), Y: fixed26(y)},
+		Max: fixed.Point26_6{X: fixed26(x + float64(b.Dx())), Y: fixed26(y + float64(b.Dy()))},
+	}, advance, true
+}
+
+func (f *emojiFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	g := f.font.glyph(f.strike, r)
+	if g == nil {
+		return 0, true
+	}
+	return fixed26(g.advance * f.scale()), true
+}
+
+func (f *emojiFace) Kern(r0, r1 rune) fixed.Int26_6 { return 0 }
+
+func (f *emojiFace) Metrics() font.Metrics {
+	return font.Metrics{
+		Height:  fixed26(f.points * 1.2),
+		Ascent:  fixed26(f.points * 0.95),
+		Descent: fixed26(f.points * 0.25),
+	}
+}
+
+// fixed26 converts pixels to a 26.6 fixed point value
+func fixed26(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(v * 64))
+}
+
+// drawEmoji draws the color emoji of s, as drawText draws it from x on
+// baseline y in face, over the blank glyphs it left for them. Text without
+// emoji, or a face without an emoji font, draws nothing.
+func drawEmoji(dc *gg.Context, face font.Face, s string, rtl bool, x, y float64) {
+	if line, ok := shapeLine(face, s, rtl); ok {
+		for _, g := range line.glyphs {
+			if g.emoji == nil {
+				continue
+			}
+			if img, dx, dy, ok := g.emoji.image(g.r); ok {
+				dc.DrawImage(img, int(math.Round(x+g.x+dx)), int(math.Round(y+dy)))
+			}
+		}
+		return
+	}
+	s = displayText(s, rtl)
+	if grid, ok := face.(gridFace); ok {
+		face = grid.Face
+	}
+	emojiFor := func(r rune) *emojiFace {
+		switch f := face.(type) {
+		case *emojiFace:
+			return f
+		case fallbackFace:
+			e, _ := f.faces[f.pick(r)].(*emojiFace)
+			return e
+		}
+		return nil
+	}
+
+	for i, r := range s {
+		e := emojiFor(r)
+		if e == nil {
+			continue
+		}
+		img, dx, dy, ok := e.image(r)
+		if !ok {
+			continue
+		}
+		w, _ := dc.MeasureString(s[:i])
+		dc.DrawImage(img, int(math.Round(x+w+dx)), int(math.Round(y+dy)))
+	}
+}
+
+// parseEmojiFont reads a color emoji font, or the first font of a
+// collection
+func parseEmojiFont(data []byte) (*emojiFont, error) {
+	tables, err := sfntTables(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &emojiFont{glyphs: parseCmap(tables["cmap"])}
+	if len(f.glyphs) == 0 {
+		return nil, errors.New("no character map")
+	}
+	switch {
+	case tables["CBLC"] != nil && tables["CBDT"] != nil:
+		f.strikes = parseCBLC(tables["CBLC"], tables["CBDT"])
+	case tables["sbix"] != nil:
+		f.strikes = parseSbix(tables)
+	}
+	if len(f.strikes) == 0 {
+		return nil, errors.New("no color bitmap glyphs")
+	}
+	return f, nil
+}
+
+// parseCmap maps characters to glyphs with the Unicode subtable of a cmap
+// table, in format 12 or 4
+func parseCmap(cmap fontTable) map[rune]uint16 {
+	var format4, format12 fontTable
+	for i := range cmap.u16(2) {
+		rec := 4 + 8*i
+		platform, encoding := cmap.u16(rec), cmap.u16(rec+2)
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		sub := cmap[min(cmap.u32(rec+4), len(cmap)):]
+		switch sub.u16(0) {
+		case 4:
+			format4 = sub
+		case 12:
+			format12 = sub
+		}
+	}
+
+	glyphs := make(map[rune]uint16)
+	switch {
+	case format12 != nil:
+		for i := range format12.u32(12) {
+			group := 16 + 12*i
+			start, end, glyph := format12.u32(group), format12.u32(group+4), format12.u32(group+8)
+			if group+12 > len(format12) || end > unicode.MaxRune {
+				break
+			}
+			for c := start; c <= end; c++ {
+				glyphs[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+	case format4 != nil:
+		segX2 := format4.u16(6)
+		for i := 0; i < segX2; i += 2 {
+			end, start := format4.u16(14+i), format4.u16(16+segX2+i)
+			delta := format4.u16(16 + 2*segX2 + i)
+			rangeAt := 16 + 3*segX2 + i
+			rangeOffset := format4.u16(rangeAt)
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				g := (c + delta) & 0xFFFF
+				if rangeOffset != 0 {
+					if g = format4.u16(rangeAt + rangeOffset + 2*(c-start)); g != 0 {
+						g = (g + delta) & 0xFFFF
+					}
+				}
+				if g != 0 {
+					glyphs[rune(c)] = uint16(g)
+				}
+			}
+		}
+	}
+	return glyphs
+}
+
+// cbdtGlyph is where a glyph's data is in a CBDT table, in its image
+// format, and the metrics of an index subtable that holds them for the
+// glyphs of format 19
+type cbdtGlyph struct {
+	format, offset, size int
+	metrics              fontTable
+}
+
+// parseCBLC returns the strikes of a CBLC table whose images are in cbdt
+func parseCBLC(cblc, cbdt fontTable) []emojiStrike {
+	var strikes []emojiStrike
+	for i := range cblc.u32(4) {
+		rec := 8 + 48*i
+		if rec+48 > len(cblc) {
+			break
+		}
+		array := cblc.u32(rec)
+		locs := make(map[uint16]cbdtGlyph)
+		for j := range cblc.u32(rec + 8) {
+			entry := array + 8*j
+			if entry+8 > len(cblc) {
+				break
+			}
+			first, last := cblc.u16(entry), cblc.u16(entry+2)
+			sub := array + cblc.u32(entry+4)
+			indexFormat, format, base := cblc.u16(sub), cblc.u16(sub+2), cblc.u32(sub+4)
+			if last < first || (last-first+1)*2 > len(cblc) {
+				continue
+			}
+			add := func(g, offset, size int, metrics fontTable) {
+				if size > 0 {
+					locs[uint16(g)] = cbdtGlyph{format, base + offset, size, metrics}
+				}
+			}
+			switch indexFormat {
+			case 1, 3:
+				width := 4
+				if indexFormat == 3 {
+					width = 2
+				}
+				at := func(k int) int {
+					if width == 2 {
+						return cblc.u16(sub + 8 + 2*k)
+					}
+					return cblc.u32(sub + 8 + 4*k)
+				}
+				for g := first; g <= last; g++ {
+					add(g, at(g-first), at(g-first+1)-at(g-first), nil)
+				}
+			case 2:
+				size := cblc.u32(sub + 8)
+				for g := first; g <= last; g++ {
+					add(g, size*(g-first), size, cblc.span(sub+12, 8))
+				}
+			case 4:
+				n := cblc.u32(sub + 8)
+				for k := 0; k < n && sub+16+4*k <= len(cblc); k++ {
+					pair := sub + 12 + 4*k
+					add(cblc.u16(pair), cblc.u16(pair+2), cblc.u16(pair+6)-cblc.u16(pair+2), nil)
+				}
+			case 5:
+				size, n := cblc.u32(sub+8), cblc.u32(sub+20)
+				for k := 0; k < n && sub+26+2*k <= len(cblc); k++ {
+					add(cblc.u16(sub+24+2*k), size*k, size, cblc.span(sub+12, 8))
+				}
+			}
+		}
+
+		strikes = append(strikes, emojiStrike{
+			ppem: max(1, cblc.u8(rec+45)),
+			image: func(g uint16) ([]byte, emojiGlyph, bool) {
+				loc, ok := locs[g]
+				if !ok {
+					return nil, emojiGlyph{}, false
+				}
+				d := cbdt.span(loc.offset, loc.size)
+				var metrics fontTable
+				var data int
+				switch loc.format {
+				case 17: // small metrics, then the PNG length and data
+					metrics, data = d, 5
+				case 18: // big metrics
+					metrics, data = d, 8
+				case 19: // metrics in the index subtable
+					metrics, data = loc.metrics, 0
+				default:
+					return nil, emojiGlyph{}, false
+				}
+				png := d.span(data+4, d.u32(data))
+				return png, emojiGlyph{
+					x:       float64(metrics.i8(2)),
+					y:       -float64(metrics.i8(3)),
+					advance: float64(metrics.u8(4)),
+				}, png != nil
+			},
+		})
+	}
+	return strikes
+}
+
+// parseSbix returns the strikes of an sbix table, with the advances from
+// the hmtx table
+func parseSbix(tables map[string]fontTable) []emojiStrike {
+	sbix, hmtx := tables["sbix"], tables["hmtx"]
+	numGlyphs := tables["maxp"].u16(4)
+	unitsPerEm := max(1, tables["head"].u16(18))
+	numMetrics := max(1, tables["hhea"].u16(34))
+	advance := func(g int) int {
+		return hmtx.u16(4 * min(g, numMetrics-1))
+	}
+
+	var strikes []emojiStrike
+	for i := range sbix.u32(4) {
+		if 12+4*i > len(sbix) {
+			break
+		}
+		strike := sbix.u32(8 + 4*i)
+		ppem := max(1, sbix.u16(strike))
+		strikes = append(strikes, emojiStrike{
+			ppem: ppem,
+			image: func(g uint16) ([]byte, emojiGlyph, bool) {
+				if int(g) >= numGlyphs {
+					return nil, emojiGlyph{}, false
+				}
+				start := sbix.u32(strike + 4 + 4*int(g))
+				end := sbix.u32(strike + 8 + 4*int(g))
+				d := sbix.span(strike+start, end-start)
+				if len(d) <= 8 || string(d[4:8]) != "png " {
+					return nil, emojiGlyph{}, false
+				}
+				return d[8:], emojiGlyph{
+					x:          float64(d.i16(0)),
+					y:          float64(d.i16(2)),
+					advance:    float64(advance(int(g))*ppem) / float64(unitsPerEm),
+					fromBottom: true,
+				}, true
+			},
+		})
+	}
+	return strikes
+}
@@ -0,0 +1,222 @@
+package ogimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rocket is the emoji the test fonts have, as glyph 1
+const rocket = '🚀'
+
+// be appends big-endian values to a font table
+type be []byte
+
+func (b be) u8(v int) be  { return append(b, byte(v)) }
+func (b be) u16(v int) be { return binary.BigEndian.AppendUint16(b, uint16(v)) }
+func (b be) u32(v int) be { return binary.BigEndian.AppendUint32(b, uint32(v)) }
+
+// buildFont assembles tables into a TrueType font file
+func buildFont(tables map[string][]byte) []byte {
+	t := make(map[string]fontTable, len(tables))
+	for tag, data := range tables {
+		t[tag] = data
+	}
+	return writeSfnt(0x00010000, t)
+}
+
+// testCmap maps the rocket to glyph 1 in a format 12 subtable
+func testCmap() []byte {
+	return be{}.u16(0).u16(1).u16(3).u16(10).u32(12).
+		u16(12).u16(0).u32(28).u32(0).u32(1).
+		u32(rocket).u32(rocket).u32(1)
+}
+
+// testEmojiPNG is a 16 pixel square of solid green
+func testEmojiPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			img.Set(x, y, color.RGBA{0, 255, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testCBDTFont is a font with the rocket as a 16 ppem CBDT image, its top
+// 14 pixels above the baseline and an advance of 18
+func testCBDTFont(t *testing.T) []byte {
+	data := testEmojiPNG(t)
+	glyph := be{}.u8(16).u8(16).u8(0).u8(14).u8(18).u32(len(data))
+	glyph = append(glyph, data...)
+
+	cblc := be{}.u32(0x00030000).u32(1).
+		u32(56).u32(16).u32(1).u32(0)
+	cblc = append(cblc, make([]byte, 24)...)
+	cblc = cblc.u16(1).u16(1).u8(16).u8(16).u8(32).u8(1).
+		u16(1).u16(1).u32(8).
+		u16(1).u16(17).u32(4).u32(0).u32(len(glyph))
+	cbdt := append(be{}.u32(0x00030000), glyph...)
+
+	return buildFont(map[string][]byte{"cmap": testCmap(), "CBLC": cblc, "CBDT": cbdt})
+}
+
+// testSbixFont is testCBDTFont with the image in an sbix table, its bottom
+// 2 pixels below the baseline
+func testSbixFont(t *testing.T) []byte {
+	data := append(be{}.u16(0).u16(-2), "png "...)
+	data = append(data, testEmojiPNG(t)...)
+	sbix := be{}.u16(1).u16(1).u32(1).u32(12).
+		u16(16).u16(72).u32(16).u32(16).u32(16 + len(data))
+	sbix = append(sbix, data...)
+
+	head := make(be, 54)
+	binary.BigEndian.PutUint16(head[18:], 1024)
+	hhea := make(be, 36)
+	binary.BigEndian.PutUint16(hhea[34:], 2)
+	maxp := be{}.u32(0x00005000).u16(2)
+	hmtx := be{}.u16(1024).u16(0).u16(1152).u16(0)
+
+	return buildFont(map[string][]byte{
+		"cmap": testCmap(), "sbix": sbix, "head": head, "hhea": hhea, "maxp": maxp, "hmtx": hmtx,
+	})
+}
+
+func TestParseEmojiFont(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"CBDT", testCBDTFont(t)},
+		{"sbix", testSbixFont(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseEmojiFont(tt.data)
+			if err != nil {
+				t.Fatalf("parseEmojiFont() error: %v", err)
+			}
+			if !f.has(rocket) || !f.has(zeroWidthJoiner) || f.has('a') {
+				t.Errorf("has() is wrong for the rocket, joiner or letter")
+			}
+
+			newFace, err := f.newFace(32)
+			if err != nil {
+				t.Fatalf("newFace() error: %v", err)
+			}
+			face := newFace.(*emojiFace)
+			if advance, _ := face.GlyphAdvance(rocket); advance != fixed26(36) {
+				t.Errorf("advance = %v, want 36 at twice the strike size", advance)
+			}
+			img, x, y, ok := face.image(rocket)
+			if !ok {
+				t.Fatal("image() found no image")
+			}
+			if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 32 || x != 0 || y != -28 {
+				t.Errorf("image() = %v at (%g, %g), want 32x32 at (0, -28)", b, x, y)
+			}
+			if _, _, _, ok := face.image('a'); ok {
+				t.Error("image('a') found an image")
+			}
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"not a font":       []byte("not a font"),
+		"truncated":        testCBDTFont(t)[:40],
+		"no bitmap glyphs": buildFont(map[string][]byte{"cmap": testCmap()}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseEmojiFont(data); err == nil {
+				t.Error("parseEmojiFont() want error")
+			}
+		})
+	}
+}
+
+func TestEmojiStrike(t *testing.T) {
+	f := &emojiFont{strikes: []emojiStrike{{ppem: 64}, {ppem: 20}, {ppem: 136}}}
+	tests := []struct {
+		points float64
+		want   int
+	}{
+		{10, 20},
+		{20, 20},
+		{32, 64},
+		{96, 136},
+		{200, 136},
+	}
+	for _, tt := range tests {
+		if got := f.strikes[f.strike(tt.points)].ppem; got != tt.want {
+			t.Errorf("strike(%g) = %d ppem, want %d", tt.points, got, tt.want)
+		}
+	}
+}
+
+func TestRenderEmoji(t *testing.T) {
+	fontPath := testFontPath(t)
+	emoji := filepath.Join(t.TempDir(), "emoji.ttf")
+	if err := os.WriteFile(emoji, testCBDTFont(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cache fontCache
+	if got, want := cache.chain([]string{fontPath}, []string{emoji}, "Ship it 🚀"), fontChain(fontPath, emoji); got != want {
+		t.Errorf("chain() = %q, want %q", splitFontChain(got), splitFontChain(want))
+	}
+
+	// green counts the pixels of the test emoji
+	green := func(title string, tags []string) int {
+		t.Helper()
+		r := &Renderer{FallbackFonts: []string{emoji}}
+		img, err := r.Render(context.Background(), Options{
+			Title:     title,
+			URL:       "example.com",
+			Tags:      tags,
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			Theme:     Theme{Background: "#000000", Overlay: "#000000", OverlayOpacity: 1},
+		})
+		if err != nil {
+			t.Fatalf("Render() error: %v", err)
+		}
+		n := 0
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if r, g, b, _ := img.At(x, y).RGBA(); r == 0 && g == 0xffff && b == 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	if n := green("Ship it", nil); n != 0 {
+		t.Fatalf("%d emoji pixels without emoji", n)
+	}
+	title := green("Ship it 🚀", nil)
+	if title == 0 {
+		t.Error("no emoji drawn in the title")
+	}
+	if n := green("Ship it 🚀", []string{"🚀 launch"}); n <= title {
+		t.Errorf("%d emoji pixels with an emoji tag, want more than %d", n, title)
+	}
+	if n := green("Ship it **🚀**", nil); n == 0 {
+		t.Error("no emoji drawn in a bold run")
+	}
+	if n := green("שלום 🚀", nil); n != title {
+		t.Errorf("%d emoji pixels in a shaped title, want %d", n, title)
+	}
+}
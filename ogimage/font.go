@@ -0,0 +1,407 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontResolver is a function type for resolving font paths. Besides the
+// path, it returns the axis settings, such as wght=800, to load the font
+// at if it is variable, or nil to load it as it is.
+type FontResolver func(customFont string) (path string, axes map[string]float64, err error)
+
+// DefaultSystemFontPaths contains the default system font paths to search
+var DefaultSystemFontPaths = []string{
+	"/System/Library/Fonts/SFCompact.ttf",
+	"/System/Library/Fonts/SFNSDisplay.ttf",
+	"/System/Library/Fonts/Arial.ttf",
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf",
+	"/usr/share/fonts/truetype/liberation/LiberationSans-Bold.ttf",
+	"C:\\Windows\\Fonts\\arial.ttf",
+}
+
+// DefaultFallbackFontPaths contains color emoji fonts and fonts with wide
+// character coverage, tried after DefaultSystemFontPaths for characters the
+// chosen fonts lack
+var DefaultFallbackFontPaths = []string{
+	"/usr/share/fonts/truetype/noto/NotoColorEmoji.ttf",
+	"/System/Library/Fonts/Apple Color Emoji.ttc",
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSans-Bold.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansArabic-Bold.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansHebrew-Bold.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansMath-Regular.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansSymbols-Regular.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansSymbols2-Regular.ttf",
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"C:\\Windows\\Fonts\\seguisym.ttf",
+	"C:\\Windows\\Fonts\\arialuni.ttf",
+}
+
+// ResolveFontPath returns customFont if set, otherwise the bundled
+// fonts/OpenSans-Bold.ttf or the first system font that exists. A
+// customFont that isn't a file, such as "Inter" or "Inter:bold italic", is
+// looked up by family, weight and slant in the fonts of DefaultFontDirs,
+// and a variable font found that way is set to the weight asked for.
+func ResolveFontPath(customFont string) (string, map[string]float64, error) {
+	return resolveFontPathWithPaths(customFont, DefaultSystemFontPaths)
+}
+
+func resolveFontPathWithPaths(customFont string, systemPaths []string) (string, map[string]float64, error) {
+	if isFontFamily(customFont) {
+		return matchFont(customFont, installedFonts())
+	}
+	if customFont != "" {
+		return customFont, nil, nil
+	}
+
+	if paths := existingFontPaths(systemPaths); len(paths) > 0 {
+		return paths[0], nil, nil
+	}
+
+	return "", nil, fmt.Errorf("font file not found at %s and no system fonts found. Please provide a TTF font file in the fonts/ directory", bundledFontPath)
+}
+
+// FallbackFontPaths returns the fonts to fall back on for characters the
+// chosen fonts have no glyph for: those of the bundled font,
+// DefaultSystemFontPaths and DefaultFallbackFontPaths that exist, in order
+func FallbackFontPaths() []string {
+	return existingFontPaths(slices.Concat(DefaultSystemFontPaths, DefaultFallbackFontPaths))
+}
+
+// bundledFontPath is the font shipped in the fonts directory
+var bundledFontPath = filepath.Join("fonts", "OpenSans-Bold.ttf")
+
+// existingFontPaths returns the bundled font, then systemPaths, leaving out
+// those that don't exist
+func existingFontPaths(systemPaths []string) []string {
+	var paths []string
+	for _, p := range append([]string{bundledFontPath}, systemPaths...) {
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// fontChainSep separates the fonts of a chain. It can't appear in a path.
+const fontChainSep = "\x00"
+
+// fontChain joins font paths into a chain: a single path that fontCache
+// loads as the first font, falling back to the others in order for
+// characters it has no glyph for. A chain of one font is its path.
+func fontChain(paths ...string) string {
+	return strings.Join(paths, fontChainSep)
+}
+
+// splitFontChain returns the font paths of a chain
+func splitFontChain(chain string) []string {
+	return strings.Split(chain, fontChainSep)
+}
+
+// fontCache parses each font file once so that repeated renders only pay for
+// creating faces. Parsed fonts are safe to share between goroutines; faces
+// are not, so a new face is created for every load. The paths it loads may
+// be chains from fontChain, whose fonts may have axis settings from
+// withFontAxes.
+type fontCache struct {
+	mu    sync.Mutex
+	fonts map[string]parsedFont
+}
+
+// parsedFont is a font faces are made from: a TrueType or OpenType font,
+// or a color emoji font
+type parsedFont interface {
+	has(r rune) bool
+	newFace(points float64) (font.Face, error)
+}
+
+// outlineFont is a TrueType or OpenType font with glyph outlines
+type outlineFont struct {
+	*sfnt.Font
+	shaping *shapingFont
+}
+
+func (f outlineFont) has(r rune) bool {
+	g, err := f.GlyphIndex(nil, r)
+	return err == nil && g != 0
+}
+
+func (f outlineFont) newFace(points float64) (font.Face, error) {
+	face, err := opentype.NewFace(f.Font, &opentype.FaceOptions{Size: points, DPI: 72})
+	if err != nil {
+		return nil, err
+	}
+	return &outlineFace{Face: face, font: f, ppem: fixed26(points)}, nil
+}
+
+// outlineFace is an opentype face that, like freetype, draws characters
+// the font has no glyph for as its missing glyph box rather than nothing,
+// and scales kerning to the face size
+type outlineFace struct {
+	font.Face
+	font outlineFont
+	ppem fixed.Int26_6
+	buf  sfnt.Buffer
+}
+
+func (f *outlineFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	dr, mask, maskp, advance, _ := f.Face.Glyph(dot, r)
+	return dr, mask, maskp, advance, mask != nil
+}
+
+func (f *outlineFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	bounds, advance, _ := f.Face.GlyphBounds(r)
+	return bounds, advance, true
+}
+
+func (f *outlineFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	advance, _ := f.Face.GlyphAdvance(r)
+	return advance, true
+}
+
+func (f *outlineFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	g0, err0 := f.font.GlyphIndex(&f.buf, r0)
+	g1, err1 := f.font.GlyphIndex(&f.buf, r1)
+	if err0 != nil || err1 != nil {
+		return 0
+	}
+	kern, err := f.font.Kern(&f.buf, g0, g1, f.ppem, font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return kern
+}
+
+// parsed returns the font at path, reading it on first use
+func (c *fontCache) parsed(path string) (parsedFont, error) {
+	c.mu.Lock()
+	f, ok := c.fonts[path]
+	c.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+
+	f, err := loadFont(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fonts == nil {
+		c.fonts = make(map[string]parsedFont)
+	}
+	c.fonts[path] = f
+	return f, nil
+}
+
+// loadFont reads the font at path: a color emoji font, or else a TrueType
+// or OpenType font, collection or WOFF or WOFF2 web font, made static at
+// the axis settings of the path if it is variable
+func loadFont(path string) (parsedFont, error) {
+	file, axes := splitFontAxes(path)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if e, err := parseEmojiFont(data); err == nil {
+		return e, nil
+	}
+
+	data, err = decodeWebFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(axes) > 0 {
+		if data, err = instantiate(data, axes); err != nil {
+			return nil, fmt.Errorf("%s: variable font: %w", file, err)
+		}
+	}
+	fonts, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	f, err := fonts.Font(0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return outlineFont{f, &shapingFont{data: data}}, nil
+}
+
+// loadFontFace sets the font face of dc to the font at path and size,
+// like gg.Context.LoadFontFace but without re-reading the file
+func (c *fontCache) loadFontFace(dc *gg.Context, path string, points float64) error {
+	_, err := c.setFace(dc, path, points)
+	return err
+}
+
+// setFace is loadFontFace returning the face, for drawEmoji
+func (c *fontCache) setFace(dc *gg.Context, path string, points float64) (font.Face, error) {
+	face, err := c.face(path, points)
+	if err != nil {
+		return nil, err
+	}
+	dc.SetFontFace(face)
+	return face, nil
+}
+
+// face returns a new face of the font at path and size, falling back to
+// the other fonts of a chain for missing glyphs
+func (c *fontCache) face(path string, points float64) (font.Face, error) {
+	var fallback fallbackFace
+	for _, p := range splitFontChain(path) {
+		f, err := c.parsed(p)
+		if err != nil {
+			return nil, err
+		}
+		face, err := f.newFace(points)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		fallback.fonts = append(fallback.fonts, f)
+		fallback.faces = append(fallback.faces, face)
+	}
+	var face font.Face = fallback
+	if len(fallback.faces) == 1 {
+		face = fallback.faces[0]
+	}
+	return gridFace{
+		Face:   face,
+		height: max(fixed.Int26_6(math.Round(points*72/96*64)), 1),
+	}, nil
+}
+
+// chain returns the fonts at paths as a chain, followed by the first of
+// fallbacks with a glyph for each character of texts that none of them
+// has. Fallbacks that can't be parsed are skipped. If one of paths can't
+// be parsed, they are returned without fallbacks, to fail when loaded.
+func (c *fontCache) chain(paths, fallbacks []string, texts ...string) string {
+	var fonts []parsedFont
+	for _, p := range paths {
+		f, err := c.parsed(p)
+		if err != nil {
+			return fontChain(paths...)
+		}
+		fonts = append(fonts, f)
+	}
+
+	has := func(r rune) bool {
+		return slices.ContainsFunc(fonts, func(f parsedFont) bool { return f.has(r) })
+	}
+	for _, text := range texts {
+		// Arabic that isn't shaped is drawn in the presentation forms
+		// shapeArabic picks
+		for _, r := range text + shapeArabic(text) {
+			if unicode.IsSpace(r) || !unicode.IsGraphic(r) || isStyleRune(r) || has(r) {
+				continue
+			}
+			for _, p := range fallbacks {
+				if slices.Contains(paths, p) {
+					continue
+				}
+				if f, err := c.parsed(p); err == nil && f.has(r) {
+					paths = append(paths, p)
+					fonts = append(fonts, f)
+					break
+				}
+			}
+		}
+	}
+	return fontChain(paths...)
+}
+
+// fallbackFace draws each character in the first of its faces whose font
+// has a glyph for it, or in the first face if none has
+type fallbackFace struct {
+	fonts []parsedFont
+	faces []font.Face
+}
+
+// pick returns the index of the face r is drawn in
+func (f fallbackFace) pick(r rune) int {
+	for i, ft := range f.fonts {
+		if ft.has(r) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].Glyph(dot, r)
+}
+
+func (f fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphBounds(r)
+}
+
+func (f fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphAdvance(r)
+}
+
+// Kern kerns pairs of characters drawn in the same face
+func (f fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if i := f.pick(r0); i == f.pick(r1) {
+		return f.faces[i].Kern(r0, r1)
+	}
+	return 0
+}
+
+// Metrics returns the metrics of the first face, which sets the line
+func (f fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+// gridFace reports the same line height that gg.Context.LoadFontFace uses
+// (points * 72 / 96) rather than the font's own metrics, so faces from the
+// cache keep the baseline grid identical to loading the file directly. The
+// height is at least one 64th of a pixel, so that the grid always advances.
+type gridFace struct {
+	font.Face
+	height fixed.Int26_6
+}
+
+func (f gridFace) Metrics() font.Metrics {
+	m := f.Face.Metrics()
+	m.Height = f.height
+	return m
+}
+
+// getFontHeight returns the height of a font at a given size
+func getFontHeight(fonts *fontCache, fontPath string, fontSize float64, width, height int) (float64, error) {
+	tempDc := gg.NewContext(width, height)
+	if err := fonts.loadFontFace(tempDc, fontPath, fontSize); err != nil {
+		return 0, err
+	}
+	return measureFontHeight(tempDc), nil
+}
+
+// measureFontHeight returns the height of the currently loaded font.
+// It uses "Mg" as reference characters to capture both ascenders and descenders.
+func measureFontHeight(dc *gg.Context) float64 {
+	_, height := dc.MeasureString("Mg")
+	return height
+}
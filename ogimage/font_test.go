@@ -0,0 +1,325 @@
+package ogimage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// testFontPath returns a valid font path for testing
+func testFontPath(t *testing.T) string {
+	t.Helper()
+	paths := []string{
+		"/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf",
+		"/usr/share/fonts/truetype/liberation/LiberationSans-Bold.ttf",
+		"/System/Library/Fonts/Arial.ttf",
+		"/System/Library/Fonts/Supplemental/Arial.ttf",
+		"C:\\Windows\\Fonts\\arial.ttf",
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	t.Skip("No system font available for testing")
+	return ""
+}
+
+func TestResolveFontPath(t *testing.T) {
+	t.Run("custom font path provided", func(t *testing.T) {
+		customPath := "/custom/font/path.ttf"
+		result, _, err := ResolveFontPath(customPath)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if result != customPath {
+			t.Errorf("expected %q, got %q", customPath, result)
+		}
+	})
+
+	t.Run("empty path uses system font", func(t *testing.T) {
+		result, _, err := ResolveFontPath("")
+		// Should either find a system font or return an error
+		if err != nil {
+			if !strings.Contains(err.Error(), "font file not found") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		} else {
+			if result == "" {
+				t.Error("expected non-empty font path")
+			}
+		}
+	})
+
+	t.Run("local fonts directory", func(t *testing.T) {
+		// Create a temporary fonts directory with a font file
+		tmpDir := t.TempDir()
+		fontsDir := filepath.Join(tmpDir, "fonts")
+		if err := os.MkdirAll(fontsDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// Create a dummy font file
+		fontFile := filepath.Join(fontsDir, "OpenSans-Bold.ttf")
+		if err := os.WriteFile(fontFile, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Change to the temp directory to test local font resolution
+		oldWd, _ := os.Getwd()
+		defer os.Chdir(oldWd)
+		os.Chdir(tmpDir)
+
+		result, _, err := ResolveFontPath("")
+		if err != nil {
+			t.Errorf("unexpected error when local font exists: %v", err)
+		}
+		if result != filepath.Join("fonts", "OpenSans-Bold.ttf") {
+			t.Errorf("expected local font path, got %q", result)
+		}
+	})
+}
+
+func TestResolveFontPathNoFontsFound(t *testing.T) {
+	// Test the case where no fonts are found
+	// We need to be in a directory without the local fonts folder
+	// and use empty system font paths
+
+	tmpDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	defer os.Chdir(oldWd)
+	os.Chdir(tmpDir)
+
+	// Test with no system fonts available
+	result, _, err := resolveFontPathWithPaths("", []string{})
+	if err == nil {
+		t.Errorf("expected error when no fonts found, got result: %q", result)
+	}
+	if !strings.Contains(err.Error(), "font file not found") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestResolveFontPathWithPaths(t *testing.T) {
+	t.Run("custom font takes precedence", func(t *testing.T) {
+		result, _, err := resolveFontPathWithPaths("/custom/font.ttf", []string{"/system/font.ttf"})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if result != "/custom/font.ttf" {
+			t.Errorf("expected custom font path, got %q", result)
+		}
+	})
+
+	t.Run("finds system font when no custom font", func(t *testing.T) {
+		// Create a temp directory and change to it (no local fonts)
+		tmpDir := t.TempDir()
+		oldWd, _ := os.Getwd()
+		defer os.Chdir(oldWd)
+		os.Chdir(tmpDir)
+
+		// Use actual system font path
+		fontPath := testFontPath(t)
+		result, _, err := resolveFontPathWithPaths("", []string{fontPath})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if result != fontPath {
+			t.Errorf("expected system font path %q, got %q", fontPath, result)
+		}
+	})
+
+	t.Run("searches multiple paths", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		oldWd, _ := os.Getwd()
+		defer os.Chdir(oldWd)
+		os.Chdir(tmpDir)
+
+		fontPath := testFontPath(t)
+		// First path doesn't exist, second does
+		result, _, err := resolveFontPathWithPaths("", []string{"/nonexistent/font.ttf", fontPath})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if result != fontPath {
+			t.Errorf("expected %q, got %q", fontPath, result)
+		}
+	})
+
+	t.Run("local fonts directory takes precedence over system", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		fontsDir := filepath.Join(tmpDir, "fonts")
+		os.MkdirAll(fontsDir, 0755)
+		localFont := filepath.Join(fontsDir, "OpenSans-Bold.ttf")
+		os.WriteFile(localFont, []byte("dummy"), 0644)
+
+		oldWd, _ := os.Getwd()
+		defer os.Chdir(oldWd)
+		os.Chdir(tmpDir)
+
+		systemFont := testFontPath(t)
+		result, _, err := resolveFontPathWithPaths("", []string{systemFont})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		// Should find local font first
+		if result != filepath.Join("fonts", "OpenSans-Bold.ttf") {
+			t.Errorf("expected local font, got %q", result)
+		}
+	})
+}
+
+func TestFontCache(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("parses each font once", func(t *testing.T) {
+		var cache fontCache
+		f1, err := cache.parsed(fontPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f2, err := cache.parsed(fontPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if f1 != f2 {
+			t.Error("expected cached font to be reused")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		var cache fontCache
+		if _, err := cache.parsed("/nonexistent/font.ttf"); err == nil {
+			t.Error("expected error for missing font file")
+		}
+	})
+
+	t.Run("invalid font is not cached", func(t *testing.T) {
+		invalidFontPath := filepath.Join(t.TempDir(), "invalid.ttf")
+		os.WriteFile(invalidFontPath, []byte("not a font"), 0644)
+
+		var cache fontCache
+		if _, err := cache.parsed(invalidFontPath); err == nil {
+			t.Error("expected error for invalid font file")
+		}
+		if _, ok := cache.fonts[invalidFontPath]; ok {
+			t.Error("invalid font should not be cached")
+		}
+	})
+
+	t.Run("face error", func(t *testing.T) {
+		cache := fontCache{fonts: map[string]parsedFont{"broken.ttf": brokenFont{}}}
+		_, err := cache.face(fontChain(fontPath, "broken.ttf"), 40)
+		if err == nil || !strings.Contains(err.Error(), "broken.ttf: no face") {
+			t.Errorf("face() error = %v, want the broken font's error", err)
+		}
+	})
+
+	t.Run("font height matches gg LoadFontFace", func(t *testing.T) {
+		for _, size := range []float64{16, 40, 72, 96} {
+			direct := gg.NewContext(100, 100)
+			if err := direct.LoadFontFace(fontPath, size); err != nil {
+				t.Fatalf("failed to load font: %v", err)
+			}
+
+			cached := gg.NewContext(100, 100)
+			var cache fontCache
+			if err := cache.loadFontFace(cached, fontPath, size); err != nil {
+				t.Fatalf("failed to load font: %v", err)
+			}
+
+			if measureFontHeight(direct) != measureFontHeight(cached) {
+				t.Errorf("size %v: cached height %f, want %f", size, measureFontHeight(cached), measureFontHeight(direct))
+			}
+			directWidth, _ := direct.MeasureString("Hello World")
+			cachedWidth, _ := cached.MeasureString("Hello World")
+			if directWidth != cachedWidth {
+				t.Errorf("size %v: cached width %f, want %f", size, cachedWidth, directWidth)
+			}
+		}
+	})
+}
+
+// brokenFont is a font no face can be made from
+type brokenFont struct{}
+
+func (brokenFont) has(r rune) bool { return true }
+
+func (brokenFont) newFace(points float64) (font.Face, error) {
+	return nil, errors.New("no face")
+}
+
+func TestFontChain(t *testing.T) {
+	mono := "/usr/share/fonts/truetype/dejavu/DejaVuSansMono-Bold.ttf"
+	sans := "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"
+	for _, p := range []string{mono, sans} {
+		if _, err := os.Stat(p); err != nil {
+			t.Skip("DejaVu Sans and Sans Mono are needed for fallback tests")
+		}
+	}
+	invalid := filepath.Join(t.TempDir(), "invalid.ttf")
+	os.WriteFile(invalid, []byte("not a font"), 0644)
+	fallbacks := []string{"/nonexistent/font.ttf", invalid, sans}
+
+	// DejaVu Sans Mono has no glyph for Ǆ
+	tests := []struct {
+		name  string
+		texts []string
+		want  string
+	}{
+		{"nothing missing", []string{"Hello World"}, mono},
+		{"no text", nil, mono},
+		{"missing character", []string{"Hello", "Ǆemal"}, fontChain(mono, sans)},
+		{"character no font has", []string{"你好"}, mono},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cache fontCache
+			if got := cache.chain([]string{mono}, fallbacks, tt.texts...); got != tt.want {
+				t.Errorf("chain() = %q, want %q", splitFontChain(got), splitFontChain(tt.want))
+			}
+		})
+	}
+
+	t.Run("measures each character in its font", func(t *testing.T) {
+		var cache fontCache
+		width := func(path, s string) float64 {
+			dc := gg.NewContext(100, 100)
+			if err := cache.loadFontFace(dc, path, 48); err != nil {
+				t.Fatalf("loadFontFace() error: %v", err)
+			}
+			w, _ := dc.MeasureString(s)
+			return w
+		}
+		chain := fontChain(mono, sans)
+		if got, want := width(chain, "Ǆ"), width(sans, "Ǆ"); got != want {
+			t.Errorf("fallback width = %g, want %g", got, want)
+		}
+		if got, want := width(chain, "mm"), width(mono, "mm"); got != want {
+			t.Errorf("primary width = %g, want %g", got, want)
+		}
+		// Advances are rounded to whole pixels, once per string
+		if got, want := width(chain, "Ǆmm"), width(sans, "Ǆ")+width(mono, "mm"); math.Abs(got-want) > 1 {
+			t.Errorf("mixed width = %g, want %g", got, want)
+		}
+	})
+
+	t.Run("render with a font list", func(t *testing.T) {
+		r := &Renderer{FallbackFonts: []string{}}
+		opts := Options{Title: "Ǆemal", URL: "example.com", TitleFont: mono + ", " + sans, URLFont: mono}
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Errorf("Render() error: %v", err)
+		}
+		opts.TitleFont = mono + ",/nonexistent/font.ttf"
+		if _, err := r.Render(context.Background(), opts); err == nil {
+			t.Error("Render() with a missing font in the list: want error")
+		}
+	})
+}
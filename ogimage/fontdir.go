@@ -0,0 +1,304 @@
+package ogimage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// DefaultFontDirs are the directories ScanFonts searches for installed
+// fonts. A leading ~ stands for the home directory.
+var DefaultFontDirs = []string{
+	"/usr/share/fonts",
+	"/usr/local/share/fonts",
+	"~/.local/share/fonts",
+	"~/.fonts",
+	"~/Library/Fonts",
+	"/Library/Fonts",
+	"/System/Library/Fonts",
+	"C:\\Windows\\Fonts",
+}
+
+// fontExtensions are the file extensions ScanFonts reads, and that mark a
+// font name as a file path rather than a family
+var fontExtensions = []string{".ttf", ".otf", ".ttc", ".otc", ".woff", ".woff2"}
+
+// InstalledFont is a font file found by ScanFonts
+type InstalledFont struct {
+	Path   string
+	Family string
+	// Style is the font's own name for its style, such as "Bold Italic"
+	Style  string
+	Weight int
+	// MinWeight and MaxWeight are the weight range of a variable font, and
+	// both Weight for a static one
+	MinWeight, MaxWeight int
+	Italic               bool
+}
+
+// Name returns the font as it can be given to ResolveFontPath: its family,
+// followed by its weight and slant unless it is a regular or variable font
+func (f InstalledFont) Name() string {
+	var style []string
+	if f.MinWeight == f.MaxWeight && f.Weight != 400 {
+		name := strconv.Itoa(f.Weight)
+		for _, w := range fontWeights {
+			if w.weight == f.Weight {
+				name = w.names[0]
+				break
+			}
+		}
+		style = append(style, name)
+	}
+	if f.Italic {
+		style = append(style, "italic")
+	}
+	if len(style) == 0 {
+		return f.Family
+	}
+	return f.Family + ":" + strings.Join(style, " ")
+}
+
+// fontWeights names the standard weights, the first name of each being the
+// one Name uses
+var fontWeights = []struct {
+	weight int
+	names  []string
+}{
+	{100, []string{"thin", "hairline"}},
+	{200, []string{"extralight", "ultralight"}},
+	{300, []string{"light"}},
+	{400, []string{"regular", "normal", "book"}},
+	{500, []string{"medium"}},
+	{600, []string{"semibold", "demibold"}},
+	{700, []string{"bold"}},
+	{800, []string{"extrabold", "ultrabold"}},
+	{900, []string{"black", "heavy"}},
+}
+
+// ScanFonts returns the fonts in dirs and their subdirectories, sorted by
+// family, weight and slant. Only the first font of a collection is listed,
+// as only it is drawn. Files that aren't fonts are skipped.
+func ScanFonts(dirs []string) []InstalledFont {
+	var fonts []InstalledFont
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if rest, ok := strings.CutPrefix(dir, "~"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			dir = filepath.Join(home, rest)
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || seen[path] || !slices.Contains(fontExtensions, strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+			seen[path] = true
+			if f, err := readInstalledFont(path); err == nil {
+				fonts = append(fonts, f)
+			}
+			return nil
+		})
+	}
+	slices.SortFunc(fonts, func(a, b InstalledFont) int {
+		if c := strings.Compare(strings.ToLower(a.Family), strings.ToLower(b.Family)); c != 0 {
+			return c
+		}
+		if a.Weight != b.Weight {
+			return a.Weight - b.Weight
+		}
+		if a.Italic != b.Italic {
+			if a.Italic {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	return fonts
+}
+
+// readInstalledFont reads the names, weight and slant of a font file,
+// reading only the tables it needs unless the file is a web font
+func readInstalledFont(path string) (InstalledFont, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return InstalledFont{}, err
+	}
+	defer file.Close()
+
+	var r io.ReaderAt = file
+	if strings.HasPrefix(strings.ToLower(filepath.Ext(path)), ".woff") {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return InstalledFont{}, err
+		}
+		if data, err = decodeWebFont(data); err != nil {
+			return InstalledFont{}, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	collection, err := sfnt.ParseCollectionReaderAt(r)
+	if err != nil {
+		return InstalledFont{}, err
+	}
+	f, err := collection.Font(0)
+	if err != nil {
+		return InstalledFont{}, err
+	}
+	name := func(ids ...sfnt.NameID) string {
+		for _, id := range ids {
+			if s, err := f.Name(nil, id); err == nil && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	font := InstalledFont{
+		Path:   path,
+		Family: name(sfnt.NameIDTypographicFamily, sfnt.NameIDFamily),
+		Style:  name(sfnt.NameIDTypographicSubfamily, sfnt.NameIDSubfamily),
+	}
+	if font.Family == "" {
+		return InstalledFont{}, errors.New("font has no family name")
+	}
+
+	// The weight and slant come from the OS/2 table, or failing that from
+	// the style name
+	font.Weight, font.Italic, _ = parseFontStyle(font.Style)
+	tables := readTables(r, "OS/2", "fvar")
+	if os2 := tables["OS/2"]; len(os2) >= 64 {
+		if w := os2.u16(4); w >= 1 && w <= 1000 {
+			font.Weight = w
+		}
+		font.Italic = os2.u16(62)&(1|1<<9) != 0
+	}
+	font.MinWeight, font.MaxWeight = font.Weight, font.Weight
+	for _, axis := range parseFvar(tables["fvar"]) {
+		if axis.tag == "wght" {
+			font.Weight, font.MinWeight, font.MaxWeight = int(axis.def), int(axis.min), int(axis.max)
+		}
+	}
+	return font, nil
+}
+
+// readTables reads the tables with the given tags of the first font in r,
+// leaving out those it doesn't have
+func readTables(r io.ReaderAt, tags ...string) map[string]fontTable {
+	read := func(offset, n int) fontTable {
+		b := make(fontTable, n)
+		if _, err := r.ReadAt(b, int64(offset)); err != nil {
+			return nil
+		}
+		return b
+	}
+	header := read(0, 16)
+	offset := 0
+	if string(header.span(0, 4)) == "ttcf" {
+		offset = header.u32(12)
+		header = read(offset, 12)
+	}
+	n := header.u16(4)
+	dir := read(offset+12, 16*n)
+	tables := make(map[string]fontTable)
+	for i := range n {
+		rec := 16 * i
+		if tag := string(dir.span(rec, 4)); slices.Contains(tags, tag) && dir.u32(rec+12) < 1<<20 {
+			if t := read(dir.u32(rec+8), dir.u32(rec+12)); t != nil {
+				tables[tag] = t
+			}
+		}
+	}
+	return tables
+}
+
+// installedFonts scans DefaultFontDirs once, the first time a font is
+// given by family
+var installedFonts = sync.OnceValue(func() []InstalledFont {
+	return ScanFonts(DefaultFontDirs)
+})
+
+// isFontFamily reports whether a font name is a family, such as
+// "Inter:bold", rather than the path of a font file
+func isFontFamily(name string) bool {
+	if name == "" || strings.ContainsAny(name, `/\`) || slices.Contains(fontExtensions, strings.ToLower(filepath.Ext(name))) {
+		return false
+	}
+	_, err := os.Stat(name)
+	return err != nil
+}
+
+// parseFontStyle parses a style such as "bold", "Semi Bold Italic" or
+// "700 italic" into a weight and slant. An empty style is regular.
+func parseFontStyle(style string) (weight int, italic bool, err error) {
+	s := strings.ToLower(style)
+	for _, sep := range []string{" ", "-", "_", ":"} {
+		s = strings.ReplaceAll(s, sep, "")
+	}
+	for _, slant := range []string{"italic", "oblique"} {
+		if rest, ok := strings.CutSuffix(s, slant); ok {
+			s, italic = rest, true
+		}
+	}
+	if s == "" {
+		return 400, italic, nil
+	}
+	if w, err := strconv.Atoi(s); err == nil && w >= 1 && w <= 1000 {
+		return w, italic, nil
+	}
+	for _, w := range fontWeights {
+		if slices.Contains(w.names, s) {
+			return w.weight, italic, nil
+		}
+	}
+	return 400, italic, fmt.Errorf("unknown font style %q: want a weight such as bold or 700, optionally followed by italic", style)
+}
+
+// matchFont returns the path of the font of fonts that best matches a
+// family name such as "Inter:bold": of the fonts of that family, the one
+// of the wanted slant, then the one nearest the wanted weight, as in CSS.
+// A variable font also gets the weight as its wght axis setting.
+func matchFont(name string, fonts []InstalledFont) (string, map[string]float64, error) {
+	family, style, _ := strings.Cut(name, ":")
+	family = strings.TrimSpace(family)
+	weight, italic, err := parseFontStyle(style)
+	if err != nil {
+		return "", nil, fmt.Errorf("font %q: %w", name, err)
+	}
+
+	distance := func(f InstalledFont) int {
+		d := max(f.MinWeight-weight, weight-f.MaxWeight, 0)
+		if f.Italic != italic {
+			d += 1000
+		}
+		return d
+	}
+	var best *InstalledFont
+	for i, f := range fonts {
+		if !strings.EqualFold(f.Family, family) {
+			continue
+		}
+		if best == nil || distance(f) < distance(*best) {
+			best = &fonts[i]
+		}
+	}
+	if best == nil {
+		return "", nil, fmt.Errorf("font %q not found: no installed font has the family %q", name, family)
+	}
+	if best.MinWeight != best.MaxWeight && weight != best.Weight {
+		return best.Path, map[string]float64{"wght": float64(weight)}, nil
+	}
+	return best.Path, nil, nil
+}
@@ -0,0 +1,146 @@
+package ogimage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testNameTable names a font's family and style for Windows, in UTF-16
+func testNameTable(family, style string) []byte {
+	var strs []byte
+	records := be{}
+	for i, s := range []string{family, style} {
+		var str be
+		for _, u := range utf16.Encode([]rune(s)) {
+			str = str.u16(int(u))
+		}
+		records = records.u16(3).u16(1).u16(0x409).u16(i + 1).u16(len(str)).u16(len(strs))
+		strs = append(strs, str...)
+	}
+	return append(be{}.u16(0).u16(2).u16(6+len(records)), append(records, strs...)...)
+}
+
+func TestScanFonts(t *testing.T) {
+	regular, bold := "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"
+	for _, path := range []string{regular, bold} {
+		if _, err := os.Stat(path); err != nil {
+			t.Skipf("%s not installed", path)
+		}
+	}
+
+	dir := t.TempDir()
+	copyFile := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	read := func(path string) []byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tables, _ := sfntTables(testVariableFont())
+	tables["name"] = testNameTable("Test Variable", "Regular")
+	variable := writeSfnt(0x00010000, tables)
+
+	want := []InstalledFont{
+		{Path: copyFile("dejavu/DejaVuSans.ttf", read(regular)), Family: "DejaVu Sans", Style: "Book", Weight: 400, MinWeight: 400, MaxWeight: 400},
+		{Path: copyFile("DejaVuSans-Bold.woff", encodeWOFF(t, read(bold))), Family: "DejaVu Sans", Style: "Bold", Weight: 700, MinWeight: 700, MaxWeight: 700},
+		{Path: copyFile("variable/Test.TTF", variable), Family: "Test Variable", Style: "Regular", Weight: 400, MinWeight: 100, MaxWeight: 900},
+	}
+	copyFile("broken.ttf", []byte("not a font"))
+	copyFile("README.txt", read(regular))
+
+	got := ScanFonts([]string{filepath.Join(dir, "missing"), dir})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanFonts() = %+v, want %+v", got, want)
+	}
+
+	var names []string
+	for _, f := range got {
+		names = append(names, f.Name())
+	}
+	if want := []string{"DejaVu Sans", "DejaVu Sans:bold", "Test Variable"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Name() = %q, want %q", names, want)
+	}
+}
+
+func TestMatchFont(t *testing.T) {
+	fonts := []InstalledFont{
+		{Path: "inter.ttf", Family: "Inter", Weight: 400, MinWeight: 400, MaxWeight: 400},
+		{Path: "inter-italic.ttf", Family: "Inter", Weight: 400, MinWeight: 400, MaxWeight: 400, Italic: true},
+		{Path: "inter-bold.ttf", Family: "Inter", Weight: 700, MinWeight: 700, MaxWeight: 700},
+		{Path: "flex.ttf", Family: "Roboto Flex", Weight: 400, MinWeight: 100, MaxWeight: 1000},
+	}
+	tests := []struct {
+		name     string
+		want     string
+		wantAxes map[string]float64
+		wantErr  string
+	}{
+		{name: "Inter", want: "inter.ttf"},
+		{name: "inter : Bold", want: "inter-bold.ttf"},
+		{name: "Inter:semi-bold", want: "inter-bold.ttf"},
+		{name: "Inter:500", want: "inter.ttf"},
+		{name: "Inter:italic", want: "inter-italic.ttf"},
+		{name: "Inter:bold italic", want: "inter-italic.ttf"},
+		{name: "Inter:black", want: "inter-bold.ttf"},
+		{name: "Roboto Flex", want: "flex.ttf"},
+		{name: "Roboto Flex:extrabold", want: "flex.ttf", wantAxes: map[string]float64{"wght": 800}},
+		{name: "Helvetica", wantErr: `no installed font has the family "Helvetica"`},
+		{name: "Inter:fat", wantErr: `unknown font style "fat"`},
+		{name: "Inter:1200", wantErr: `unknown font style "1200"`},
+	}
+	for _, tt := range tests {
+		got, axes, err := matchFont(tt.name, fonts)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("matchFont(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || !reflect.DeepEqual(axes, tt.wantAxes) {
+			t.Errorf("matchFont(%q) = %q %v, %v, want %q %v", tt.name, got, axes, err, tt.want, tt.wantAxes)
+		}
+	}
+}
+
+func TestIsFontFamily(t *testing.T) {
+	fontPath := testFontPath(t)
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"", false},
+		{"Inter", true},
+		{"Open Sans:bold italic", true},
+		{"Inter-Bold.ttf", false},
+		{"Inter.WOFF", false},
+		{"fonts/Inter", false},
+		{`C:\Windows\Fonts\arial`, false},
+		{fontPath, false},
+	}
+	for _, tt := range tests {
+		if got := isFontFamily(tt.name); got != tt.want {
+			t.Errorf("isFontFamily(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithFontAxesMerges(t *testing.T) {
+	path := withFontAxes(withFontAxes("font.ttf", map[string]float64{"wght": 700, "wdth": 75}), map[string]float64{"wght": 900})
+	file, axes := splitFontAxes(path)
+	if want := map[string]float64{"wght": 900, "wdth": 75}; file != "font.ttf" || !reflect.DeepEqual(axes, want) {
+		t.Errorf("withFontAxes() = %q %v, want font.ttf %v", file, axes, want)
+	}
+}
@@ -0,0 +1,377 @@
+package ogimage
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// gradient is a parsed linear-gradient() or radial-gradient() background
+type gradient struct {
+	radial bool
+
+	// angle is the direction of a linear gradient in degrees, clockwise
+	// from up as in CSS. For "to <corner>" directions toX and toY are set
+	// instead, since the angle depends on the image's aspect ratio.
+	angle    float64
+	toX, toY float64
+
+	// circle, cx and cy describe a radial gradient: its shape and its
+	// center as fractions of the image size
+	circle bool
+	cx, cy float64
+
+	stops []colorStop
+}
+
+// colorStop is a gradient color at an offset along the gradient, from 0 to 1
+type colorStop struct {
+	color  color.NRGBA
+	offset float64
+}
+
+// isGradient reports whether s is a gradient rather than a plain color
+func isGradient(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "linear-gradient(") || strings.HasPrefix(s, "radial-gradient(")
+}
+
+// ValidateBackground checks that s is a valid background: a CSS color (see
+// ParseColor) or a linear-gradient() or radial-gradient()
+func ValidateBackground(s string) error {
+	if isGradient(s) {
+		_, err := parseGradient(s)
+		return err
+	}
+	_, err := ParseColor(s)
+	return err
+}
+
+// parseGradient parses a CSS linear-gradient() or radial-gradient(), e.g.
+// linear-gradient(135deg, #1a1a2e, #16213e 60%, #0f3460). Radial gradients
+// extend to the farthest corner, as in CSS.
+func parseGradient(s string) (*gradient, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	open := strings.IndexByte(value, '(')
+	if open < 0 || !strings.HasSuffix(value, ")") {
+		return nil, fmt.Errorf("invalid gradient %q", s)
+	}
+
+	g := &gradient{
+		radial: value[:open] == "radial-gradient",
+		angle:  180,
+		cx:     0.5,
+		cy:     0.5,
+	}
+
+	args := splitTopLevel(value[open+1:len(value)-1], ',')
+	if len(args) > 0 {
+		var handled bool
+		var err error
+		if g.radial {
+			handled, err = g.parseRadialShape(args[0])
+		} else {
+			handled, err = g.parseLinearDirection(args[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient %q: %w", s, err)
+		}
+		if handled {
+			args = args[1:]
+		}
+	}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("invalid gradient %q: need at least two color stops", s)
+	}
+	stops, err := parseColorStops(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gradient %q: %w", s, err)
+	}
+	g.stops = stops
+	return g, nil
+}
+
+// parseLinearDirection parses the optional first argument of a linear
+// gradient: an angle or "to <side or corner>". handled is false if arg is
+// a color stop instead.
+func (g *gradient) parseLinearDirection(arg string) (handled bool, err error) {
+	if side, ok := strings.CutPrefix(arg, "to "); ok {
+		for _, word := range strings.Fields(side) {
+			switch word {
+			case "top":
+				g.toY = -1
+			case "bottom":
+				g.toY = 1
+			case "left":
+				g.toX = -1
+			case "right":
+				g.toX = 1
+			default:
+				return true, fmt.Errorf("unknown direction %q", word)
+			}
+		}
+		// A single side is a fixed angle
+		if g.toX == 0 || g.toY == 0 {
+			g.angle = math.Mod(math.Atan2(g.toX, -g.toY)*180/math.Pi+360, 360)
+			g.toX, g.toY = 0, 0
+		}
+		return true, nil
+	}
+
+	if arg == "" || !(arg[0] == '-' || arg[0] == '.' || (arg[0] >= '0' && arg[0] <= '9')) {
+		return false, nil
+	}
+	angle, err := parseAngle(arg)
+	if err != nil {
+		return true, err
+	}
+	g.angle = angle
+	return true, nil
+}
+
+// parseRadialShape parses the optional first argument of a radial
+// gradient: a shape and size and/or "at <position>". handled is false if
+// arg is a color stop instead.
+func (g *gradient) parseRadialShape(arg string) (handled bool, err error) {
+	words := strings.Fields(arg)
+	if len(words) == 0 {
+		return false, nil
+	}
+	switch words[0] {
+	case "circle", "ellipse", "farthest-corner", "at":
+	default:
+		return false, nil
+	}
+
+	for i := 0; i < len(words); i++ {
+		switch words[i] {
+		case "circle":
+			g.circle = true
+		case "ellipse", "farthest-corner":
+		case "at":
+			return true, g.parsePosition(words[i+1:])
+		default:
+			return true, fmt.Errorf("unsupported radial gradient shape %q", words[i])
+		}
+	}
+	return true, nil
+}
+
+// parsePosition parses the center of a radial gradient from keywords
+// (left, center, right, top, bottom) or percentages
+func (g *gradient) parsePosition(words []string) error {
+	if len(words) == 0 || len(words) > 2 {
+		return fmt.Errorf("expected one or two values after \"at\"")
+	}
+
+	var percents []float64
+	for _, word := range words {
+		switch word {
+		case "left":
+			g.cx = 0
+		case "right":
+			g.cx = 1
+		case "top":
+			g.cy = 0
+		case "bottom":
+			g.cy = 1
+		case "center":
+		default:
+			p, err := parsePercent(word)
+			if err != nil || !strings.HasSuffix(word, "%") {
+				return fmt.Errorf("invalid position %q", word)
+			}
+			percents = append(percents, p)
+		}
+	}
+
+	// Percentages are x then y, as in "at 30% 70%"
+	if len(percents) > 0 {
+		g.cx = percents[0]
+	}
+	if len(percents) > 1 {
+		g.cy = percents[1]
+	}
+	return nil
+}
+
+// parseColorStops parses "color [offset%]" stops. Missing offsets are
+// spread evenly between their neighbors, and an offset smaller than an
+// earlier one is raised to match it, as in CSS.
+func parseColorStops(args []string) ([]colorStop, error) {
+	stops := make([]colorStop, len(args))
+	known := make([]bool, len(args))
+
+	for i, arg := range args {
+		words := splitTopLevel(arg, ' ')
+		colorStr := arg
+		if n := len(words); n > 1 && strings.HasSuffix(words[n-1], "%") {
+			offset, ok := parseFinite(strings.TrimSuffix(words[n-1], "%"))
+			if !ok {
+				return nil, fmt.Errorf("invalid stop offset %q", words[n-1])
+			}
+			stops[i].offset = offset / 100
+			known[i] = true
+			colorStr = strings.Join(words[:n-1], " ")
+		}
+
+		c, err := ParseColor(colorStr)
+		if err != nil {
+			return nil, err
+		}
+		stops[i].color = c
+	}
+
+	if !known[0] {
+		stops[0].offset, known[0] = 0, true
+	}
+	last := len(stops) - 1
+	if !known[last] {
+		stops[last].offset, known[last] = 1, true
+	}
+
+	for i := 1; i < len(stops); i++ {
+		if known[i] {
+			stops[i].offset = math.Max(stops[i].offset, stops[i-1].offset)
+			continue
+		}
+		// Spread the run of missing offsets up to the next known one
+		j := i
+		for !known[j] {
+			j++
+		}
+		from, to := stops[i-1].offset, math.Max(stops[j].offset, stops[i-1].offset)
+		for k := i; k < j; k++ {
+			stops[k].offset = from + (to-from)*float64(k-i+1)/float64(j-i+1)
+			known[k] = true
+		}
+	}
+	return stops, nil
+}
+
+// splitTopLevel splits s at sep, ignoring separators inside parentheses,
+// and drops empty parts
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			}
+			if s[i] != sep || depth > 0 {
+				continue
+			}
+		}
+		if part := strings.TrimSpace(s[start:i]); part != "" {
+			parts = append(parts, part)
+		}
+		start = i + 1
+	}
+	return parts
+}
+
+// pattern returns a fill pattern that draws the gradient over an image of
+// the given size
+func (g *gradient) pattern(width, height int) gg.Pattern {
+	w, h := float64(width), float64(height)
+
+	if g.radial {
+		cx, cy := g.cx*w, g.cy*h
+		// Distance from the center to the farthest side on each axis
+		fx, fy := math.Max(cx, w-cx), math.Max(cy, h-cy)
+		rx, ry := fx*math.Sqrt2, fy*math.Sqrt2
+		if g.circle {
+			rx = math.Hypot(fx, fy)
+			ry = rx
+		}
+		return &radialPattern{cx: cx, cy: cy, rx: rx, ry: ry, stops: g.stops}
+	}
+
+	// For "to <corner>" the gradient line is perpendicular to the
+	// diagonal between the other two corners
+	var dx, dy float64
+	if g.toX != 0 && g.toY != 0 {
+		dx, dy = g.toX*h, g.toY*w
+		norm := math.Hypot(dx, dy)
+		dx, dy = dx/norm, dy/norm
+	} else {
+		rad := g.angle * math.Pi / 180
+		dx, dy = math.Sin(rad), -math.Cos(rad)
+	}
+
+	// The gradient line passes through the center and is long enough
+	// for the corners to get the first and last colors
+	length := math.Abs(w*dx) + math.Abs(h*dy)
+	return &linearPattern{
+		x0:    w/2 - dx*length/2,
+		y0:    h/2 - dy*length/2,
+		dx:    dx / length,
+		dy:    dy / length,
+		stops: g.stops,
+	}
+}
+
+// linearPattern is a gg.Pattern for a linear gradient. (dx, dy) is the
+// direction of the gradient line scaled by the inverse of its length.
+type linearPattern struct {
+	x0, y0 float64
+	dx, dy float64
+	stops  []colorStop
+}
+
+func (p *linearPattern) ColorAt(x, y int) color.Color {
+	t := (float64(x)+0.5-p.x0)*p.dx + (float64(y)+0.5-p.y0)*p.dy
+	return stopColorAt(p.stops, t)
+}
+
+// radialPattern is a gg.Pattern for an elliptical or circular gradient
+type radialPattern struct {
+	cx, cy float64
+	rx, ry float64
+	stops  []colorStop
+}
+
+func (p *radialPattern) ColorAt(x, y int) color.Color {
+	t := math.Hypot((float64(x)+0.5-p.cx)/p.rx, (float64(y)+0.5-p.cy)/p.ry)
+	return stopColorAt(p.stops, t)
+}
+
+// stopColorAt interpolates the color at offset t between the stops.
+// Colors are mixed premultiplied, as in CSS, so fading to transparent does
+// not darken.
+func stopColorAt(stops []colorStop, t float64) color.Color {
+	if t <= stops[0].offset {
+		return stops[0].color
+	}
+	last := stops[len(stops)-1]
+	if t >= last.offset {
+		return last.color
+	}
+
+	i := 1
+	for stops[i].offset < t {
+		i++
+	}
+	from, to := stops[i-1], stops[i]
+	f := 0.0
+	if span := to.offset - from.offset; span > 0 {
+		f = (t - from.offset) / span
+	}
+
+	r0, g0, b0, a0 := from.color.RGBA()
+	r1, g1, b1, a1 := to.color.RGBA()
+	mix := func(a, b uint32) uint16 {
+		return uint16(math.Round(float64(a) + (float64(b)-float64(a))*f))
+	}
+	return color.RGBA64{R: mix(r0, r1), G: mix(g0, g1), B: mix(b0, b1), A: mix(a0, a1)}
+}
@@ -0,0 +1,189 @@
+package ogimage
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseGradient(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		radial  bool
+		angle   float64
+		offsets []float64
+	}{
+		{"default direction", "linear-gradient(red, blue)", false, 180, []float64{0, 1}},
+		{"angle", "linear-gradient(135deg, #1a1a2e, #16213e 60%, #0f3460)", false, 135, []float64{0, 0.6, 1}},
+		{"turn", "linear-gradient(0.25turn, red, blue)", false, 90, []float64{0, 1}},
+		{"to side", "linear-gradient(to left, red, blue)", false, 270, []float64{0, 1}},
+		{"missing offsets spread evenly", "linear-gradient(red, green, blue, white 90%, black)", false, 180, []float64{0, 0.3, 0.6, 0.9, 1}},
+		{"offsets never go backwards", "linear-gradient(red 50%, blue 20%)", false, 180, []float64{0.5, 0.5}},
+		{"function colors", "linear-gradient(rgb(255, 0, 0) 10%, hsl(240, 100%, 50%))", false, 180, []float64{0.1, 1}},
+		{"radial", "radial-gradient(red, blue)", true, 180, []float64{0, 1}},
+		{"radial shape", "radial-gradient(circle at top left, red, blue 80%)", true, 180, []float64{0, 0.8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := parseGradient(tt.input)
+			if err != nil {
+				t.Fatalf("parseGradient(%q) unexpected error: %v", tt.input, err)
+			}
+			if g.radial != tt.radial || g.angle != tt.angle {
+				t.Errorf("radial = %v, angle = %v, want %v, %v", g.radial, g.angle, tt.radial, tt.angle)
+			}
+			if len(g.stops) != len(tt.offsets) {
+				t.Fatalf("got %d stops, want %d", len(g.stops), len(tt.offsets))
+			}
+			for i, stop := range g.stops {
+				if math.Abs(stop.offset-tt.offsets[i]) > 1e-9 {
+					t.Errorf("stop %d offset = %v, want %v", i, stop.offset, tt.offsets[i])
+				}
+			}
+		})
+	}
+
+	t.Run("corner direction", func(t *testing.T) {
+		g, err := parseGradient("linear-gradient(to bottom right, red, blue)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.toX != 1 || g.toY != 1 {
+			t.Errorf("toX, toY = %v, %v, want 1, 1", g.toX, g.toY)
+		}
+	})
+
+	t.Run("radial position", func(t *testing.T) {
+		g, err := parseGradient("radial-gradient(ellipse at 25% 75%, red, blue)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.circle || g.cx != 0.25 || g.cy != 0.75 {
+			t.Errorf("circle, cx, cy = %v, %v, %v", g.circle, g.cx, g.cy)
+		}
+	})
+}
+
+func TestParseGradientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"one stop", "linear-gradient(90deg, red)", "need at least two color stops"},
+		{"bad color", "linear-gradient(red, bleu)", `invalid color "bleu"`},
+		{"bad angle", "linear-gradient(90dgr, red, blue)", `"90dgr" is not an angle`},
+		{"bad direction", "linear-gradient(to middle, red, blue)", `unknown direction "middle"`},
+		{"bad offset", "linear-gradient(red x%, blue)", `invalid stop offset "x%"`},
+		{"NaN offset", "linear-gradient(red nan%, blue)", `invalid stop offset "nan%"`},
+		{"infinite offset", "linear-gradient(red, blue inf%)", `invalid stop offset "inf%"`},
+		{"unsupported size", "radial-gradient(circle closest-side, red, blue)", `unsupported radial gradient shape "closest-side"`},
+		{"bad position", "radial-gradient(at middle, red, blue)", `invalid position "middle"`},
+		{"unclosed", "linear-gradient(red, blue", "invalid gradient"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBackground(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateBackground(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitTopLevel(t *testing.T) {
+	got := splitTopLevel("90deg, rgb(1, 2, 3) 10%,  blue ,", ',')
+	want := []string{"90deg", "rgb(1, 2, 3) 10%", "blue"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitTopLevel() = %q, want %q", got, want)
+	}
+}
+
+func TestStopColorAt(t *testing.T) {
+	stops := []colorStop{
+		{color.NRGBA{255, 0, 0, 255}, 0.2},
+		{color.NRGBA{0, 0, 255, 255}, 0.6},
+		{color.NRGBA{0, 0, 255, 0}, 1},
+	}
+
+	tests := []struct {
+		name string
+		t    float64
+		want color.RGBA
+	}{
+		{"before first stop", 0, color.RGBA{255, 0, 0, 255}},
+		{"midway", 0.4, color.RGBA{128, 0, 128, 255}},
+		{"after last stop", 2, color.RGBA{0, 0, 0, 0}},
+		{"fading to transparent keeps hue", 0.8, color.RGBA{0, 0, 128, 128}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := color.RGBAModel.Convert(stopColorAt(stops, tt.t)).(color.RGBA)
+			if colorDistance(got, tt.want) > 1 {
+				t.Errorf("stopColorAt(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGradientPattern(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	tests := []struct {
+		name   string
+		input  string
+		points map[[2]int]color.RGBA
+	}{
+		{
+			name:   "to right",
+			input:  "linear-gradient(to right, red, blue)",
+			points: map[[2]int]color.RGBA{{0, 50}: red, {199, 50}: blue},
+		},
+		{
+			name:   "default is top to bottom",
+			input:  "linear-gradient(red, blue)",
+			points: map[[2]int]color.RGBA{{100, 0}: red, {100, 99}: blue},
+		},
+		{
+			name:   "corner reaches both ends",
+			input:  "linear-gradient(to bottom right, red, blue)",
+			points: map[[2]int]color.RGBA{{0, 0}: red, {199, 99}: blue},
+		},
+		{
+			name:   "radial center and corners",
+			input:  "radial-gradient(red, blue)",
+			points: map[[2]int]color.RGBA{{100, 50}: red, {0, 0}: blue, {199, 99}: blue},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := parseGradient(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := g.pattern(200, 100)
+			for pt, want := range tt.points {
+				got := color.RGBAModel.Convert(p.ColorAt(pt[0], pt[1])).(color.RGBA)
+				if colorDistance(got, want) > 8 {
+					t.Errorf("ColorAt(%d, %d) = %v, want about %v", pt[0], pt[1], got, want)
+				}
+			}
+		})
+	}
+}
+
+// colorDistance returns the largest difference between two colors' channels
+func colorDistance(a, b color.RGBA) int {
+	d := 0
+	for _, pair := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		d = max(d, int(math.Abs(float64(pair[0])-float64(pair[1]))))
+	}
+	return d
+}
@@ -0,0 +1,277 @@
+package ogimage
+
+import (
+	"embed"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Hyphenation languages
+const (
+	HyphenateEnglish = "en"
+	HyphenateGerman  = "de"
+)
+
+//go:generate go run hyphenation/generate.go -ref $HYPH_UTF8_REF
+
+//go:embed hyphenation/*.pat.txt hyphenation/*.hyp.txt
+var hyphenationFiles embed.FS
+
+// hyphenationLanguages names the pattern files for each language and the
+// fewest letters left before and after a hyphen
+var hyphenationLanguages = map[string]struct {
+	name              string
+	leftMin, rightMin int
+}{
+	HyphenateEnglish: {"hyph-en-us", 2, 3},
+	HyphenateGerman:  {"hyph-de-1996", 2, 2},
+}
+
+// hyphenator finds where words may be hyphenated with Liang's algorithm
+type hyphenator struct {
+	// patterns maps the letters of each pattern to its values, one before
+	// each letter and one after the last
+	patterns   map[string][]byte
+	maxPattern int
+	// exceptions maps words to the positions they break at
+	exceptions        map[string][]int
+	leftMin, rightMin int
+}
+
+var (
+	hyphenatorsMu sync.Mutex
+	hyphenators   = map[string]*hyphenator{}
+)
+
+// loadHyphenator returns the hyphenator for lang, reading its patterns the
+// first time it is used. It returns nil if lang is empty or unknown.
+func loadHyphenator(lang string) *hyphenator {
+	lang = strings.ToLower(lang)
+	hyphenatorsMu.Lock()
+	defer hyphenatorsMu.Unlock()
+	if h, ok := hyphenators[lang]; ok {
+		return h
+	}
+
+	language, ok := hyphenationLanguages[lang]
+	if !ok {
+		return nil
+	}
+	h := &hyphenator{
+		patterns:   make(map[string][]byte),
+		exceptions: make(map[string][]int),
+		leftMin:    language.leftMin,
+		rightMin:   language.rightMin,
+	}
+	patterns, _ := hyphenationFiles.ReadFile("hyphenation/" + language.name + ".pat.txt")
+	for _, p := range strings.Fields(string(patterns)) {
+		h.addPattern(p)
+	}
+	exceptions, _ := hyphenationFiles.ReadFile("hyphenation/" + language.name + ".hyp.txt")
+	for _, e := range strings.Fields(string(exceptions)) {
+		h.addException(e)
+	}
+	hyphenators[lang] = h
+	return h
+}
+
+// addPattern adds a pattern such as "1tio" or ".ach4", where each digit is
+// the value between the letters around it
+func (h *hyphenator) addPattern(p string) {
+	var letters []rune
+	values := []byte{0}
+	for _, r := range p {
+		if r >= '0' && r <= '9' {
+			values[len(values)-1] = byte(r - '0')
+			continue
+		}
+		letters = append(letters, r)
+		values = append(values, 0)
+	}
+	h.patterns[string(letters)] = values
+	h.maxPattern = max(h.maxPattern, len(letters))
+}
+
+// addException adds a word written with hyphens where it breaks, such as
+// "ta-ble"
+func (h *hyphenator) addException(e string) {
+	var letters []rune
+	var breaks []int
+	for _, r := range e {
+		if r == '-' {
+			breaks = append(breaks, len(letters))
+			continue
+		}
+		letters = append(letters, r)
+	}
+	h.exceptions[string(letters)] = breaks
+}
+
+// points returns the positions, in runes, before which word may be
+// hyphenated. Words with anything but letters are not hyphenated.
+func (h *hyphenator) points(word string) []int {
+	runes := []rune(strings.ToLower(word))
+	n := len(runes)
+	if n < h.leftMin+h.rightMin {
+		return nil
+	}
+	for _, r := range runes {
+		if !unicode.IsLetter(r) {
+			return nil
+		}
+	}
+
+	var points []int
+	if breaks, ok := h.exceptions[string(runes)]; ok {
+		for _, k := range breaks {
+			if k >= h.leftMin && k <= n-h.rightMin {
+				points = append(points, k)
+			}
+		}
+		return points
+	}
+
+	// values[k] is the value before dotted[k]; the word's letter k is
+	// dotted[k+1]
+	dotted := append(append([]rune{'.'}, runes...), '.')
+	values := make([]byte, len(dotted)+1)
+	for i := range dotted {
+		for j := i + 1; j <= len(dotted) && j-i <= h.maxPattern; j++ {
+			pattern, ok := h.patterns[string(dotted[i:j])]
+			if !ok {
+				continue
+			}
+			for k, v := range pattern {
+				values[i+k] = max(values[i+k], v)
+			}
+		}
+	}
+
+	for k := h.leftMin; k <= n-h.rightMin; k++ {
+		if values[k+1]%2 == 1 {
+			points = append(points, k)
+		}
+	}
+	return points
+}
+
+// identifierBreaks returns the positions, in runes, of the boundaries
+// inside a camelCase or snake_case identifier: after an underscore, before
+// an upper case letter that follows a lower case one, and before the last
+// capital of an acronym that starts a new word, as in HTTP|Server.
+func identifierBreaks(runes []rune) []int {
+	var breaks []int
+	for k := 1; k < len(runes); k++ {
+		prev, r := runes[k-1], runes[k]
+		switch {
+		case prev == '_' && r != '_':
+		case unicode.IsLower(prev) && unicode.IsUpper(r):
+		case unicode.IsUpper(prev) && unicode.IsUpper(r) && k+1 < len(runes) && unicode.IsLower(runes[k+1]):
+		default:
+			continue
+		}
+		breaks = append(breaks, k)
+	}
+	return breaks
+}
+
+// breakWord splits a word wider than maxWidth into pieces, each as long as
+// fits the width measured with the font loaded in dc. Identifiers are
+// broken at their camelCase and snake_case boundaries; other words are
+// hyphenated with h, if it is not nil, keeping any punctuation around them
+// attached. Each piece of a marked-up word starts in the inline style in
+// effect where it was cut. A word that can't be broken is returned whole.
+func breakWord(dc measurer, word string, maxWidth float64, h *hyphenator) []string {
+	runes := []rune(word)
+	breaks := identifierBreaks(runes)
+	hyphen := ""
+	if len(breaks) == 0 && h != nil {
+		start, end := 0, len(runes)
+		for start < end && !unicode.IsLetter(runes[start]) {
+			start++
+		}
+		for end > start && !unicode.IsLetter(runes[end-1]) {
+			end--
+		}
+		for _, k := range h.points(string(runes[start:end])) {
+			breaks = append(breaks, start+k)
+		}
+		hyphen = "-"
+	}
+
+	fits := func(s string) bool {
+		w, _ := dc.MeasureString(s)
+		return w <= maxWidth
+	}
+	// piece is runes[i:j], starting in the inline style in effect at i
+	piece := func(i, j int) string {
+		return styleBefore(runes[:i]) + string(runes[i:j])
+	}
+
+	var pieces []string
+	start := 0
+	for !fits(piece(start, len(runes))) {
+		// Cut at the last break that fits, or the first if none does
+		cut := -1
+		for _, k := range breaks {
+			if k <= start {
+				continue
+			}
+			if cut >= 0 && !fits(piece(start, k)+hyphen) {
+				break
+			}
+			cut = k
+		}
+		if cut < 0 {
+			break
+		}
+		pieces = append(pieces, piece(start, cut)+hyphen)
+		start = cut
+	}
+	return append(pieces, piece(start, len(runes)))
+}
+
+// breakLongLines wraps lines again from the first one that is wider than
+// maxWidth, splitting each word that doesn't fit on a line of its own with
+// breakWord. The rest of the text is wrapped greedily from there, so the
+// end of a broken word shares its line with the words after it.
+func breakLongLines(dc measurer, lines []string, maxWidth float64, h *hyphenator) []string {
+	for i, line := range lines {
+		if w, _ := dc.MeasureString(line); w <= maxWidth {
+			continue
+		}
+
+		rest := lines[i]
+		for _, line := range lines[i+1:] {
+			rest = joinLines(rest, line)
+		}
+		broken := lines[:i:i]
+		var current string
+		for _, unit := range breakUnits(rest) {
+			word := strings.TrimPrefix(unit, " ")
+			pieces := []string{word}
+			if w, _ := dc.MeasureString(word); w > maxWidth {
+				pieces = breakWord(dc, word, maxWidth, h)
+			}
+			for j, piece := range pieces {
+				if current == "" {
+					current = piece
+					continue
+				}
+				// Only the first piece keeps the space before the word
+				if j == 0 && word != unit {
+					piece = " " + piece
+				}
+				if w, _ := dc.MeasureString(current + piece); w > maxWidth {
+					broken = append(broken, current)
+					current = strings.TrimPrefix(piece, " ")
+				} else {
+					current += piece
+				}
+			}
+		}
+		return append(broken, current)
+	}
+	return lines
+}
@@ -0,0 +1,138 @@
+package ogimage
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestHyphenatorPoints(t *testing.T) {
+	tests := []struct {
+		lang string
+		word string
+		want string
+	}{
+		{HyphenateEnglish, "hyphenation", "hy-phen-a-tion"},
+		{HyphenateEnglish, "Programming", "Pro-gram-ming"},
+		{HyphenateEnglish, "algorithm", "al-go-rithm"},
+		{HyphenateEnglish, "computer", "com-puter"},
+		{HyphenateEnglish, "table", "ta-ble"},
+		{HyphenateEnglish, "academies", "acad-e-mies"},
+		{HyphenateEnglish, "go", "go"},
+		{HyphenateEnglish, "x86", "x86"},
+		{HyphenateGerman, "Silbentrennung", "Sil-ben-tren-nung"},
+		{HyphenateGerman, "Donaudampfschifffahrt", "Do-nau-dampf-schiff-fahrt"},
+		{HyphenateGerman, "Zusammenarbeit", "Zu-sam-men-ar-beit"},
+		{HyphenateGerman, "Größenänderung", "Grö-ßen-än-de-rung"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang+" "+tt.word, func(t *testing.T) {
+			h := loadHyphenator(tt.lang)
+			if h == nil {
+				t.Fatalf("loadHyphenator(%q) = nil", tt.lang)
+			}
+			runes := []rune(tt.word)
+			var b strings.Builder
+			points := h.points(tt.word)
+			for i, r := range runes {
+				if slices.Contains(points, i) {
+					b.WriteRune('-')
+				}
+				b.WriteRune(r)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("points(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+
+	if h := loadHyphenator("fr"); h != nil {
+		t.Errorf("loadHyphenator(%q) = %v, want nil", "fr", h)
+	}
+	if h := loadHyphenator(""); h != nil {
+		t.Errorf("loadHyphenator(%q) = %v, want nil", "", h)
+	}
+}
+
+func TestIdentifierBreaks(t *testing.T) {
+	tests := []struct {
+		word string
+		want []int
+	}{
+		{"preventOrphans", []int{7}},
+		{"resolve_font_path", []int{8, 13}},
+		{"HTTPServer", []int{4}},
+		{"__init__", []int{2}},
+		{"plain", nil},
+		{"NASA", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := identifierBreaks([]rune(tt.word)); !slices.Equal(got, tt.want) {
+				t.Errorf("identifierBreaks(%q) = %v, want %v", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakLongLines(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, 72); err != nil {
+		t.Fatalf("failed to load font: %v", err)
+	}
+	maxWidth := 500.0
+
+	tests := []struct {
+		name string
+		lang string
+		text string
+		// hyphen is whether the broken word should end its lines with a hyphen
+		hyphen bool
+	}{
+		{"camelCase", "", "Use resolveFontPathWithPaths", false},
+		{"snake_case", "", "about default_system_font_paths", false},
+		{"german compound", HyphenateGerman, "Die Donaudampfschifffahrtsgesellschaft", true},
+		{"english with punctuation", HyphenateEnglish, "(Incomprehensibilities!)", true},
+	}
+
+	letters := strings.NewReplacer(" ", "", "-", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := titleStyle{wrap: WrapGreedy, hyphenate: tt.lang}
+			lines := wrapLines(dc, tt.text, maxWidth, style)
+			if len(lines) < 2 {
+				t.Fatalf("wrapLines() = %q, want the long word broken", lines)
+			}
+			for _, line := range lines {
+				if w, _ := dc.MeasureString(line); w > maxWidth {
+					t.Errorf("line %q is %v wide, want at most %v", line, w, maxWidth)
+				}
+			}
+			if got := letters.Replace(strings.Join(lines, "")); got != letters.Replace(tt.text) {
+				t.Errorf("wrapLines() = %q, want the letters of %q", lines, tt.text)
+			}
+			if got := strings.HasSuffix(lines[len(lines)-2], "-"); got != tt.hyphen {
+				t.Errorf("wrapLines() = %q, want hyphen %v", lines, tt.hyphen)
+			}
+		})
+	}
+
+	t.Run("unbreakable word is kept whole", func(t *testing.T) {
+		lines := wrapLines(dc, "A Supercalifragilisticexpialidocious Title", maxWidth, titleStyle{wrap: WrapGreedy})
+		if !slices.Contains(lines, "Supercalifragilisticexpialidocious") {
+			t.Errorf("wrapLines() = %q, want the word unbroken", lines)
+		}
+	})
+
+	t.Run("lines that fit are unchanged", func(t *testing.T) {
+		lines := []string{"Hello World", "Foo Bar"}
+		if got := breakLongLines(dc, lines, maxWidth, loadHyphenator(HyphenateEnglish)); !slices.Equal(got, lines) {
+			t.Errorf("breakLongLines() = %q, want %q", got, lines)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+//go:build ignore
+
+// generate downloads the hyphenation patterns of each language from the
+// hyph-utf8 project and writes them to this directory unmodified: the .tex
+// source with its copyright and license header, the plain-text patterns and
+// exceptions that hyphen.go embeds, and a LICENSE file collecting the
+// license of each. Run it with go generate from the ogimage directory,
+// with HYPH_UTF8_REF set to the tex-hyphen tag to pin.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// languages are the pattern files hyphen.go reads
+var languages = []string{"hyph-en-us", "hyph-de-1996"}
+
+const upstream = "https://raw.githubusercontent.com/hyphenation/tex-hyphen/%s/hyph-utf8/tex/generic/hyph-utf8/patterns/%s/%s"
+
+func main() {
+	ref := flag.String("ref", "", "tex-hyphen tag or commit to download")
+	dir := flag.String("dir", "hyphenation", "Directory to write the files to")
+	flag.Parse()
+
+	// A branch would make the committed files impossible to reproduce
+	if *ref == "" || *ref == "master" || *ref == "main" {
+		log.Fatal("-ref must be a tex-hyphen tag or commit, such as HYPH_UTF8_REF for go generate")
+	}
+
+	var license bytes.Buffer
+	fmt.Fprintf(&license, "The files in this directory are copied unmodified from hyph-utf8,\nhttps://github.com/hyphenation/tex-hyphen, at %s.\n", *ref)
+	for _, lang := range languages {
+		for _, file := range []struct {
+			kind, name        string
+			required, license bool
+		}{
+			{"tex", lang + ".tex", true, false},
+			{"txt", lang + ".pat.txt", true, false},
+			{"txt", lang + ".hyp.txt", false, false},
+			{"txt", lang + ".lic.txt", true, true},
+		} {
+			data, err := download(fmt.Sprintf(upstream, *ref, file.kind, file.name))
+			if err != nil {
+				if file.required {
+					log.Fatal(err)
+				}
+				// Not every language has exceptions
+				os.Remove(filepath.Join(*dir, file.name))
+				continue
+			}
+			if file.license {
+				fmt.Fprintf(&license, "\n%s\n\n%s", lang, data)
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(*dir, file.name), data, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(*dir, "LICENSE"), license.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// download returns the body of url
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,173 @@
+package ogimage
+
+import (
+	"strings"
+	"unicode"
+)
+
+// breakClass is the line breaking class of a character, reduced from the
+// classes of Unicode Standard Annex #14 to those that decide where a title
+// may break
+type breakClass int
+
+const (
+	// classAlpha is letters, digits and other text, which only break at
+	// spaces
+	classAlpha breakClass = iota
+	// classSpace separates words and is dropped at a break
+	classSpace
+	// classIdeo is ideographs and kana, which may break on either side
+	classIdeo
+	// classOpen is opening punctuation, which is kept with the character
+	// after it
+	classOpen
+	// classClose is closing punctuation, small kana and other characters
+	// that must not start a line (kinsoku)
+	classClose
+	// classMark is combining marks, which are kept with the character
+	// before them, and style runes, which go with the character after them
+	classMark
+)
+
+// openPunctuation holds the opening brackets and quotes that must not end a
+// line, and closePunctuation the characters that must not start one
+const (
+	openPunctuation  = "([{‘“〈《「『【〔〖〘〚〝（［｛｟"
+	closePunctuation = ")]}’”!?,.:;‼⁇⁈⁉、。〉》」』】〕〗〙〛〞〟）］｝｠，．！？：；・ー〜ゝゞヽヾ々〻゛゜" +
+		"ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ"
+)
+
+// lineBreakClass returns the line breaking class of r. Hangul is left as
+// classAlpha: Korean separates words with spaces and keeps them whole.
+func lineBreakClass(r rune) breakClass {
+	switch {
+	case unicode.IsSpace(r):
+		return classSpace
+	case isStyleRune(r) || unicode.In(r, unicode.Mn, unicode.Me):
+		return classMark
+	case strings.ContainsRune(openPunctuation, r):
+		return classOpen
+	case strings.ContainsRune(closePunctuation, r):
+		return classClose
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Bopomofo),
+		r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60:
+		return classIdeo
+	}
+	return classAlpha
+}
+
+// breakAllowed reports whether a line may break between a character of
+// class a and one of class b with no space between them: next to an
+// ideograph, unless the break would end a line with opening punctuation or
+// start one with closing punctuation
+func breakAllowed(a, b breakClass) bool {
+	switch {
+	case a == classOpen, b == classClose, b == classMark:
+		return false
+	}
+	return a == classIdeo || b == classIdeo
+}
+
+// breakUnits splits text at its break opportunities: at spaces, and between
+// characters that may break without one, as in Chinese and Japanese. Runs of
+// spaces become a single space at the start of the unit after them, so
+// joining the units gives back the text with its spaces collapsed. A unit
+// cut from inside a marked-up word starts in the inline style in effect
+// where it was cut.
+func breakUnits(text string) []string {
+	var units []string
+	var unit strings.Builder
+	var word []rune   // the runes of the current word up to this one
+	var styles []rune // style runes not yet written, which go with the next character
+	prev := classSpace
+	space := false
+	for _, r := range text {
+		class := lineBreakClass(r)
+		switch {
+		case class == classSpace:
+			space = unit.Len() > 0 || len(units) > 0
+			word = word[:0]
+			prev = classSpace
+			continue
+		case isStyleRune(r):
+			styles = append(styles, r)
+			word = append(word, r)
+			continue
+		case class == classMark && !space:
+			unit.WriteRune(r)
+			word = append(word, r)
+			continue
+		}
+
+		switch {
+		case space:
+			units = appendUnit(units, &unit)
+			unit.WriteByte(' ')
+			unit.WriteString(string(styles))
+		case prev != classSpace && breakAllowed(prev, class):
+			units = appendUnit(units, &unit)
+			if len(styles) == 0 {
+				styles = []rune(styleBefore(word))
+			}
+			unit.WriteString(string(styles))
+		default:
+			unit.WriteString(string(styles))
+		}
+		styles = styles[:0]
+		unit.WriteRune(r)
+		word = append(word, r)
+		prev = class
+		space = false
+	}
+	unit.WriteString(string(styles))
+	return appendUnit(units, &unit)
+}
+
+// appendUnit appends the unit built in b to units, if there is one, and
+// resets b
+func appendUnit(units []string, b *strings.Builder) []string {
+	if b.Len() > 0 {
+		units = append(units, b.String())
+		b.Reset()
+	}
+	return units
+}
+
+// joinUnits joins units cut by breakUnits into a line, dropping the space
+// before the first
+func joinUnits(units []string) string {
+	return strings.TrimPrefix(strings.Join(units, ""), " ")
+}
+
+// joinLines joins two lines, or a unit and a line, that were broken apart:
+// with a space between them, unless the text may break there without one
+func joinLines(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	if breakAllowed(lastBreakClass(a), firstBreakClass(b)) {
+		return a + b
+	}
+	return a + " " + b
+}
+
+// firstBreakClass and lastBreakClass return the class of the first and last
+// character of s that is not a mark
+func firstBreakClass(s string) breakClass {
+	for _, r := range s {
+		if class := lineBreakClass(r); class != classMark {
+			return class
+		}
+	}
+	return classSpace
+}
+
+func lastBreakClass(s string) breakClass {
+	runes := []rune(s)
+	for i := len(runes) - 1; i >= 0; i-- {
+		if class := lineBreakClass(runes[i]); class != classMark {
+			return class
+		}
+	}
+	return classSpace
+}
@@ -0,0 +1,101 @@
+package ogimage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestBreakUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin words", "Hello  brave\tworld", []string{"Hello", " brave", " world"}},
+		{"punctuation stays with latin words", "foo(bar), baz.", []string{"foo(bar),", " baz."}},
+		{"chinese", "你好世界", []string{"你", "好", "世", "界"}},
+		{"closing punctuation stays on the line", "你好，世界。", []string{"你", "好，", "世", "界。"}},
+		{"opening punctuation goes with the next character", "見て「東京」へ", []string{"見", "て", "「東", "京」", "へ"}},
+		{"small kana and long vowel mark", "ジャーナル", []string{"ジャー", "ナ", "ル"}},
+		{"latin inside japanese", "Go言語で書く", []string{"Go", "言", "語", "で", "書", "く"}},
+		{"korean breaks at spaces", "안녕하세요 세계", []string{"안녕하세요", " 세계"}},
+		{"style carried into cut units", "**東京**タワー", []string{"[b]東", "[b]京", "[]タ", "ワー"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, u := range breakUnits(parseMarkup(tt.text)) {
+				got = append(got, showStyles(u))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("breakUnits(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"Hello", "world", "Hello world"},
+		{"東京", "タワー", "東京タワー"},
+		{"Go", "言語", "Go言語"},
+		{"", "world", "world"},
+	}
+
+	for _, tt := range tests {
+		if got := joinLines(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPreventOrphansCJK(t *testing.T) {
+	got := preventOrphans(runeWidths{}, []string{"東京タワーへ", "行く"})
+	if want := []string{"東京タワーへ", "行く"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("preventOrphans() = %q, want %q", got, want)
+	}
+	got = preventOrphans(runeWidths{}, []string{"東京タワーへ行", "く"})
+	if want := []string{"東京タワーへ", "行く"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("preventOrphans() = %q, want %q", got, want)
+	}
+}
+
+func TestWrapTextCJK(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, 48); err != nil {
+		t.Fatal(err)
+	}
+
+	title := "「東京」で学ぶGo言語の並行処理、チャネルとゴルーチンの基本。実践的なパターンを紹介します！"
+	for _, maxWidth := range []float64{300, 500, 800} {
+		lines := wrapText(dc, title, maxWidth)
+		if len(lines) < 2 {
+			t.Fatalf("maxWidth %g: wrapText() = %q, want the title broken without spaces", maxWidth, lines)
+		}
+		if got := strings.Join(lines, ""); got != title {
+			t.Errorf("maxWidth %g: lines join to %q, want %q", maxWidth, got, title)
+		}
+		for i, line := range lines {
+			if w, _ := dc.MeasureString(line); w > maxWidth {
+				t.Errorf("maxWidth %g: line %q is %g wide", maxWidth, line, w)
+			}
+			runes := []rune(line)
+			if i > 0 && lineBreakClass(runes[0]) == classClose {
+				t.Errorf("maxWidth %g: line %q starts with closing punctuation", maxWidth, line)
+			}
+			if lineBreakClass(runes[len(runes)-1]) == classOpen {
+				t.Errorf("maxWidth %g: line %q ends with opening punctuation", maxWidth, line)
+			}
+		}
+		if last := lines[len(lines)-1]; len(breakUnits(last)) < 2 {
+			t.Errorf("maxWidth %g: last line %q is an orphan", maxWidth, last)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/draw"
+)
+
+// Logo corners
+const (
+	LogoTopLeft     = "top-left"
+	LogoTopRight    = "top-right"
+	LogoBottomLeft  = "bottom-left"
+	LogoBottomRight = "bottom-right"
+)
+
+// Logo defaults and spacing
+const (
+	// DefaultLogoSize is the size of the box the logo is scaled to fit
+	DefaultLogoSize = 80.0
+	// DefaultLogoPadding is the distance from the logo to the card's edges
+	DefaultLogoPadding = 40.0
+	// LogoTextGap is the minimum space between the logo and the title or URL
+	LogoTextGap = 20.0
+	// NoLogoPadding is a Padding that puts the logo against the card's
+	// edges, as a zero Padding takes DefaultLogoPadding
+	NoLogoPadding = -1.0
+)
+
+// Transparent is an opacity of none, as a zero opacity takes the default
+const Transparent = -1.0
+
+// Logo is a brand mark or avatar drawn in a corner of every card. The title
+// and URL are narrowed so they never run into it. A zero Size, Padding and
+// Opacity take the defaults, and an empty Position is LogoBottomRight.
+type Logo struct {
+	// Path is the PNG, JPEG, GIF or WebP logo file; empty means no logo
+	Path     string
+	Position string
+	// Size is the side of the square box the logo is scaled to fit
+	Size float64
+	// Padding is the distance from the logo to the card's edges, or
+	// NoLogoPadding for none
+	Padding float64
+	// Opacity is up to 1 (opaque, the default), or Transparent to hide the
+	// logo
+	Opacity float64
+	// Circle crops the logo to a circle, for avatars
+	Circle bool
+}
+
+// withDefaults returns a copy of l with zero values replaced by defaults,
+// and NoLogoPadding and Transparent by zero
+func (l Logo) withDefaults() Logo {
+	if l.Position == "" {
+		l.Position = LogoBottomRight
+	}
+	if l.Size == 0 {
+		l.Size = DefaultLogoSize
+	}
+	switch l.Padding {
+	case 0:
+		l.Padding = DefaultLogoPadding
+	case NoLogoPadding:
+		l.Padding = 0
+	}
+	switch l.Opacity {
+	case 0:
+		l.Opacity = 1
+	case Transparent:
+		l.Opacity = 0
+	}
+	return l
+}
+
+// Validate reports whether the logo's position, size, padding and opacity
+// are valid. It does not read the logo file.
+func (l Logo) Validate() error {
+	switch l.Position {
+	case "", LogoTopLeft, LogoTopRight, LogoBottomLeft, LogoBottomRight:
+	default:
+		return fmt.Errorf("unknown logo position %q: want %s, %s, %s or %s", l.Position, LogoTopLeft, LogoTopRight, LogoBottomLeft, LogoBottomRight)
+	}
+	if l.Size < 0 || (l.Padding < 0 && l.Padding != NoLogoPadding) {
+		return fmt.Errorf("logo size and padding must not be negative")
+	}
+	if l.Opacity != Transparent && !(l.Opacity >= 0 && l.Opacity <= 1) {
+		return fmt.Errorf("logo opacity must be between 0 and 1")
+	}
+	return nil
+}
+
+// logoLayer is a logo scaled, masked and placed on the card
+type logoLayer struct {
+	img  image.Image
+	rect image.Rectangle
+}
+
+// loadLogo validates the logo, decodes it and places it in its corner of
+// a card of size width x height. It returns nil if there is no logo.
+func loadLogo(l Logo, width, height int) (*logoLayer, error) {
+	if l.Path == "" {
+		return nil, nil
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	src, err := decodeImageFile("logo", l.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Avatars are cropped to a square for the circle; other logos keep
+	// their aspect ratio inside the size x size box
+	size := int(math.Round(l.Size))
+	sb := src.Bounds()
+	var dst image.Rectangle
+	if l.Circle {
+		dst = fitRect(sb.Dx(), sb.Dy(), size, size, FitCover)
+	} else {
+		dst = fitRect(sb.Dx(), sb.Dy(), size, size, FitContain)
+		dst = dst.Sub(dst.Min)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, min(size, dst.Dx()), min(size, dst.Dy())))
+	draw.CatmullRom.Scale(scaled, dst, src, sb, draw.Src, nil)
+
+	w, h := scaled.Bounds().Dx(), scaled.Bounds().Dy()
+	mask := gg.NewContext(w, h)
+	mask.SetColor(color.Alpha{uint8(math.Round(l.Opacity * 255))})
+	if l.Circle {
+		mask.DrawCircle(float64(w)/2, float64(h)/2, float64(min(w, h))/2)
+	} else {
+		mask.DrawRectangle(0, 0, float64(w), float64(h))
+	}
+	mask.Fill()
+
+	img := image.NewRGBA(scaled.Bounds())
+	draw.DrawMask(img, img.Bounds(), scaled, image.Point{}, mask.Image(), image.Point{}, draw.Over)
+
+	return &logoLayer{img: img, rect: l.place(w, h, width, height)}, nil
+}
+
+// place returns where a w x h logo is drawn in its corner of a card of
+// size width x height
+func (l Logo) place(w, h, width, height int) image.Rectangle {
+	pad := int(math.Round(l.Padding))
+	x, y := pad, pad
+	switch l.Position {
+	case LogoTopRight, LogoBottomRight:
+		x = width - pad - w
+	}
+	switch l.Position {
+	case LogoBottomLeft, LogoBottomRight:
+		y = height - pad - h
+	}
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// bounds returns the area covered by the logo, or the empty rectangle if
+// there is no logo
+func (l *logoLayer) bounds() image.Rectangle {
+	if l == nil {
+		return image.Rectangle{}
+	}
+	return l.rect
+}
+
+// draw draws the logo in its corner
+func (l *logoLayer) draw(dc *gg.Context) {
+	dc.DrawImage(l.img, l.rect.Min.X, l.rect.Min.Y)
+}
+
+// textColumn returns the left edge and maximum width of a line of text
+// that spans top to bottom and would be lineWidth wide, aligned by align
+// between the side margins. The column is narrowed, on the side of the
+// card the logo is on, only if the line would otherwise come within
+// LogoTextGap of it.
+func textColumn(avoid image.Rectangle, width int, top, bottom, lineWidth float64, align string) (x, maxWidth float64) {
+	x = TextSideMargin
+	maxWidth = float64(width) - (2 * TextSideMargin)
+	if avoid.Empty() {
+		return x, maxWidth
+	}
+
+	minX := float64(avoid.Min.X) - LogoTextGap
+	maxX := float64(avoid.Max.X) + LogoTextGap
+	if bottom <= float64(avoid.Min.Y)-LogoTextGap || top >= float64(avoid.Max.Y)+LogoTextGap {
+		return x, maxWidth
+	}
+	left := x + alignOffset(align, maxWidth, lineWidth)
+	if left+lineWidth <= minX || left >= maxX {
+		return x, maxWidth
+	}
+
+	if avoid.Min.X+avoid.Max.X > width {
+		// Logo on the right
+		return x, math.Min(maxWidth, minX-x)
+	}
+	x = math.Max(x, maxX)
+	return x, float64(width) - TextSideMargin - x
+}
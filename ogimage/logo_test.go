@@ -0,0 +1,205 @@
+package ogimage
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestLoadLogo(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	wide := writeTestImage(t, t.TempDir(), ".png", 200, 100, red)
+	defaults := Logo{}.withDefaults()
+
+	t.Run("no logo", func(t *testing.T) {
+		l, err := loadLogo(defaults, 1200, 628)
+		if l != nil || err != nil {
+			t.Errorf("loadLogo() = %v, %v, want nil, nil", l, err)
+		}
+		if !l.bounds().Empty() {
+			t.Errorf("bounds() = %v, want empty", l.bounds())
+		}
+	})
+
+	t.Run("keeps aspect ratio in its corner", func(t *testing.T) {
+		logo := defaults
+		logo.Path = wide
+		l, err := loadLogo(logo, 1200, 628)
+		if err != nil {
+			t.Fatalf("loadLogo() error: %v", err)
+		}
+		if want := image.Rect(1080, 548, 1160, 588); l.bounds() != want {
+			t.Errorf("bounds() = %v, want %v", l.bounds(), want)
+		}
+	})
+
+	t.Run("circle crops to a square", func(t *testing.T) {
+		logo := defaults
+		logo.Path = wide
+		logo.Position = LogoTopLeft
+		logo.Circle = true
+		l, err := loadLogo(logo, 1200, 628)
+		if err != nil {
+			t.Fatalf("loadLogo() error: %v", err)
+		}
+		if want := image.Rect(40, 40, 120, 120); l.bounds() != want {
+			t.Errorf("bounds() = %v, want %v", l.bounds(), want)
+		}
+		if _, _, _, a := l.img.At(1, 1).RGBA(); a != 0 {
+			t.Errorf("corner alpha = %d, want transparent", a)
+		}
+		if _, _, _, a := l.img.At(40, 40).RGBA(); a != 0xffff {
+			t.Errorf("center alpha = %d, want opaque", a)
+		}
+	})
+
+	t.Run("opacity", func(t *testing.T) {
+		logo := defaults
+		logo.Path = wide
+		logo.Opacity = 0.5
+		l, err := loadLogo(logo, 1200, 628)
+		if err != nil {
+			t.Fatalf("loadLogo() error: %v", err)
+		}
+		if _, _, _, a := l.img.At(40, 20).RGBA(); a>>8 < 126 || a>>8 > 129 {
+			t.Errorf("alpha = %d, want about 128", a>>8)
+		}
+	})
+
+	t.Run("transparent and without padding", func(t *testing.T) {
+		logo := Logo{Path: wide, Opacity: Transparent, Padding: NoLogoPadding}.withDefaults()
+		l, err := loadLogo(logo, 1200, 628)
+		if err != nil {
+			t.Fatalf("loadLogo() error: %v", err)
+		}
+		if _, _, _, a := l.img.At(40, 20).RGBA(); a != 0 {
+			t.Errorf("alpha = %d, want hidden", a>>8)
+		}
+		if l.rect.Max != image.Pt(1200, 628) {
+			t.Errorf("rect = %v, want it in the corner", l.rect)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		modify  func(*Logo)
+		wantErr string
+	}{
+		{"unknown position", func(l *Logo) { l.Position = "center" }, `unknown logo position "center"`},
+		{"negative size", func(l *Logo) { l.Size = -10 }, "logo size and padding must not be negative"},
+		{"negative padding", func(l *Logo) { l.Padding = -10 }, "logo size and padding must not be negative"},
+		{"opacity out of range", func(l *Logo) { l.Opacity = 2 }, "logo opacity must be between 0 and 1"},
+		{"negative opacity", func(l *Logo) { l.Opacity = -0.5 }, "logo opacity must be between 0 and 1"},
+		{"missing file", func(l *Logo) { l.Path = "missing.png" }, "load logo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logo := defaults
+			logo.Path = wide
+			tt.modify(&logo)
+			_, err := loadLogo(logo, 1200, 628)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadLogo() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogoPlace(t *testing.T) {
+	tests := []struct {
+		position string
+		want     image.Rectangle
+	}{
+		{LogoTopLeft, image.Rect(10, 10, 60, 30)},
+		{LogoTopRight, image.Rect(340, 10, 390, 30)},
+		{LogoBottomLeft, image.Rect(10, 170, 60, 190)},
+		{LogoBottomRight, image.Rect(340, 170, 390, 190)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			logo := Logo{Position: tt.position, Padding: 10}
+			if got := logo.place(50, 20, 400, 200); got != tt.want {
+				t.Errorf("place() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextColumn(t *testing.T) {
+	full := 1200 - 2*TextSideMargin
+	right := image.Rect(1080, 40, 1160, 120)
+	left := image.Rect(40, 40, 120, 120)
+
+	tests := []struct {
+		name      string
+		avoid     image.Rectangle
+		top       float64
+		bottom    float64
+		lineWidth float64
+		align     string
+		wantX     float64
+		wantWidth float64
+	}{
+		{"no logo", image.Rectangle{}, 100, 180, full, "", TextSideMargin, full},
+		{"below the logo", right, 200, 280, full, "", TextSideMargin, full},
+		{"short line beside the logo", right, 60, 120, 300, "", TextSideMargin, full},
+		{"long line runs into the logo", right, 60, 120, full, "", TextSideMargin, 1080 - LogoTextGap - TextSideMargin},
+		{"logo on the left", left, 60, 120, 300, "", 120 + LogoTextGap, 1200 - TextSideMargin - 120 - LogoTextGap},
+		{"short right-aligned line runs into the logo", right, 60, 120, 300, AlignRight, TextSideMargin, 1080 - LogoTextGap - TextSideMargin},
+		{"short centered line clears the logo", right, 60, 120, 300, AlignCenter, TextSideMargin, full},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, w := textColumn(tt.avoid, 1200, tt.top, tt.bottom, tt.lineWidth, tt.align)
+			if x != tt.wantX || w != tt.wantWidth {
+				t.Errorf("textColumn() = %v, %v, want %v, %v", x, w, tt.wantX, tt.wantWidth)
+			}
+		})
+	}
+}
+
+func TestDrawTextAvoidsLogo(t *testing.T) {
+	fontPath := testFontPath(t)
+	title := "This is a very long title that should wrap across multiple lines in the image"
+	url := "https://example.com/a/very/long/url/that/fills/the/whole/width/of/the/card"
+
+	tests := []struct {
+		name  string
+		avoid image.Rectangle
+	}{
+		{"top right", image.Rect(1000, 120, 1160, 280)},
+		{"top left", image.Rect(40, 120, 200, 280)},
+		{"bottom right", image.Rect(1000, 480, 1160, 600)},
+		{"bottom left", image.Rect(40, 480, 200, 600)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Text on a transparent card: any opaque pixel in the logo's
+			// area is text that ran into it
+			dc := gg.NewContext(1200, 628)
+			fonts := &fontCache{}
+			if _, err := drawTitle(dc, fonts, testPalette(t), title, fontPath, 1200, 628, TitleFontSize, titleStyle{}, tt.avoid); err != nil {
+				t.Fatalf("drawTitle() error: %v", err)
+			}
+			if err := drawURL(dc, fonts, testPalette(t), url, fontPath, fontPath, 1200, 628, TitleFontSize, "", "", tagSet{}, tt.avoid); err != nil {
+				t.Fatalf("drawURL() error: %v", err)
+			}
+
+			img := dc.Image()
+			for y := tt.avoid.Min.Y; y < tt.avoid.Max.Y; y++ {
+				for x := tt.avoid.Min.X; x < tt.avoid.Max.X; x++ {
+					if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+						t.Fatalf("text drawn at (%d, %d) inside logo area %v", x, y, tt.avoid)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,501 @@
+package ogimage
+
+import (
+	"fmt"
+	"image/color"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// inlineStyle is a set of the styles a span of a marked-up title is drawn in
+type inlineStyle uint8
+
+const (
+	styleBold inlineStyle = 1 << iota
+	styleItalic
+	styleCode
+	styleHighlight
+)
+
+// Inline styles are carried through wrapping as runes that switch the
+// style of the text after them, up to the end of the word. Every word
+// starts plain, so words stay self-contained when lines are broken,
+// clamped or hyphenated. The runes are noncharacters, which Unicode sets
+// aside for a program's internal use, so unlike private use characters
+// such as icon font glyphs they never stand for text in a title.
+const (
+	styleRuneBase = '\uFDD0'
+	styleRuneLast = styleRuneBase + rune(styleBold|styleItalic|styleCode|styleHighlight)
+)
+
+// Sizes of the inline decorations, in ems of the title font
+const (
+	// markupAscent and markupDescent are how far highlights and code
+	// backgrounds reach above and below the baseline
+	markupAscent  = 0.82
+	markupDescent = 0.28
+	// highlightBleed is how far a highlight reaches past its text
+	highlightBleed = 0.08
+	// codePadding is the space between code and the ends of its background
+	codePadding = 0.15
+	codeRadius  = 0.12
+	// fauxBoldOffset is how far text is drawn again to embolden it, and
+	// fauxItalicSlant the shear that slants it, without a font of the style
+	fauxBoldOffset  = 1.0 / 36
+	fauxItalicSlant = 0.2
+)
+
+// markupDelimiters are the markers around a styled span
+var markupDelimiters = []struct {
+	marker string
+	style  inlineStyle
+}{
+	{"**", styleBold},
+	{"==", styleHighlight},
+	{"_", styleItalic},
+	{"`", styleCode},
+}
+
+// styleRune returns the rune that switches to style s
+func styleRune(s inlineStyle) rune {
+	return styleRuneBase + rune(s)
+}
+
+// isStyleRune reports whether r switches the inline style
+func isStyleRune(r rune) bool {
+	return r >= styleRuneBase && r <= styleRuneLast
+}
+
+// hasStyles reports whether s has any styled spans
+func hasStyles(s string) bool {
+	return strings.ContainsFunc(s, isStyleRune)
+}
+
+// styleBefore returns the style rune in effect after runes, which are the
+// start of a word, or "" if the word is plain there
+func styleBefore(runes []rune) string {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if isStyleRune(runes[i]) {
+			if runes[i] == styleRuneBase {
+				return ""
+			}
+			return string(runes[i])
+		}
+	}
+	return ""
+}
+
+// styledRune is a character of a title and the styles it is drawn in
+type styledRune struct {
+	r     rune
+	style inlineStyle
+}
+
+// parseMarkup replaces the markers of the styled spans in title with style
+// runes: **bold**, _italic_, `code` and ==highlight==. Like Markdown, an
+// opening marker must be followed by a non-space and a closing one
+// preceded by one, and an underscore only marks a span at the edges of a
+// word, so snake_case is left alone. Markers are not nested inside code,
+// a backslash escapes a marker and markers left unmatched are kept as
+// text. Style runes already in the title are removed, so they can't be
+// read as style switches, and a title without styled spans or escapes is
+// otherwise returned unchanged.
+func parseMarkup(title string) string {
+	title = strings.Map(func(r rune) rune {
+		if isStyleRune(r) {
+			return -1
+		}
+		return r
+	}, title)
+	runes := []rune(title)
+
+	// items are the characters of the title and the markers that may
+	// open or close a span, which are kept as text if they don't
+	type item struct {
+		r       rune
+		marker  string
+		style   inlineStyle
+		matched bool
+	}
+	var items []item
+	var open []int
+	escaped := false
+
+	for i := 0; i < len(runes); {
+		if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("*=_`\\", runes[i+1]) {
+			items = append(items, item{r: runes[i+1]})
+			escaped = true
+			i += 2
+			continue
+		}
+
+		marker, style, canOpen, canClose := delimiterAt(runes, i)
+		if marker == "" {
+			items = append(items, item{r: runes[i]})
+			i++
+			continue
+		}
+		n := len([]rune(marker))
+
+		// Close the innermost open span of the same style; spans opened
+		// inside it are left unmatched
+		closed := false
+		if canClose {
+			for j := len(open) - 1; j >= 0; j-- {
+				if items[open[j]].style == style {
+					items[open[j]].matched = true
+					items = append(items, item{marker: marker, style: style, matched: true})
+					open = open[:j]
+					closed = true
+					break
+				}
+			}
+		}
+		if !closed && canOpen && (style != styleCode || closingBacktick(runes, i+n)) {
+			open = append(open, len(items))
+			items = append(items, item{marker: marker, style: style})
+		} else if !closed {
+			items = append(items, item{marker: marker})
+		}
+		i += n
+
+		// Code is literal up to its closing backtick
+		if style == styleCode && !closed && len(open) > 0 && items[open[len(open)-1]].style == styleCode {
+			for i < len(runes) {
+				if marker, _, _, canClose := delimiterAt(runes, i); marker == "`" && canClose {
+					break
+				}
+				items = append(items, item{r: runes[i]})
+				i++
+			}
+		}
+	}
+
+	var chars []styledRune
+	var style inlineStyle
+	styled := false
+	for _, it := range items {
+		switch {
+		case it.matched:
+			style ^= it.style
+			styled = true
+		case it.marker != "":
+			for _, r := range it.marker {
+				chars = append(chars, styledRune{r, style})
+			}
+		default:
+			chars = append(chars, styledRune{it.r, style})
+		}
+	}
+	if !styled && !escaped {
+		return title
+	}
+	return encodeStyles(chars)
+}
+
+// delimiterAt returns the marker that starts at runes[i], if any, with
+// the style it marks and whether it can open or close a span. A marker
+// must not be part of a longer run of its character.
+func delimiterAt(runes []rune, i int) (marker string, style inlineStyle, canOpen, canClose bool) {
+	for _, d := range markupDelimiters {
+		m := []rune(d.marker)
+		end := i + len(m)
+		if end > len(runes) || string(runes[i:end]) != d.marker {
+			continue
+		}
+		if (i > 0 && runes[i-1] == m[0]) || (end < len(runes) && runes[end] == m[0]) {
+			return "", 0, false, false
+		}
+
+		before, after := ' ', ' '
+		if i > 0 {
+			before = runes[i-1]
+		}
+		if end < len(runes) {
+			after = runes[end]
+		}
+		canOpen = !unicode.IsSpace(after)
+		canClose = !unicode.IsSpace(before)
+		if d.style == styleItalic {
+			canOpen = canOpen && wordEdge(before)
+			canClose = canClose && wordEdge(after)
+		}
+		return d.marker, d.style, canOpen, canClose
+	}
+	return "", 0, false, false
+}
+
+// wordEdge reports whether r, next to an underscore, is outside a word
+func wordEdge(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// closingBacktick reports whether a backtick at or after runes[i] can
+// close a code span
+func closingBacktick(runes []rune, i int) bool {
+	for ; i < len(runes); i++ {
+		if marker, _, _, canClose := delimiterAt(runes, i); marker == "`" && canClose {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStyles joins the words of chars with single spaces, starting each
+// word plain and writing a style rune wherever the style changes
+func encodeStyles(chars []styledRune) string {
+	var b strings.Builder
+	inWord := false
+	var style inlineStyle
+	for _, c := range chars {
+		if unicode.IsSpace(c.r) {
+			inWord = false
+			continue
+		}
+		if !inWord {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			inWord = true
+			style = 0
+		}
+		if c.style != style {
+			b.WriteRune(styleRune(c.style))
+			style = c.style
+		}
+		b.WriteRune(c.r)
+	}
+	return b.String()
+}
+
+// textRun is a stretch of a line drawn in one style
+type textRun struct {
+	text  string
+	style inlineStyle
+}
+
+// splitRuns splits a line encoded by parseMarkup into runs of text in the
+// same style. A space between words takes the styles both words share, so
+// a highlight or code span runs on across it.
+func splitRuns(line string) []textRun {
+	var runs []textRun
+	add := func(text string, style inlineStyle) {
+		if text == "" {
+			return
+		}
+		if n := len(runs); n > 0 && runs[n-1].style == style {
+			runs[n-1].text += text
+			return
+		}
+		runs = append(runs, textRun{text, style})
+	}
+
+	var prev inlineStyle
+	for i, word := range strings.Split(line, " ") {
+		var style inlineStyle
+		if first, _ := utf8.DecodeRuneInString(word); isStyleRune(first) {
+			style = inlineStyle(first - styleRuneBase)
+		}
+		if i > 0 {
+			add(" ", prev&style)
+		}
+
+		start := 0
+		for j, r := range word {
+			if !isStyleRune(r) {
+				continue
+			}
+			add(word[start:j], style)
+			style = inlineStyle(r - styleRuneBase)
+			start = j + utf8.RuneLen(r)
+		}
+		add(word[start:], style)
+		prev = style
+	}
+	return runs
+}
+
+// inlineFonts are the font files a marked-up title is drawn with. Styles
+// without a font of their own are drawn in the title font, bold and
+// italic with faux bold and slanted glyphs.
+type inlineFonts struct {
+	title, bold, italic, code string
+}
+
+// face returns the font a style is drawn in and whether it is made bold or
+// italic by hand
+func (f inlineFonts) face(s inlineStyle) (path string, fauxBold, fauxItalic bool) {
+	bold, italic := s&styleBold != 0, s&styleItalic != 0
+	switch {
+	case s&styleCode != 0 && f.code != "":
+		return f.code, false, false
+	case italic && f.italic != "":
+		return f.italic, bold, false
+	case bold && f.bold != "":
+		return f.bold, false, italic
+	}
+	return f.title, bold, italic
+}
+
+// richText measures and draws the lines of a marked-up title, each run in
+// the face of its style. It restores the title face of dc after each use.
+type richText struct {
+	dc    *gg.Context
+	size  float64
+	fonts inlineFonts
+	faces map[string]font.Face
+	// rtl lays runs out right to left
+	rtl bool
+}
+
+// newRichText loads the faces of fonts at size
+func newRichText(dc *gg.Context, cache *fontCache, fonts inlineFonts, size float64) (*richText, error) {
+	t := &richText{dc: dc, size: size, fonts: fonts, faces: make(map[string]font.Face)}
+	for _, f := range []struct{ name, path string }{
+		{"title", fonts.title},
+		{"bold", fonts.bold},
+		{"italic", fonts.italic},
+		{"code", fonts.code},
+	} {
+		if f.path == "" || t.faces[f.path] != nil {
+			continue
+		}
+		face, err := cache.face(f.path, size)
+		if err != nil {
+			return nil, fmt.Errorf("load %s font: %w", f.name, err)
+		}
+		t.faces[f.path] = face
+	}
+	return t, nil
+}
+
+// setFace loads the face of style s into dc, returning it and whether it
+// is made bold or italic by hand
+func (t *richText) setFace(s inlineStyle) (face font.Face, fauxBold, fauxItalic bool) {
+	path, fauxBold, fauxItalic := t.fonts.face(s)
+	t.dc.SetFontFace(t.faces[path])
+	return t.faces[path], fauxBold, fauxItalic
+}
+
+// MeasureString returns the width of a line with each run measured in its
+// face, and the height of the title face
+func (t *richText) MeasureString(s string) (w, h float64) {
+	runs := splitRuns(s)
+	for i := range runs {
+		w += t.runWidth(runs, i)
+	}
+	t.setFace(0)
+	_, h = t.dc.MeasureString(s)
+	return w, h
+}
+
+// runWidth returns the width of runs[i], including the padding at the
+// ends of a code span
+func (t *richText) runWidth(runs []textRun, i int) float64 {
+	r := runs[i]
+	face, fauxBold, _ := t.setFace(r.style)
+	w := measureText(t.dc, face, r.text, t.rtl)
+	if fauxBold {
+		w += fauxBoldOffset * t.size
+	}
+	if r.style&styleCode != 0 {
+		if i == 0 || runs[i-1].style&styleCode == 0 {
+			w += codePadding * t.size
+		}
+		if i == len(runs)-1 || runs[i+1].style&styleCode == 0 {
+			w += codePadding * t.size
+		}
+	}
+	return w
+}
+
+// draw draws a line from x on baseline y: the highlight and code
+// backgrounds, then the shadow and text of each run in its face. The runs
+// of a right-to-left title are drawn in reverse order.
+func (t *richText) draw(colors palette, line string, x, y float64) {
+	runs := splitRuns(line)
+	if t.rtl {
+		slices.Reverse(runs)
+	}
+	xs := make([]float64, len(runs)+1)
+	xs[0] = x
+	for i := range runs {
+		xs[i+1] = xs[i] + t.runWidth(runs, i)
+	}
+
+	top := y - markupAscent*t.size
+	h := (markupAscent + markupDescent) * t.size
+	dc := t.dc
+	dc.SetColor(colors.highlight)
+	spans(runs, xs, styleHighlight, func(left, right float64) {
+		bleed := highlightBleed * t.size
+		drawRoundedRect(dc, left-bleed, top, right-left+2*bleed, h, bleed, bleed)
+		dc.Fill()
+	})
+	dc.SetColor(codeFill(colors.text))
+	spans(runs, xs, styleCode, func(left, right float64) {
+		drawRoundedRect(dc, left, top, right-left, h, codeRadius*t.size, codeRadius*t.size)
+		dc.Fill()
+	})
+
+	t.drawRuns(runs, xs, y, ShadowOffset, colors.shadow)
+	t.drawRuns(runs, xs, y, 0, colors.text)
+	t.setFace(0)
+}
+
+// drawRuns draws the text of each run in c, offset by d
+func (t *richText) drawRuns(runs []textRun, xs []float64, y, d float64, c color.Color) {
+	dc := t.dc
+	dc.SetColor(c)
+	for i, r := range runs {
+		left := xs[i] + d
+		if r.style&styleCode != 0 && (i == 0 || runs[i-1].style&styleCode == 0) {
+			left += codePadding * t.size
+		}
+		face, fauxBold, fauxItalic := t.setFace(r.style)
+		if fauxItalic {
+			dc.Push()
+			dc.ShearAbout(-fauxItalicSlant, 0, left, y+d)
+		}
+		drawText(dc, face, r.text, t.rtl, left, y+d)
+		if fauxBold {
+			drawText(dc, face, r.text, t.rtl, left+fauxBoldOffset*t.size, y+d)
+		}
+		// Color emoji cast no shadow
+		if d == 0 {
+			drawEmoji(dc, face, r.text, t.rtl, left, y)
+		}
+		if fauxItalic {
+			dc.Pop()
+		}
+	}
+}
+
+// spans calls fn with the left and right edges of each stretch of runs
+// that are all in style s
+func spans(runs []textRun, xs []float64, s inlineStyle, fn func(left, right float64)) {
+	for i := 0; i < len(runs); {
+		if runs[i].style&s == 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runs) && runs[j].style&s != 0 {
+			j++
+		}
+		fn(xs[i], xs[j])
+		i = j
+	}
+}
+
+// codeFill is the background of code: the text color, mostly transparent
+func codeFill(text color.Color) color.Color {
+	c := color.NRGBAModel.Convert(text).(color.NRGBA)
+	c.A /= 5
+	return c
+}
@@ -0,0 +1,213 @@
+package ogimage
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// showStyles writes the style runes in s as [b], [i], [c], [h] or a
+// combination of them, and [] for plain
+func showStyles(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !isStyleRune(r) {
+			b.WriteRune(r)
+			continue
+		}
+		style := inlineStyle(r - styleRuneBase)
+		b.WriteByte('[')
+		for i, c := range "bich" {
+			if style&(1<<i) != 0 {
+				b.WriteRune(c)
+			}
+		}
+		b.WriteByte(']')
+	}
+	return b.String()
+}
+
+func TestParseMarkup(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Plain title", "Plain title"},
+		{"Why **Go** wins", "Why [b]Go wins"},
+		{"A _very_ fast ==build cache==", "A [i]very fast [h]build [h]cache"},
+		{"Run `go build ./...` now", "Run [c]go [c]build [c]./... now"},
+		{"**Bold and _italic_**", "[b]Bold [b]and [bi]italic"},
+		{"**Go**, mostly", "[b]Go[], mostly"},
+		{"half**way**there", "half[b]way[]there"},
+		{"Inside `**code**` markers stay", "Inside [c]**code** markers stay"},
+
+		// Left as text
+		{"snake_case_names stay", "snake_case_names stay"},
+		{"__init__ methods", "__init__ methods"},
+		{"x == y and a ** b", "x == y and a ** b"},
+		{"Unmatched **bold", "Unmatched **bold"},
+		{"Unmatched `code", "Unmatched `code"},
+		{"*** rule", "*** rule"},
+		{`Escaped \**not bold\**`, "Escaped **not bold**"},
+		{"Icon \ue001 glyphs stay", "Icon \ue001 glyphs stay"},
+		{"Stray \ufdd1style runes", "Stray style runes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := showStyles(parseMarkup(tt.title)); got != tt.want {
+				t.Errorf("parseMarkup(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRuns(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Plain title", "Plain title"},
+		{"Why **Go** wins", "Why |[b]Go| wins"},
+		{"A ==build cache== hit", "A |[h]build cache| hit"},
+		{"**Bold and _italic_**", "[b]Bold and |[bi]italic"},
+		{"**Go**, mostly", "[b]Go|, mostly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var parts []string
+			for _, r := range splitRuns(parseMarkup(tt.title)) {
+				text := r.text
+				if r.style != 0 {
+					text = showStyles(string(styleRune(r.style))) + text
+				}
+				parts = append(parts, text)
+			}
+			if got := strings.Join(parts, "|"); got != tt.want {
+				t.Errorf("splitRuns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRichText(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
+		t.Fatal(err)
+	}
+	text, err := newRichText(dc, &fontCache{}, inlineFonts{title: fontPath}, TitleFontSize)
+	if err != nil {
+		t.Fatalf("newRichText() error: %v", err)
+	}
+	width := func(s string) float64 {
+		w, _ := text.MeasureString(parseMarkup(s))
+		return w
+	}
+
+	plain, _ := dc.MeasureString("Hello world")
+	if w := width("Hello world"); w != plain {
+		t.Errorf("plain width = %g, want %g", w, plain)
+	}
+	if w := width("**Hello** world"); w <= plain {
+		t.Errorf("faux bold width = %g, want wider than %g", w, plain)
+	}
+	if w, want := width("`Hello world`"), plain+2*codePadding*TitleFontSize; w != want {
+		t.Errorf("code width = %g, want %g with the padding at both ends only", w, want)
+	}
+	if _, h := text.MeasureString(parseMarkup("**Hello**")); h != measureFontHeight(dc) {
+		t.Errorf("height = %g, want the title font's %g", h, measureFontHeight(dc))
+	}
+
+	t.Run("wraps styled words", func(t *testing.T) {
+		title := parseMarkup("Speed up ==every **single** build== with `go build -cache` and hyphenated Donaudampfschifffahrtsgesellschaft")
+		style := titleStyle{wrap: WrapGreedy, hyphenate: HyphenateGerman}
+		lines := wrapLines(text, title, 500, style)
+		for _, line := range lines {
+			if w, _ := text.MeasureString(line); w > 500 {
+				t.Errorf("line %q is %g wide, want at most 500", showStyles(line), w)
+			}
+			for _, run := range splitRuns(line) {
+				if strings.Contains(run.text, "build") && run.style&(styleHighlight|styleCode) == 0 {
+					t.Errorf("line %q lost the style of %q", showStyles(line), run.text)
+				}
+			}
+		}
+		plain := strings.NewReplacer("-", "", " ", "").Replace(strings.Join(lines, ""))
+		plain = strings.Map(func(r rune) rune {
+			if isStyleRune(r) {
+				return -1
+			}
+			return r
+		}, plain)
+		if want := "Speedupeverysinglebuildwithgobuildcacheandhyphenated"; !strings.HasPrefix(plain, want) {
+			t.Errorf("wrapLines() = %q, want the text of the title", plain)
+		}
+	})
+
+	t.Run("broken word keeps its style", func(t *testing.T) {
+		pieces := breakWord(text, parseMarkup("**Donaudampfschifffahrtsgesellschaft**"), 400, loadHyphenator(HyphenateGerman))
+		if len(pieces) < 2 {
+			t.Fatalf("breakWord() = %q, want the word broken", pieces)
+		}
+		for _, p := range pieces {
+			if !strings.HasPrefix(showStyles(p), "[b]") {
+				t.Errorf("piece %q is not bold", showStyles(p))
+			}
+		}
+	})
+
+	t.Run("missing font", func(t *testing.T) {
+		_, err := newRichText(dc, &fontCache{}, inlineFonts{title: fontPath, code: "/nonexistent/mono.ttf"}, TitleFontSize)
+		if err == nil || !strings.Contains(err.Error(), "load code font") {
+			t.Errorf("newRichText() error = %v, want code font error", err)
+		}
+	})
+}
+
+func TestRenderMarkup(t *testing.T) {
+	fontPath := testFontPath(t)
+	render := func(title string) image.Image {
+		t.Helper()
+		img, err := NewRenderer().Render(context.Background(), Options{
+			Title:     title,
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			Theme:     Theme{Background: "#000000", Overlay: "#000000", OverlayOpacity: 1, Highlight: "#ff0000"},
+		})
+		if err != nil {
+			t.Fatalf("Render() error: %v", err)
+		}
+		return img
+	}
+	// red counts the highlight colored pixels
+	red := func(img image.Image) int {
+		n := 0
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if r, g, b, _ := img.At(x, y).RGBA(); r == 0xffff && g == 0 && b == 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	if n := red(render("Hello world")); n != 0 {
+		t.Fatalf("%d highlight pixels without markup", n)
+	}
+	if red(render("Hello ==world==")) == 0 {
+		t.Error("no highlight behind ==world==")
+	}
+
+	_, err := NewRenderer().Render(context.Background(), Options{Title: "**T**", URL: "U", TitleFont: fontPath, URLFont: fontPath, BoldFont: "/nonexistent/bold.ttf"})
+	if err == nil || !strings.Contains(err.Error(), "load bold font") {
+		t.Errorf("Render() error = %v, want bold font error", err)
+	}
+}
@@ -0,0 +1,427 @@
+// Package ogimage renders Open Graph social images: a title and URL laid out
+// on a baseline grid over a colored background.
+package ogimage
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// Typographic constants
+const (
+	// Image dimensions
+	DefaultWidth  = 1200
+	DefaultHeight = 628
+
+	// Font sizes
+	TitleFontSize  = 72.0
+	URLFontSize    = 40.0
+	URLMinFontSize = 16.0
+
+	// SubtitleFontSize is the size of the subtitle, drawn in the title
+	// font, and BylineFontSize that of the author and date, drawn in the
+	// URL font
+	SubtitleFontSize = 40.0
+	BylineFontSize   = 32.0
+	// SubtitleMaxLines is the number of lines the subtitle is cut to
+	SubtitleMaxLines = 2
+
+	// TagFontSize is the size of the tag labels, drawn in the URL font.
+	// Each pill pads its label by TagPaddingX and TagPaddingY, and pills
+	// and rows of pills are TagGap apart.
+	TagFontSize = 24.0
+	TagPaddingX = 14.0
+	TagPaddingY = 8.0
+	TagGap      = 10.0
+
+	// TitleMinFontSize is the smallest size TitleFit shrinks the title to
+	TitleMinFontSize = 32.0
+
+	// Spacing and margins
+	TextTopMargin  = 135.0
+	TextSideMargin = 60.0
+	LineSpacing    = 1.5
+	ShadowOffset   = 2.0
+
+	// Background
+	BackgroundMargin       = 20.0
+	BackgroundCornerRadius = 20.0
+)
+
+// debugColor is the color of the debug baselines
+var debugColor = color.RGBA{255, 0, 0, 255}
+
+// Options holds the configuration for image generation.
+// Zero values for Width, Height and TitleSize fall back to the defaults,
+// and the zero Theme is DarkTheme. BgColor, if set, overrides the theme's
+// background.
+type Options struct {
+	// Title may mark spans as **bold**, _italic_, `code` or ==highlight==,
+	// which wrap like the rest of the title. Bold, italic and code are
+	// drawn in BoldFont, ItalicFont and CodeFont if set, and otherwise in
+	// the title font, made bold or slanted by hand; code is set on a tinted
+	// background and highlights on the theme's Highlight color. A
+	// backslash keeps a marker as text.
+	Title string
+	URL   string
+	// Subtitle is wrapped below the title in a smaller size and the URL
+	// color, and Author and Date are joined on a line after it. They take
+	// grid lines from the title, so TitleFit shrinks the title to make
+	// room for them.
+	Subtitle string
+	Author   string
+	Date     string
+	// Tags are drawn as rounded pills in the top margin above the title,
+	// or beside the URL if TagPosition is TagsBeside (TagsAbove if empty).
+	// Pills are TagColor, or the theme's URL color if it is empty, unless
+	// TagColors has a color for the tag, keyed by tag in any case. Tags
+	// that don't fit are counted on a final "+N" pill.
+	Tags        []string
+	TagPosition string
+	TagColor    string
+	TagColors   map[string]string
+
+	Width   int
+	Height  int
+	BgColor string
+	Theme   Theme
+
+	// TitleFont and URLFont are each a font or a comma-separated list of
+	// fonts. Characters are drawn in the first font of the list with a
+	// glyph for them, then in the first of the renderer's fallback fonts
+	// that has one.
+	TitleFont string
+	URLFont   string
+	TitleSize float64
+	Debug     bool
+
+	// TitleWeight, if set, is the weight of a variable title font, from 1
+	// to 1000, and TitleAxes sets its other design axes by tag, such as
+	// "wdth" for width or "opsz" for optical size. They apply to the
+	// fonts of the TitleFont list that have those axes; static fonts
+	// ignore them.
+	TitleWeight float64
+	TitleAxes   map[string]float64
+
+	BoldFont   string
+	ItalicFont string
+	CodeFont   string
+
+	// TitleFit picks the largest title size from TitleMaxSize (TitleSize
+	// if zero) down to TitleMinSize (TitleMinFontSize if zero) at which
+	// the wrapped title fits above the URL, instead of using TitleSize
+	TitleFit     bool
+	TitleMinSize float64
+	TitleMaxSize float64
+
+	// MaxLines, if positive, cuts the wrapped title to that many lines and
+	// ends the last one with an ellipsis
+	MaxLines int
+	// Wrap is how the title is broken into lines: WrapGreedy (if empty)
+	// or WrapBalanced
+	Wrap string
+	// Hyphenate, if set to HyphenateEnglish or HyphenateGerman, hyphenates
+	// words too wide for a line of their own with that language's
+	// patterns. Such words that are camelCase or snake_case identifiers are
+	// broken at their boundaries whether or not it is set.
+	Hyphenate string
+
+	// Align places each title line between the side margins, and VAlign
+	// the title block on the baseline grid: AlignLeft (AlignRight for a
+	// right-to-left title) and VAlignTop if empty. URLAlign and URLVAlign
+	// do the same for the URL line, which defaults to the same alignment
+	// on the bottom grid line. The title keeps to the grid lines above the
+	// URL, or below it if the URL is at the top.
+	Align     string
+	VAlign    string
+	URLAlign  string
+	URLVAlign string
+
+	// BgImage is the path of a PNG, JPEG, GIF or WebP image drawn over
+	// the background color, scaled by BgFit (FitCover if empty). BgBlur
+	// blurs it by a radius in pixels and BgDarken, from 0 to 1, darkens it.
+	BgImage  string
+	BgFit    string
+	BgBlur   float64
+	BgDarken float64
+
+	// Logo is drawn in a corner of the card if its Path is set
+	Logo Logo
+}
+
+// withDefaults returns a copy of opts with zero values replaced by defaults
+func (opts Options) withDefaults() Options {
+	if opts.Width == 0 {
+		opts.Width = DefaultWidth
+	}
+	if opts.Height == 0 {
+		opts.Height = DefaultHeight
+	}
+	if opts.TitleSize == 0 {
+		opts.TitleSize = TitleFontSize
+	}
+	if opts.TitleMinSize == 0 {
+		opts.TitleMinSize = TitleMinFontSize
+	}
+	if opts.TitleMaxSize == 0 {
+		opts.TitleMaxSize = opts.TitleSize
+	}
+	if opts.Wrap == "" {
+		opts.Wrap = WrapGreedy
+	}
+	if opts.Align == "" {
+		opts.Align = defaultAlign(opts.Title)
+	}
+	if opts.VAlign == "" {
+		opts.VAlign = VAlignTop
+	}
+	if opts.URLAlign == "" {
+		opts.URLAlign = defaultAlign(opts.Title)
+	}
+	if opts.URLVAlign == "" {
+		opts.URLVAlign = VAlignBottom
+	}
+	if opts.TagPosition == "" {
+		opts.TagPosition = TagsAbove
+	}
+	if opts.BgFit == "" {
+		opts.BgFit = FitCover
+	}
+	opts.Logo = opts.Logo.withDefaults()
+	opts.Theme = opts.Theme.withDefaults()
+	if opts.BgColor != "" {
+		opts.Theme.Background = opts.BgColor
+	}
+	return opts
+}
+
+// Renderer draws social images. The zero value is ready to use.
+// A Renderer caches parsed fonts, so reuse one across renders; it is safe
+// for concurrent use.
+type Renderer struct {
+	// ResolveFont maps the TitleFont, URLFont, BoldFont, ItalicFont and
+	// CodeFont options to font file paths. If nil, ResolveFontPath is used.
+	ResolveFont FontResolver
+
+	// FallbackFonts are the font files tried, in order, for characters
+	// none of the title or URL fonts has. If nil, FallbackFontPaths is used.
+	FallbackFonts []string
+
+	// Logf, if set, is called with details of each render, such as the
+	// title size chosen by TitleFit
+	Logf func(format string, args ...any)
+
+	fonts fontCache
+}
+
+// NewRenderer returns a Renderer that resolves fonts with ResolveFontPath
+func NewRenderer() *Renderer {
+	return &Renderer{ResolveFont: ResolveFontPath}
+}
+
+// resolveFonts resolves each font of a comma-separated list and returns
+// them, set to the axes of the resolver and then axes if they are
+// variable, as a chain with the fallback fonts needed to draw texts
+func (r *Renderer) resolveFonts(resolver FontResolver, list string, axes map[string]float64, texts ...string) (string, error) {
+	var paths []string
+	for _, name := range strings.Split(list, ",") {
+		path, fontAxes, err := resolver(strings.TrimSpace(name))
+		if err != nil {
+			return "", err
+		}
+		paths = append(paths, withFontAxes(withFontAxes(path, fontAxes), axes))
+	}
+	fallbacks := r.FallbackFonts
+	if fallbacks == nil {
+		fallbacks = FallbackFontPaths()
+	}
+	return r.fonts.chain(paths, fallbacks, texts...), nil
+}
+
+// Render draws the image described by opts
+func (r *Renderer) Render(ctx context.Context, opts Options) (image.Image, error) {
+	opts = opts.withDefaults()
+
+	colors, err := opts.Theme.palette()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d: want a positive width and height", opts.Width, opts.Height)
+	}
+	for _, size := range []struct {
+		name  string
+		value float64
+	}{
+		{"title size", opts.TitleSize},
+		{"title min size", opts.TitleMinSize},
+		{"title max size", opts.TitleMaxSize},
+	} {
+		if !(size.value > 0) || math.IsInf(size.value, 0) {
+			return nil, fmt.Errorf("invalid %s %g: want a positive number", size.name, size.value)
+		}
+	}
+	if opts.Wrap != WrapGreedy && opts.Wrap != WrapBalanced {
+		return nil, fmt.Errorf("unknown wrap mode %q: want %s or %s", opts.Wrap, WrapGreedy, WrapBalanced)
+	}
+	if opts.Hyphenate != "" && loadHyphenator(opts.Hyphenate) == nil {
+		return nil, fmt.Errorf("unknown hyphenation language %q: want %s or %s", opts.Hyphenate, HyphenateEnglish, HyphenateGerman)
+	}
+	for _, align := range []string{opts.Align, opts.URLAlign} {
+		if !validAlign(align) {
+			return nil, fmt.Errorf("unknown align %q: want %s, %s or %s", align, AlignLeft, AlignCenter, AlignRight)
+		}
+	}
+	for _, valign := range []string{opts.VAlign, opts.URLVAlign} {
+		if !validVAlign(valign) {
+			return nil, fmt.Errorf("unknown valign %q: want %s, %s or %s", valign, VAlignTop, VAlignMiddle, VAlignBottom)
+		}
+	}
+	if opts.TagPosition != TagsAbove && opts.TagPosition != TagsBeside {
+		return nil, fmt.Errorf("unknown tag position %q: want %s or %s", opts.TagPosition, TagsAbove, TagsBeside)
+	}
+	style := titleStyle{
+		wrap:      opts.Wrap,
+		maxLines:  opts.MaxLines,
+		hyphenate: opts.Hyphenate,
+		align:     opts.Align,
+		valign:    opts.VAlign,
+		urlVAlign: opts.URLVAlign,
+	}
+
+	bgImage, err := loadBackgroundImage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	logo, err := loadLogo(opts.Logo, opts.Width, opts.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := r.ResolveFont
+	if resolver == nil {
+		resolver = ResolveFontPath
+	}
+
+	titleAxes, err := opts.titleAxes()
+	if err != nil {
+		return nil, err
+	}
+	titleFontPath, err := r.resolveFonts(resolver, opts.TitleFont, titleAxes, opts.Title, opts.Subtitle)
+	if err != nil {
+		return nil, err
+	}
+
+	urlFontPath, err := r.resolveFonts(resolver, opts.URLFont, nil, opts.URL, opts.Author, opts.Date, strings.Join(opts.Tags, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := newTagSet(opts, colors, urlFontPath)
+	if err != nil {
+		return nil, err
+	}
+
+	title := parseMarkup(opts.Title)
+	if hasStyles(title) {
+		inline := inlineFonts{title: titleFontPath}
+		for _, f := range []struct {
+			name string
+			path *string
+		}{
+			{opts.BoldFont, &inline.bold},
+			{opts.ItalicFont, &inline.italic},
+			{opts.CodeFont, &inline.code},
+		} {
+			if f.name == "" {
+				continue
+			}
+			path, axes, err := resolver(f.name)
+			if err != nil {
+				return nil, err
+			}
+			// Styled runs fall back like the rest of the title
+			*f.path = fontChain(append([]string{withFontAxes(path, axes)}, splitFontChain(titleFontPath)[1:]...)...)
+		}
+		style.fonts = &inline
+	}
+	style.rtl = isRTL(opts.Title)
+	style.shape = needsShaping(opts.Title)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dc := gg.NewContext(opts.Width, opts.Height)
+
+	subtitle, err := layoutSubtitle(dc, &r.fonts, opts.Subtitle, opts.Author, opts.Date, titleFontPath, urlFontPath, opts.Width)
+	if err != nil {
+		return nil, err
+	}
+	style.reserve = subtitle.gridLines()
+
+	if opts.TitleFit {
+		if opts.TitleMinSize > opts.TitleMaxSize {
+			return nil, fmt.Errorf("title min size %g is larger than max size %g", opts.TitleMinSize, opts.TitleMaxSize)
+		}
+		size, err := fitTitleSize(dc, &r.fonts, title, titleFontPath, opts.Width, opts.Height, opts.TitleMinSize, opts.TitleMaxSize, style, logo.bounds())
+		if err != nil {
+			return nil, err
+		}
+		opts.TitleSize = size
+		if r.Logf != nil {
+			r.Logf("title size %gpt: %s", size, opts.Title)
+		}
+	}
+
+	drawBackground(dc, colors, bgImage, opts.Width, opts.Height)
+	if logo != nil {
+		logo.draw(dc)
+	}
+
+	layout, err := drawTitle(dc, &r.fonts, colors, title, titleFontPath, opts.Width, opts.Height, opts.TitleSize, style, logo.bounds())
+	if err != nil {
+		return nil, err
+	}
+	if err := subtitle.draw(dc, &r.fonts, colors, layout, opts.Width, logo.bounds()); err != nil {
+		return nil, err
+	}
+	if err := tags.drawAbove(dc, &r.fonts, layout, opts.URLVAlign, opts.Width, logo.bounds()); err != nil {
+		return nil, err
+	}
+	if r.Logf != nil {
+		if layout.clamped {
+			r.Logf("title clamped to %d lines: %s", opts.MaxLines, opts.Title)
+		}
+		if len(layout.lines) > 0 && !layout.fits() {
+			r.Logf("title runs into the URL: %s", opts.Title)
+		}
+	}
+
+	if opts.Debug {
+		// Load font to get metrics for debug baselines
+		if err := r.fonts.loadFontFace(dc, titleFontPath, opts.TitleSize); err != nil {
+			return nil, fmt.Errorf("load font for debug: %w", err)
+		}
+		fontHeight := measureFontHeight(dc)
+		drawDebugBaselines(dc, fontHeight, LineSpacing, TextTopMargin, opts.Width, opts.Height)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := drawURL(dc, &r.fonts, colors, opts.URL, titleFontPath, urlFontPath, opts.Width, opts.Height, opts.TitleSize, opts.URLAlign, opts.URLVAlign, tags, logo.bounds()); err != nil {
+		return nil, err
+	}
+
+	return dc.Image(), nil
+}
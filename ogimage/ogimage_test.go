@@ -0,0 +1,425 @@
+package ogimage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("defaults applied for zero dimensions", func(t *testing.T) {
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if img.Bounds().Dx() != DefaultWidth || img.Bounds().Dy() != DefaultHeight {
+			t.Errorf("unexpected image dimensions: got %dx%d, want %dx%d",
+				img.Bounds().Dx(), img.Bounds().Dy(), DefaultWidth, DefaultHeight)
+		}
+	})
+
+	t.Run("custom dimensions", func(t *testing.T) {
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			Width:     800,
+			Height:    400,
+			BgColor:   "#ff5500",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			Debug:     true,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if img.Bounds().Dx() != 800 || img.Bounds().Dy() != 400 {
+			t.Errorf("unexpected image dimensions: got %dx%d, want 800x400",
+				img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	})
+
+	t.Run("background image", func(t *testing.T) {
+		bgPath := writeTestImage(t, t.TempDir(), ".png", 40, 20, color.RGBA{255, 0, 0, 255})
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			Width:     400,
+			Height:    200,
+			BgImage:   bgPath,
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		// The margin outside the overlay shows the image, not the background color
+		if r, g, _, _ := img.At(2, 2).RGBA(); r>>8 != 255 || g>>8 != 0 {
+			t.Errorf("corner pixel = %v, want red", img.At(2, 2))
+		}
+	})
+
+	t.Run("invalid background image", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:   "Test Title",
+			URL:     "https://example.com",
+			BgImage: "missing.png",
+		})
+		if err == nil || !strings.Contains(err.Error(), "load background image") {
+			t.Errorf("expected background image error, got %v", err)
+		}
+	})
+
+	t.Run("logo", func(t *testing.T) {
+		logoPath := writeTestImage(t, t.TempDir(), ".png", 40, 40, color.RGBA{0, 255, 0, 255})
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			Logo:      Logo{Path: logoPath, Position: LogoTopRight},
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		x, y := DefaultWidth-int(DefaultLogoPadding)-1, int(DefaultLogoPadding)
+		if r, g, _, _ := img.At(x, y).RGBA(); r>>8 != 0 || g>>8 != 255 {
+			t.Errorf("logo pixel = %v, want green", img.At(x, y))
+		}
+	})
+
+	t.Run("title fit reports size", func(t *testing.T) {
+		var logged []string
+		r := NewRenderer()
+		r.Logf = func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+		_, err := r.Render(context.Background(), Options{
+			Title:        "Test Title",
+			URL:          "https://example.com",
+			TitleFont:    fontPath,
+			URLFont:      fontPath,
+			TitleFit:     true,
+			TitleMaxSize: 90,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if len(logged) != 1 || logged[0] != "title size 90pt: Test Title" {
+			t.Errorf("logged %q, want one line with size 90", logged)
+		}
+	})
+
+	t.Run("max lines reports clamping", func(t *testing.T) {
+		var logged []string
+		r := NewRenderer()
+		r.Logf = func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+		_, err := r.Render(context.Background(), Options{
+			Title:     "This is a very long title that should wrap across multiple lines in the image",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			MaxLines:  1,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if len(logged) != 1 || !strings.HasPrefix(logged[0], "title clamped to 1 lines") {
+			t.Errorf("logged %q, want clamping message", logged)
+		}
+	})
+
+	t.Run("overflowing title is reported", func(t *testing.T) {
+		var logged []string
+		r := NewRenderer()
+		r.Logf = func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+		_, err := r.Render(context.Background(), Options{
+			Title:     strings.Repeat("Overflowing title words ", 12),
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if len(logged) != 1 || !strings.HasPrefix(logged[0], "title runs into the URL") {
+			t.Errorf("logged %q, want overflow message", logged)
+		}
+	})
+
+	t.Run("balanced wrap", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:     "This is a very long title that should wrap across multiple lines in the image",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+			Wrap:      WrapBalanced,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid sizes", func(t *testing.T) {
+		for _, opts := range []Options{
+			{TitleSize: math.NaN()},
+			{TitleSize: math.Inf(1)},
+			{TitleSize: -10},
+			{TitleMinSize: math.NaN()},
+			{Width: -1},
+			{Height: -628},
+		} {
+			opts.Title, opts.URL, opts.TitleFont, opts.URLFont = "Test", "https://example.com", fontPath, fontPath
+			if _, err := NewRenderer().Render(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("Render(%+v) error = %v, want an invalid size", opts, err)
+			}
+		}
+	})
+
+	t.Run("tiny title size", func(t *testing.T) {
+		// Rounds to a line height of zero, which must not stall the grid
+		r := NewRenderer()
+		opts := Options{Title: "Test", URL: "https://example.com", TitleFont: fontPath, URLFont: fontPath, TitleSize: 0.01}
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("unknown wrap", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{Title: "Test", URL: "https://example.com", Wrap: "optimal"})
+		if err == nil || !strings.Contains(err.Error(), `unknown wrap mode "optimal"`) {
+			t.Errorf("expected wrap error, got %v", err)
+		}
+	})
+
+	t.Run("unknown align", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{Title: "Test", URL: "https://example.com", URLAlign: "justify"})
+		if err == nil || !strings.Contains(err.Error(), `unknown align "justify"`) {
+			t.Errorf("expected align error, got %v", err)
+		}
+		_, err = r.Render(context.Background(), Options{Title: "Test", URL: "https://example.com", VAlign: "center"})
+		if err == nil || !strings.Contains(err.Error(), `unknown valign "center"`) {
+			t.Errorf("expected valign error, got %v", err)
+		}
+	})
+
+	t.Run("unknown hyphenation language", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{Title: "Test", URL: "https://example.com", Hyphenate: "fr"})
+		if err == nil || !strings.Contains(err.Error(), `unknown hyphenation language "fr"`) {
+			t.Errorf("expected hyphenation error, got %v", err)
+		}
+	})
+
+	t.Run("title fit min larger than max", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:        "Test Title",
+			URL:          "https://example.com",
+			TitleFont:    fontPath,
+			URLFont:      fontPath,
+			TitleFit:     true,
+			TitleMinSize: 80,
+			TitleMaxSize: 40,
+		})
+		if err == nil || !strings.Contains(err.Error(), "larger than max size") {
+			t.Errorf("expected min/max error, got %v", err)
+		}
+	})
+
+	t.Run("zero value renderer uses default resolver", func(t *testing.T) {
+		var r Renderer
+		_, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Errorf("Render() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid font file", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: "/nonexistent/font.ttf",
+			URLFont:   fontPath,
+		})
+		if err == nil {
+			t.Fatal("expected error for invalid font path")
+		}
+		if !strings.Contains(err.Error(), "load font") {
+			t.Errorf("expected 'load font' error, got: %v", err)
+		}
+	})
+
+	t.Run("theme colors", func(t *testing.T) {
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			Theme:     LightTheme,
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		// Outside the overlay the background is the theme's
+		if got, want := color.NRGBAModel.Convert(img.At(5, 5)), mustParseColor(t, LightTheme.Background); got != want {
+			t.Errorf("background pixel = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("bg color overrides theme background", func(t *testing.T) {
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			BgColor:   "#ff0000",
+			Theme:     LightTheme,
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if got := color.RGBAModel.Convert(img.At(5, 5)); got != (color.RGBA{255, 0, 0, 255}) {
+			t.Errorf("background pixel = %v, want red", got)
+		}
+	})
+
+	t.Run("gradient background", func(t *testing.T) {
+		r := NewRenderer()
+		img, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			BgColor:   "linear-gradient(to right, #ff0000, #0000ff)",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		left := color.RGBAModel.Convert(img.At(2, 5)).(color.RGBA)
+		right := color.RGBAModel.Convert(img.At(DefaultWidth-3, 5)).(color.RGBA)
+		if left.R < 240 || left.B > 15 || right.B < 240 || right.R > 15 {
+			t.Errorf("edge pixels = %v, %v, want red then blue", left, right)
+		}
+	})
+
+	t.Run("invalid gradient", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			BgColor:   "linear-gradient(#ff0000)",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err == nil || !strings.Contains(err.Error(), "background: invalid gradient") {
+			t.Errorf("expected invalid gradient error, got %v", err)
+		}
+	})
+
+	t.Run("invalid color", func(t *testing.T) {
+		r := NewRenderer()
+		_, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			BgColor:   "#1a1a2",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if err == nil || !strings.Contains(err.Error(), `background color: invalid color "#1a1a2"`) {
+			t.Errorf("expected invalid color error, got %v", err)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r := NewRenderer()
+		_, err := r.Render(ctx, Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: fontPath,
+			URLFont:   fontPath,
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestRenderResolverOrder(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("title font resolved first", func(t *testing.T) {
+		var requested []string
+		r := &Renderer{ResolveFont: func(customFont string) (string, map[string]float64, error) {
+			requested = append(requested, customFont)
+			return fontPath, nil, nil
+		}}
+
+		_, err := r.Render(context.Background(), Options{
+			Title:     "Test Title",
+			URL:       "https://example.com",
+			TitleFont: "title.ttf",
+			URLFont:   "url.ttf",
+		})
+		if err != nil {
+			t.Fatalf("Render() unexpected error: %v", err)
+		}
+		if len(requested) != 2 || requested[0] != "title.ttf" || requested[1] != "url.ttf" {
+			t.Errorf("resolver called with %v, want [title.ttf url.ttf]", requested)
+		}
+	})
+
+	t.Run("resolver error is returned", func(t *testing.T) {
+		r := &Renderer{ResolveFont: func(customFont string) (string, map[string]float64, error) {
+			return "", nil, fmt.Errorf("font not found")
+		}}
+
+		_, err := r.Render(context.Background(), Options{Title: "Test", URL: "https://example.com"})
+		if err == nil || !strings.Contains(err.Error(), "font not found") {
+			t.Errorf("expected resolver error, got %v", err)
+		}
+	})
+}
+
+// mustParseColor parses a color that the test expects to be valid
+func mustParseColor(t *testing.T, s string) color.NRGBA {
+	t.Helper()
+	c, err := ParseColor(s)
+	if err != nil {
+		t.Fatalf("ParseColor(%q) error: %v", s, err)
+	}
+	return c
+}
@@ -0,0 +1,175 @@
+package ogimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// fontTable reads big-endian values from font table data, returning zero past
+// its end so that malformed fonts read as empty rather than panic
+type fontTable []byte
+
+func (b fontTable) u8(i int) int {
+	if i < 0 || i >= len(b) {
+		return 0
+	}
+	return int(b[i])
+}
+
+func (b fontTable) i8(i int) int { return int(int8(b.u8(i))) }
+
+func (b fontTable) u16(i int) int {
+	if i < 0 || i+2 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b[i:]))
+}
+
+func (b fontTable) i16(i int) int { return int(int16(b.u16(i))) }
+
+func (b fontTable) u32(i int) int {
+	if i < 0 || i+4 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b[i:]))
+}
+
+// span returns n bytes from i, or nil if they run past the end
+func (b fontTable) span(i, n int) fontTable {
+	if i < 0 || n < 0 || i+n > len(b) {
+		return nil
+	}
+	return b[i : i+n]
+}
+
+// sfntTables returns the tables of a font by tag
+func sfntTables(data []byte) (map[string]fontTable, error) {
+	b := fontTable(data)
+	offset := 0
+	if string(b.span(0, 4)) == "ttcf" {
+		offset = b.u32(12)
+	}
+	n := b.u16(offset + 4)
+	if n == 0 {
+		return nil, errors.New("not a font file")
+	}
+	tables := make(map[string]fontTable)
+	for i := range n {
+		rec := offset + 12 + 16*i
+		tag := string(b.span(rec, 4))
+		if t := b.span(b.u32(rec+8), b.u32(rec+12)); t != nil {
+			tables[tag] = t
+		}
+	}
+	return tables, nil
+}
+
+// writeSfnt assembles tables into a font file with the given version:
+// 0x00010000 for TrueType outlines or "OTTO" for CFF
+func writeSfnt(version uint32, tables map[string]fontTable) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+
+	n := len(tags)
+	entrySelector := bits.Len(uint(n)) - 1
+	searchRange := 16 << max(entrySelector, 0)
+	out := binary.BigEndian.AppendUint32(nil, version)
+	out = binary.BigEndian.AppendUint16(out, uint16(n))
+	out = binary.BigEndian.AppendUint16(out, uint16(searchRange))
+	out = binary.BigEndian.AppendUint16(out, uint16(max(entrySelector, 0)))
+	out = binary.BigEndian.AppendUint16(out, uint16(16*n-searchRange))
+
+	// Tables start on four byte boundaries, after the table records
+	offset := len(out) + 16*n
+	var data []byte
+	for _, tag := range tags {
+		t := tables[tag]
+		out = append(out, tag...)
+		out = binary.BigEndian.AppendUint32(out, tableChecksum(t))
+		out = binary.BigEndian.AppendUint32(out, uint32(offset+len(data)))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(t)))
+		data = append(data, t...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return append(out, data...)
+}
+
+// tableChecksum sums a table as big-endian 32-bit words
+func tableChecksum(t fontTable) uint32 {
+	var sum uint32
+	for i := 0; i < len(t); i += 4 {
+		sum += uint32(t.u8(i))<<24 | uint32(t.u8(i+1))<<16 | uint32(t.u8(i+2))<<8 | uint32(t.u8(i+3))
+	}
+	return sum
+}
+
+// maxWebFontSize bounds the decompressed tables of a WOFF or WOFF2 font,
+// so that a malformed header can't make the decoder allocate without limit
+const maxWebFontSize = 256 << 20
+
+// decodeWebFont returns the TrueType or OpenType data of a font file,
+// unpacking it if it is a WOFF or WOFF2 web font
+func decodeWebFont(data []byte) ([]byte, error) {
+	switch string(fontTable(data).span(0, 4)) {
+	case "wOFF":
+		return decodeWOFF(data)
+	case "wOF2":
+		return decodeWOFF2(data)
+	}
+	return data, nil
+}
+
+// decodeWOFF unpacks a WOFF 1.0 font, whose tables are each compressed
+// with zlib
+func decodeWOFF(data []byte) ([]byte, error) {
+	b := fontTable(data)
+	// The table sizes are checked before any is decompressed
+	total := 0
+	for i := range b.u16(12) {
+		if total += b.u32(44 + 20*i + 12); total > maxWebFontSize {
+			return nil, errors.New("WOFF font is too large")
+		}
+	}
+
+	tables := make(map[string]fontTable)
+	for i := range b.u16(12) {
+		rec := 44 + 20*i
+		tag := string(b.span(rec, 4))
+		compressed := b.span(b.u32(rec+4), b.u32(rec+8))
+		size := b.u32(rec + 12)
+		if len(tag) != 4 || compressed == nil {
+			return nil, errors.New("truncated WOFF font")
+		}
+		if len(compressed) >= size {
+			tables[tag] = compressed
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("WOFF table %s: %w", tag, err)
+		}
+		t, err := io.ReadAll(io.LimitReader(r, int64(size)))
+		if err != nil {
+			return nil, fmt.Errorf("WOFF table %s: %w", tag, err)
+		}
+		if len(t) != size {
+			return nil, fmt.Errorf("WOFF table %s: want %d bytes, got %d", tag, size, len(t))
+		}
+		tables[tag] = t
+	}
+	if len(tables) == 0 {
+		return nil, errors.New("not a font file")
+	}
+	return writeSfnt(uint32(b.u32(4)), tables), nil
+}
@@ -0,0 +1,517 @@
+package ogimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// encodeWOFF packs a font as WOFF 1.0, compressing each table
+func encodeWOFF(t *testing.T, data []byte) []byte {
+	t.Helper()
+	tables, err := sfntTables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := slices.Sorted(maps.Keys(tables))
+
+	header := append(be{}, "wOFF"...).u32(int(binary.BigEndian.Uint32(data))).u32(0).u16(len(tags)).u16(0).
+		u32(len(data)).u16(1).u16(0).u32(0).u32(0).u32(0).u32(0).u32(0)
+	offset := len(header) + 20*len(tags)
+	var body []byte
+	for _, tag := range tags {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(tables[tag])
+		w.Close()
+		compressed := buf.Bytes()
+		if buf.Len() >= len(tables[tag]) {
+			compressed = tables[tag]
+		}
+		header = append(header, tag...)
+		header = header.u32(offset + len(body)).u32(len(compressed)).u32(len(tables[tag])).u32(0)
+		body = append(body, compressed...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	return append(header, body...)
+}
+
+func TestDecodeWebFont(t *testing.T) {
+	fontPath := testFontPath(t)
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	woff := filepath.Join(dir, "font.woff")
+	if err := os.WriteFile(woff, encodeWOFF(t, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	width := func(path string) font.Face {
+		t.Helper()
+		f, err := loadFont(path)
+		if err != nil {
+			t.Fatalf("loadFont(%s) error: %v", filepath.Base(path), err)
+		}
+		face, err := f.newFace(48)
+		if err != nil {
+			t.Fatalf("newFace() error: %v", err)
+		}
+		return face
+	}
+	if got, want := font.MeasureString(width(woff), "Hello World"), font.MeasureString(width(fontPath), "Hello World"); got != want {
+		t.Errorf("WOFF width = %v, want %v", got, want)
+	}
+
+	for name, data := range map[string][]byte{
+		"font.woff2":      []byte("wOF2\x00\x01\x00\x00"),
+		"truncated.woff":  encodeWOFF(t, data)[:200],
+		"truncated.woff2": encodeWOFF2(t, data, true)[:200],
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0644)
+		if _, err := loadFont(path); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("loadFont(%s) error = %v, want an error naming the file", name, err)
+		}
+	}
+
+	// A table that claims to inflate to 4 GB is refused before it is read
+	bomb := encodeWOFF(t, data)
+	binary.BigEndian.PutUint32(bomb[44+12:], 0xffffffff)
+	if _, err := decodeWebFont(bomb); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("decodeWebFont() error = %v, want too large", err)
+	}
+}
+
+// encodeWOFF2 packs a TrueType font as WOFF2, with its glyf, loca and,
+// when the left side bearings allow, hmtx tables transformed if transform
+// is set
+func encodeWOFF2(t *testing.T, data []byte, transform bool) []byte {
+	t.Helper()
+	tables, err := sfntTables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := slices.Sorted(maps.Keys(tables))
+	stored := make(map[string][]byte, len(tables))
+	for tag, table := range tables {
+		stored[tag] = table
+	}
+	if transform {
+		var xMins []int
+		stored["glyf"], xMins = transformGlyf(t, tables)
+		stored["loca"] = nil
+		numHMetrics := tables["hhea"].u16(34)
+		hmtx := be{}.u8(3)
+		for g := range numHMetrics {
+			hmtx = hmtx.u16(tables["hmtx"].u16(4 * g))
+		}
+		for g, xMin := range xMins {
+			lsb := tables["hmtx"].i16(4*g + 2)
+			if g >= numHMetrics {
+				lsb = tables["hmtx"].i16(4*numHMetrics + 2*(g-numHMetrics))
+			}
+			if lsb != xMin {
+				hmtx = nil
+				break
+			}
+		}
+		if hmtx != nil {
+			stored["hmtx"] = hmtx
+		}
+	}
+
+	var dir be
+	var stream []byte
+	for _, tag := range tags {
+		index := slices.Index(woff2Tags, tag)
+		version := 0
+		transformed := len(stored[tag]) != len(tables[tag]) || tag == "loca" && transform
+		if tag == "glyf" || tag == "loca" {
+			if !transformed {
+				version = 3
+			}
+		} else if transformed {
+			version = 1
+		}
+		if index < 0 {
+			dir = append(dir.u8(63|version<<6), tag...)
+		} else {
+			dir = dir.u8(index | version<<6)
+		}
+		dir = appendBase128(dir, len(tables[tag]))
+		if transformed {
+			dir = appendBase128(dir, len(stored[tag]))
+		}
+		stream = append(stream, stored[tag]...)
+	}
+	var compressed bytes.Buffer
+	w := brotli.NewWriter(&compressed)
+	w.Write(stream)
+	w.Close()
+
+	header := append(be{}, "wOF2"...).u32(int(binary.BigEndian.Uint32(data))).u32(0).u16(len(tags)).u16(0).
+		u32(len(data)).u32(compressed.Len()).u16(1).u16(0).u32(0).u32(0).u32(0).u32(0).u32(0)
+	return append(append(header, dir...), compressed.Bytes()...)
+}
+
+func appendBase128(b be, v int) be {
+	n := 1
+	for v>>(7*n) != 0 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := v >> (7 * i) & 0x7f
+		if i > 0 {
+			c |= 0x80
+		}
+		b = b.u8(c)
+	}
+	return b
+}
+
+func appendU255(b be, v int) be {
+	switch {
+	case v < 253:
+		return b.u8(v)
+	case v < 506:
+		return b.u8(255).u8(v - 253)
+	case v < 762:
+		return b.u8(254).u8(v - 506)
+	default:
+		return b.u8(253).u16(v)
+	}
+}
+
+// transformGlyf splits the glyphs of a TrueType font into the streams of
+// a transformed WOFF2 glyf table, returning it and each glyph's xMin
+func transformGlyf(t *testing.T, tables map[string]fontTable) ([]byte, []int) {
+	t.Helper()
+	glyf, loca := tables["glyf"], tables["loca"]
+	numGlyphs := tables["maxp"].u16(4)
+	longLoca := tables["head"].i16(50) != 0
+	offset := func(g int) int {
+		if longLoca {
+			return loca.u32(4 * g)
+		}
+		return 2 * loca.u16(2*g)
+	}
+
+	var contours, points, flags, coords, composites, bboxes, instructions be
+	bboxBitmap := make(be, 4*((numGlyphs+31)/32))
+	xMins := make([]int, numGlyphs)
+	for g := range numGlyphs {
+		glyph := glyf.span(offset(g), offset(g+1)-offset(g))
+		if len(glyph) == 0 {
+			contours = contours.u16(0)
+			continue
+		}
+		nContours := glyph.i16(0)
+		bbox := [4]int{glyph.i16(2), glyph.i16(4), glyph.i16(6), glyph.i16(8)}
+		xMins[g] = bbox[0]
+		contours = contours.u16(nContours)
+		explicitBBox := nContours < 0
+		if nContours > 0 {
+			pos := 10
+			total, last := 0, -1
+			for range nContours {
+				end := glyph.u16(pos)
+				points = appendU255(points, end-last)
+				total, last = end+1, end
+				pos += 2
+			}
+			n := glyph.u16(pos)
+			instructions = append(instructions, glyph.span(pos+2, n)...)
+			pos += 2 + n
+			pointFlags := make([]int, 0, total)
+			for len(pointFlags) < total {
+				flag := glyph.u8(pos)
+				pos++
+				repeat := 1
+				if flag&0x08 != 0 {
+					repeat += glyph.u8(pos)
+					pos++
+				}
+				for range repeat {
+					pointFlags = append(pointFlags, flag)
+				}
+			}
+			var pts []glyfPoint
+			dxs := make([]int, total)
+			for i, flag := range pointFlags {
+				dxs[i], pos = readGlyfCoord(glyph, pos, flag, glyfXShort, glyfXSame)
+			}
+			for i, flag := range pointFlags {
+				var dy int
+				dy, pos = readGlyfCoord(glyph, pos, flag, glyfYShort, glyfYSame)
+				pts = append(pts, glyfPoint{dxs[i], dy, flag&glyfOnCurve != 0})
+				var flag byte
+				flag, coords = appendTriplet(coords, dxs[i], dy)
+				if !pts[i].on {
+					flag |= 0x80
+				}
+				flags = append(flags, flag)
+			}
+			coords = appendU255(coords, n)
+			x, y := 0, 0
+			for i := range pts {
+				x, y = x+pts[i].x, y+pts[i].y
+				pts[i].x, pts[i].y = x, y
+			}
+			explicitBBox = pointBounds(pts) != bbox
+		} else {
+			pos := 10
+			hasInstructions := false
+			for more := true; more; {
+				component := glyph.u16(pos)
+				size := 6
+				if component&glyfArgWords != 0 {
+					size += 2
+				}
+				switch {
+				case component&glyfScale != 0:
+					size += 2
+				case component&glyfXYScale != 0:
+					size += 4
+				case component&glyfTwoByTwo != 0:
+					size += 8
+				}
+				composites = append(composites, glyph.span(pos, size)...)
+				pos += size
+				hasInstructions = hasInstructions || component&glyfInstructions != 0
+				more = component&glyfMore != 0
+			}
+			if hasInstructions {
+				n := glyph.u16(pos)
+				coords = appendU255(coords, n)
+				instructions = append(instructions, glyph.span(pos+2, n)...)
+			}
+		}
+		if explicitBBox {
+			bboxBitmap[g/8] |= 0x80 >> (g % 8)
+			bboxes = bboxes.u16(bbox[0]).u16(bbox[1]).u16(bbox[2]).u16(bbox[3])
+		}
+	}
+	bboxes = append(bboxBitmap, bboxes...)
+
+	indexFormat := 0
+	if longLoca {
+		indexFormat = 1
+	}
+	out := be{}.u16(0).u16(0).u16(numGlyphs).u16(indexFormat)
+	streams := []be{contours, points, flags, coords, composites, bboxes, instructions}
+	for _, s := range streams {
+		out = out.u32(len(s))
+	}
+	for _, s := range streams {
+		out = append(out, s...)
+	}
+	return out, xMins
+}
+
+// readGlyfCoord reads a coordinate of a simple glyph's point
+func readGlyfCoord(glyph fontTable, pos, flag, short, same int) (int, int) {
+	switch {
+	case flag&short != 0 && flag&same != 0:
+		return glyph.u8(pos), pos + 1
+	case flag&short != 0:
+		return -glyph.u8(pos), pos + 1
+	case flag&same != 0:
+		return 0, pos
+	default:
+		return glyph.i16(pos), pos + 2
+	}
+}
+
+// appendTriplet appends a point's offset in the fewest bytes WOFF2 allows,
+// returning its flag with the off-curve bit clear
+func appendTriplet(coords be, dx, dy int) (byte, be) {
+	ax, ay := max(dx, -dx), max(dy, -dy)
+	xSign, ySign := 0, 0
+	if dx >= 0 {
+		xSign = 1
+	}
+	if dy >= 0 {
+		ySign = 2
+	}
+	switch {
+	case dx == 0 && ay < 1280:
+		return byte(ay&0xf00>>7 + ySign/2), coords.u8(ay & 0xff)
+	case dy == 0 && ax < 1280:
+		return byte(10 + ax&0xf00>>7 + xSign), coords.u8(ax & 0xff)
+	case ax < 65 && ay < 65:
+		return byte(20 + (ax-1)&0x30 + (ay-1)&0x30>>2 + xSign + ySign), coords.u8((ax-1)&0xf<<4 | (ay-1)&0xf)
+	case ax < 769 && ay < 769:
+		return byte(84 + 12*((ax-1)&0x300>>8) + (ay-1)&0x300>>6 + xSign + ySign), coords.u8((ax - 1) & 0xff).u8((ay - 1) & 0xff)
+	case ax < 4096 && ay < 4096:
+		return byte(120 + xSign + ySign), coords.u8(ax >> 4).u8(ax&0xf<<4 | ay>>8).u8(ay & 0xff)
+	default:
+		return byte(124 + xSign + ySign), coords.u16(ax).u16(ay)
+	}
+}
+
+func TestDecodeWOFF2(t *testing.T) {
+	fontPath := testFontPath(t)
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same font with each left side bearing at its glyph's left edge,
+	// so that the hmtx table is transformed too
+	tables, err := sfntTables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, xMins := transformGlyf(t, tables)
+	numHMetrics := tables["hhea"].u16(34)
+	var hmtx be
+	for g, xMin := range xMins {
+		if g < numHMetrics {
+			hmtx = hmtx.u16(tables["hmtx"].u16(4 * g))
+		}
+		hmtx = hmtx.u16(xMin)
+	}
+	tables["hmtx"] = fontTable(hmtx)
+	aligned := writeSfnt(binary.BigEndian.Uint32(data), tables)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		transform bool
+	}{
+		{name: "untransformed", data: data},
+		{name: "glyf transformed", data: data, transform: true},
+		{name: "glyf and hmtx transformed", data: aligned, transform: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := decodeWebFont(encodeWOFF2(t, tt.data, tt.transform))
+			if err != nil {
+				t.Fatalf("decodeWebFont() error: %v", err)
+			}
+			got, err := sfnt.Parse(decoded)
+			if err != nil {
+				t.Fatalf("decoded font doesn't parse: %v", err)
+			}
+			want, err := sfnt.Parse(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.NumGlyphs() != want.NumGlyphs() {
+				t.Fatalf("%d glyphs, want %d", got.NumGlyphs(), want.NumGlyphs())
+			}
+
+			// Glyphs may be stored differently but must transform back to
+			// the same streams, and the other tables must be unchanged
+			gotTables, _ := sfntTables(decoded)
+			wantTables, _ := sfntTables(tt.data)
+			for tag, table := range wantTables {
+				if tag != "glyf" && tag != "loca" && !bytes.Equal(gotTables[tag], table) {
+					t.Errorf("table %s differs", tag)
+				}
+			}
+			gotGlyf, _ := transformGlyf(t, gotTables)
+			wantGlyf, _ := transformGlyf(t, wantTables)
+			if !bytes.Equal(gotGlyf, wantGlyf) {
+				t.Errorf("glyphs differ")
+			}
+
+			var b sfnt.Buffer
+			ppem := fixed.I(int(want.UnitsPerEm()))
+			for g := range sfnt.GlyphIndex(want.NumGlyphs()) {
+				wantSegs, err := want.LoadGlyph(&b, g, ppem, nil)
+				if err != nil {
+					continue
+				}
+				wantSegs = slices.Clone(wantSegs)
+				if gotSegs, err := got.LoadGlyph(&b, g, ppem, nil); err != nil || !reflect.DeepEqual(gotSegs, wantSegs) {
+					t.Fatalf("glyph %d outline differs: %v", g, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeWOFF2Fixture(t *testing.T) {
+	// Source Code Pro Italic as shipped in the Rust documentation, encoded
+	// by Google's woff2 tools with its glyf and loca tables transformed
+	data, err := os.ReadFile("testdata/SourceCodePro-It.ttf.woff2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeWebFont(data)
+	if err != nil {
+		t.Fatalf("decodeWebFont() error: %v", err)
+	}
+	f, err := sfnt.Parse(decoded)
+	if err != nil {
+		t.Fatalf("decoded font doesn't parse: %v", err)
+	}
+
+	tables, _ := sfntTables(decoded)
+	if n := tables["maxp"].u16(4); f.NumGlyphs() != n || n < 1000 {
+		t.Fatalf("%d glyphs, want the %d of maxp", f.NumGlyphs(), n)
+	}
+	var b sfnt.Buffer
+	if name, err := f.Name(&b, sfnt.NameIDFamily); err != nil || name != "Source Code Pro" {
+		t.Errorf("family = %q, %v, want Source Code Pro", name, err)
+	}
+
+	// The hmtx table is stored as it was, and bit 1 of the head flags says
+	// each left side bearing is the left edge of its glyph, so every
+	// reconstructed glyph must start where the original did
+	head, hmtx := tables["head"], tables["hmtx"]
+	if head.u16(16)&2 == 0 {
+		t.Fatal("head flags don't put left side bearings at the glyph edges")
+	}
+	loca := func(g int) int {
+		if head.i16(50) != 0 {
+			return tables["loca"].u32(4 * g)
+		}
+		return 2 * tables["loca"].u16(2*g)
+	}
+	numHMetrics := tables["hhea"].u16(34)
+	ppem := fixed.I(int(f.UnitsPerEm()))
+	for g := range f.NumGlyphs() {
+		if _, err := f.LoadGlyph(&b, sfnt.GlyphIndex(g), ppem, nil); err != nil {
+			t.Fatalf("glyph %d: %v", g, err)
+		}
+		if loca(g+1) == loca(g) {
+			continue
+		}
+		lsb := hmtx.i16(4*numHMetrics + 2*(g-numHMetrics))
+		if g < numHMetrics {
+			lsb = hmtx.i16(4*g + 2)
+		}
+		if xMin := tables["glyf"].i16(loca(g) + 2); xMin != lsb {
+			t.Fatalf("glyph %d starts at x = %d, want its left side bearing %d", g, xMin, lsb)
+		}
+	}
+
+	// The letters and digits of the monospaced font are 600 units wide
+	for _, r := range "AZaz09" {
+		g, err := f.GlyphIndex(&b, r)
+		if err != nil || g == 0 {
+			t.Fatalf("no glyph for %c: %v", r, err)
+		}
+		if advance, err := f.GlyphAdvance(&b, g, ppem, 0); err != nil || advance != fixed.I(600) {
+			t.Errorf("%c advance = %v, %v, want 600", r, advance, err)
+		}
+	}
+}
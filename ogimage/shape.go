@@ -0,0 +1,284 @@
+package ogimage
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/go-text/typesetting/di"
+	shapingfont "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// complexScripts are the scripts whose letters join, reorder or stack
+// marks depending on their neighbors, which only an OpenType shaping
+// engine draws correctly
+var complexScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko, unicode.Hebrew,
+	unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati,
+	unicode.Oriya, unicode.Tamil, unicode.Telugu, unicode.Kannada,
+	unicode.Malayalam, unicode.Sinhala, unicode.Thai, unicode.Lao,
+	unicode.Tibetan, unicode.Myanmar, unicode.Khmer,
+}
+
+// needsShaping reports whether s has characters of a complex script
+func needsShaping(s string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.In(r, complexScripts...)
+	})
+}
+
+// shapingFont is a font as the shaping engine reads it, parsed on first use
+type shapingFont struct {
+	data []byte
+	once sync.Once
+	face *shapingfont.Face
+}
+
+// get returns the parsed font, or nil if the shaping engine can't read it
+func (f *shapingFont) get() *shapingfont.Face {
+	f.once.Do(func() {
+		if faces, err := shapingfont.ParseTTC(bytes.NewReader(f.data)); err == nil {
+			f.face = faces[0]
+		}
+	})
+	return f.face
+}
+
+// shapers are reused between lines, as each keeps the shaping tables of
+// the fonts it has shaped
+var shapers = sync.Pool{New: func() any { return new(shaping.HarfbuzzShaper) }}
+
+// shapedGlyph is a glyph of a shaped line, with its origin relative to
+// the start of the line's baseline: an outline glyph of face, or a color
+// emoji drawn by drawEmoji
+type shapedGlyph struct {
+	face  *outlineFace
+	id    sfnt.GlyphIndex
+	emoji *emojiFace
+	r     rune
+	x, y  float64
+}
+
+// shapedLine is a line of text shaped into glyphs, in visual order
+type shapedLine struct {
+	glyphs []shapedGlyph
+	width  float64
+}
+
+// shapeLine shapes a line in face with the OpenType tables of its fonts,
+// after ordering it with the Unicode bidirectional algorithm in a
+// paragraph that is right-to-left if rtl is set. It reports false for a
+// line without a complex script, which is drawn character by character
+// as before, and for faces with a font the shaping engine can't read.
+func shapeLine(face font.Face, s string, rtl bool) (shapedLine, bool) {
+	if !needsShaping(s) {
+		return shapedLine{}, false
+	}
+	fonts, ok := shapingFonts(face)
+	if !ok {
+		return shapedLine{}, false
+	}
+	shaper := shapers.Get().(*shaping.HarfbuzzShaper)
+	defer shapers.Put(shaper)
+
+	var line shapedLine
+	for _, run := range visualRuns(s, rtl) {
+		runes := []rune(run.text)
+		dir := di.DirectionLTR
+		segments := splitShaping(runes, fonts)
+		if run.level%2 == 1 {
+			dir = di.DirectionRTL
+			slices.Reverse(segments)
+		}
+		for _, seg := range segments {
+			switch f := fonts.faces[seg.face].(type) {
+			case *emojiFace:
+				emoji := runes[seg.start:seg.end]
+				if dir == di.DirectionRTL {
+					emoji = slices.Clone(emoji)
+					slices.Reverse(emoji)
+				}
+				for _, r := range emoji {
+					line.glyphs = append(line.glyphs, shapedGlyph{emoji: f, r: r, x: line.width})
+					advance, _ := f.GlyphAdvance(r)
+					line.width += float64(advance) / 64
+				}
+			case *outlineFace:
+				sf := f.font.shaping.get()
+				upem := int(sf.Upem())
+				// Shaping at one pixel per unit keeps positions exact, as the
+				// engine rounds sizes up to whole pixels
+				out := shaper.Shape(shaping.Input{
+					Text:      runes,
+					RunStart:  seg.start,
+					RunEnd:    seg.end,
+					Direction: dir,
+					Face:      sf,
+					Size:      fixed.I(upem),
+					Script:    seg.script,
+				})
+				scale := float64(f.ppem) / 64 / float64(upem) / 64
+				for _, g := range out.Glyphs {
+					line.glyphs = append(line.glyphs, shapedGlyph{
+						face: f,
+						id:   sfnt.GlyphIndex(g.GlyphID),
+						x:    line.width + float64(g.XOffset)*scale,
+						y:    -float64(g.YOffset) * scale,
+					})
+					line.width += float64(g.XAdvance) * scale
+				}
+			}
+		}
+	}
+	return line, true
+}
+
+// shapingFonts returns the faces of face, in fallback order, if the
+// shaping engine reads each of their outline fonts
+func shapingFonts(face font.Face) (fallbackFace, bool) {
+	if grid, ok := face.(gridFace); ok {
+		face = grid.Face
+	}
+	fonts, ok := face.(fallbackFace)
+	if !ok {
+		fonts = fallbackFace{faces: []font.Face{face}}
+	}
+	var parsed []parsedFont
+	for _, f := range fonts.faces {
+		switch f := f.(type) {
+		case *emojiFace:
+			parsed = append(parsed, f.font)
+		case *outlineFace:
+			if f.font.shaping.get() == nil {
+				return fallbackFace{}, false
+			}
+			parsed = append(parsed, f.font)
+		default:
+			return fallbackFace{}, false
+		}
+	}
+	fonts.fonts = parsed
+	return fonts, true
+}
+
+// shapingSegment is a stretch of a run in one script, drawn in the face
+// at index face of the fallbacks
+type shapingSegment struct {
+	start, end int
+	script     language.Script
+	face       int
+}
+
+// splitShaping splits runes into segments of one script, drawn in the
+// face of fonts that DrawString would draw each of their characters in.
+// Marks stay with the letter they are on, and spaces and punctuation with
+// the segment before them if its face has them, so that brackets and
+// accents are shaped with their text.
+func splitShaping(runes []rune, fonts fallbackFace) []shapingSegment {
+	var segments []shapingSegment
+	for i, r := range runes {
+		script := language.LookupScript(r)
+		face := fonts.pick(r)
+		inherits := script == language.Common || script == language.Inherited || script == language.Unknown
+		if len(segments) > 0 {
+			last := &segments[len(segments)-1]
+			if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) ||
+				face == last.face && (inherits || script == last.script) {
+				last.end = i + 1
+				continue
+			}
+			if last.script == language.Common {
+				// Leading punctuation takes the script of what follows
+				last.script = script
+				if face == last.face {
+					last.end = i + 1
+					continue
+				}
+			}
+		}
+		if inherits {
+			script = language.Common
+		}
+		segments = append(segments, shapingSegment{start: i, end: i + 1, script: script, face: face})
+	}
+	return segments
+}
+
+// draw fills the outlines of the line's glyphs from x on baseline y, in
+// the color and transform of dc. Color emoji are left to drawEmoji.
+func (l shapedLine) draw(dc *gg.Context, x, y float64) {
+	var buf sfnt.Buffer
+	for _, g := range l.glyphs {
+		if g.face == nil {
+			continue
+		}
+		segments, err := g.face.font.LoadGlyph(&buf, g.id, g.face.ppem, nil)
+		if err != nil || len(segments) == 0 {
+			continue
+		}
+		point := func(p fixed.Point26_6) (float64, float64) {
+			return x + g.x + float64(p.X)/64, y + g.y + float64(p.Y)/64
+		}
+		for _, s := range segments {
+			x1, y1 := point(s.Args[0])
+			x2, y2 := point(s.Args[1])
+			x3, y3 := point(s.Args[2])
+			switch s.Op {
+			case sfnt.SegmentOpMoveTo:
+				dc.MoveTo(x1, y1)
+			case sfnt.SegmentOpLineTo:
+				dc.LineTo(x1, y1)
+			case sfnt.SegmentOpQuadTo:
+				dc.QuadraticTo(x1, y1, x2, y2)
+			case sfnt.SegmentOpCubeTo:
+				dc.CubicTo(x1, y1, x2, y2, x3, y3)
+			}
+		}
+		dc.Fill()
+	}
+}
+
+// shapedText measures text as drawText draws it in face, the face loaded
+// in m, or without a face as displayText draws it
+type shapedText struct {
+	m    measurer
+	face font.Face
+	rtl  bool
+}
+
+func (t shapedText) MeasureString(s string) (w, h float64) {
+	if t.face != nil {
+		if line, ok := shapeLine(t.face, s, t.rtl); ok {
+			_, h = t.m.MeasureString(s)
+			return line.width, h
+		}
+	}
+	return t.m.MeasureString(shapeArabic(s))
+}
+
+// measureText returns the width of a line in face, the face loaded in
+// dc, as drawText draws it
+func measureText(dc *gg.Context, face font.Face, s string, rtl bool) float64 {
+	w, _ := shapedText{m: dc, face: face, rtl: rtl}.MeasureString(s)
+	return w
+}
+
+// drawText draws a line in face, the face loaded in dc, from x on
+// baseline y in dc's color: shaped if shapeLine can, or else character by
+// character in the order displayText puts it. Color emoji are left to
+// drawEmoji, which places them the same way.
+func drawText(dc *gg.Context, face font.Face, s string, rtl bool, x, y float64) {
+	if line, ok := shapeLine(face, s, rtl); ok {
+		line.draw(dc, x, y)
+		return
+	}
+	dc.DrawString(displayText(s, rtl), x, y)
+}
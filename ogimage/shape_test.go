@@ -0,0 +1,121 @@
+package ogimage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestNeedsShaping(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Hello world", false},
+		{"日本語のタイトル", false},
+		{"Café 🎉", false},
+		{"مرحبا", true},
+		{"שָׁלוֹם", true},
+		{"Go in हिन्दी", true},
+		{"ภาษาไทย", true},
+	}
+
+	for _, tt := range tests {
+		if got := needsShaping(tt.text); got != tt.want {
+			t.Errorf("needsShaping(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestShapeLine(t *testing.T) {
+	face, err := (&fontCache{}).face(testFontPath(t), 48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shape := func(s string, rtl bool) shapedLine {
+		t.Helper()
+		line, ok := shapeLine(face, s, rtl)
+		if !ok {
+			t.Fatalf("shapeLine(%q) was not shaped", s)
+		}
+		return line
+	}
+
+	t.Run("simple script is left to DrawString", func(t *testing.T) {
+		if _, ok := shapeLine(face, "Hello world", false); ok {
+			t.Error("shapeLine() shaped a Latin line")
+		}
+	})
+
+	t.Run("lam alef ligature", func(t *testing.T) {
+		// Lam and alef form one glyph, and the line is laid out from its
+		// last letter on the left
+		line := shape("سلام", true)
+		if len(line.glyphs) != 3 {
+			t.Fatalf("shaped %d glyphs, want 3", len(line.glyphs))
+		}
+		if line.glyphs[0].id == line.glyphs[2].id || line.glyphs[0].x != 0 {
+			t.Errorf("glyphs = %+v, want the final meem first", line.glyphs)
+		}
+	})
+
+	t.Run("marks take no width", func(t *testing.T) {
+		bare, marked := shape("שלום", true), shape("שָׁלוֹם", true)
+		if len(marked.glyphs) <= len(bare.glyphs) {
+			t.Fatalf("shaped %d glyphs with marks, want more than %d", len(marked.glyphs), len(bare.glyphs))
+		}
+		if math.Abs(marked.width-bare.width) > 0.01 {
+			t.Errorf("width with marks = %v, want %v", marked.width, bare.width)
+		}
+	})
+
+	t.Run("bidi order", func(t *testing.T) {
+		line := shape("Go בעברית", false)
+		var buf sfnt.Buffer
+		for i, r := range "Go" {
+			g := line.glyphs[i]
+			if id, _ := g.face.font.GlyphIndex(&buf, r); g.id != id {
+				t.Errorf("glyph %d = %d, want %q", i, g.id, r)
+			}
+		}
+		if last := line.glyphs[len(line.glyphs)-1]; last.x <= line.glyphs[1].x {
+			t.Errorf("glyphs = %+v, want the Hebrew after Go", line.glyphs)
+		}
+	})
+
+	t.Run("emoji", func(t *testing.T) {
+		emoji := filepath.Join(t.TempDir(), "emoji.ttf")
+		if err := os.WriteFile(emoji, testCBDTFont(t), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cache := &fontCache{}
+		face, err := cache.face(cache.chain([]string{testFontPath(t)}, []string{emoji}, "🚀"), 48)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The rocket ends the right-to-left line, so it is drawn first
+		line, ok := shapeLine(face, "שלום 🚀", true)
+		if !ok {
+			t.Fatal("shapeLine() was not shaped")
+		}
+		if g := line.glyphs[0]; g.emoji == nil || g.r != rocket || g.x != 0 {
+			t.Errorf("first glyph = %+v, want the rocket", g)
+		}
+		if g := line.glyphs[1]; g.face == nil || g.x != 48*18.0/16 {
+			t.Errorf("second glyph = %+v, want the space after the rocket's advance", g)
+		}
+	})
+
+	t.Run("measured as drawn", func(t *testing.T) {
+		dc := gg.NewContext(1200, 628)
+		dc.SetFontFace(face)
+		s := "مرحبا بالعالم"
+		if got, want := measureText(dc, face, s, true), shape(s, true).width; got != want {
+			t.Errorf("measureText() = %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/fogleman/gg"
+)
+
+// bylineSeparator joins the author and date
+const bylineSeparator = " · "
+
+// byline returns the author and date joined by bylineSeparator, or
+// whichever of them is set
+func byline(author, date string) string {
+	switch {
+	case author == "":
+		return date
+	case date == "":
+		return author
+	}
+	return author + bylineSeparator + date
+}
+
+// subtitleBlock is the wrapped subtitle and the byline, drawn on the grid
+// lines below the title
+type subtitleBlock struct {
+	text   string
+	lines  []string
+	byline string
+
+	titleFontPath string
+	urlFontPath   string
+}
+
+// layoutSubtitle wraps the subtitle in the title font at SubtitleFontSize
+// to the width of the card, cutting it to SubtitleMaxLines lines
+func layoutSubtitle(dc *gg.Context, fonts *fontCache, subtitle, author, date, titleFontPath, urlFontPath string, width int) (subtitleBlock, error) {
+	b := subtitleBlock{text: subtitle, byline: byline(author, date), titleFontPath: titleFontPath, urlFontPath: urlFontPath}
+	if subtitle == "" {
+		return b, nil
+	}
+	face, err := fonts.setFace(dc, titleFontPath, SubtitleFontSize)
+	if err != nil {
+		return subtitleBlock{}, fmt.Errorf("load font for subtitle: %w", err)
+	}
+	maxWidth := float64(width) - (2 * TextSideMargin)
+	m := shapedText{m: dc, face: face, rtl: isRTL(subtitle)}
+	b.lines = clampLines(m, wrapText(m, subtitle, maxWidth), SubtitleMaxLines, maxWidth)
+	return b, nil
+}
+
+// gridLines returns the number of grid lines the block takes up
+func (b subtitleBlock) gridLines() int {
+	if b.byline != "" {
+		return len(b.lines) + 1
+	}
+	return len(b.lines)
+}
+
+// draw draws the subtitle and byline in the URL color on the grid lines
+// after the title's last line, aligned like the title. If they would run
+// into avoid, the subtitle is wrapped again in a column narrowed to clear
+// it, keeping the same number of lines, and the byline is cut to fit.
+func (b subtitleBlock) draw(dc *gg.Context, fonts *fontCache, colors palette, title titleLayout, width int, avoid image.Rectangle) error {
+	if b.gridLines() == 0 {
+		return nil
+	}
+	first := title.first + len(title.lines)
+	top := title.grid.baseline(first) - title.grid.fontHeight
+	bottom := title.grid.baseline(first+b.gridLines()-1) + title.grid.fontHeight*(LineSpacing-1)
+	dc.SetColor(colors.url)
+
+	if len(b.lines) > 0 {
+		face, err := fonts.setFace(dc, b.titleFontPath, SubtitleFontSize)
+		if err != nil {
+			return fmt.Errorf("load font for subtitle: %w", err)
+		}
+		rtl := isRTL(b.text)
+		m := shapedText{m: dc, face: face, rtl: rtl}
+		x, maxWidth := b.column(m, b.lines, avoid, width, top, bottom, title.align)
+		lines := b.lines
+		if full := float64(width) - (2 * TextSideMargin); maxWidth != full {
+			lines = clampLines(m, wrapText(m, b.text, maxWidth), len(b.lines), maxWidth)
+		}
+		for i, line := range lines {
+			lineWidth, _ := m.MeasureString(line)
+			lineX, y := x+alignOffset(title.align, maxWidth, lineWidth), title.grid.baseline(first+i)
+			drawText(dc, face, line, rtl, lineX, y)
+			drawEmoji(dc, face, line, rtl, lineX, y)
+		}
+	}
+
+	if b.byline != "" {
+		face, err := fonts.setFace(dc, b.urlFontPath, BylineFontSize)
+		if err != nil {
+			return fmt.Errorf("load font for byline: %w", err)
+		}
+		rtl := isRTL(b.byline)
+		m := shapedText{m: dc, face: face, rtl: rtl}
+		x, maxWidth := b.column(m, []string{b.byline}, avoid, width, top, bottom, title.align)
+		line := truncateLine(m, b.byline, maxWidth)
+		lineWidth, _ := m.MeasureString(line)
+		lineX, y := x+alignOffset(title.align, maxWidth, lineWidth), title.grid.baseline(first+len(b.lines))
+		drawText(dc, face, line, rtl, lineX, y)
+		drawEmoji(dc, face, line, rtl, lineX, y)
+	}
+	return nil
+}
+
+// column returns the column for lines, measured with m, that keeps the
+// widest of them clear of avoid
+func (b subtitleBlock) column(m measurer, lines []string, avoid image.Rectangle, width int, top, bottom float64, align string) (x, maxWidth float64) {
+	widest := 0.0
+	for _, line := range lines {
+		w, _ := m.MeasureString(line)
+		widest = max(widest, w)
+	}
+	return textColumn(avoid, width, top, bottom, widest, align)
+}
@@ -0,0 +1,124 @@
+package ogimage
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestByline(t *testing.T) {
+	tests := []struct {
+		author, date, want string
+	}{
+		{"", "", ""},
+		{"Ada", "", "Ada"},
+		{"", "March 5, 2024", "March 5, 2024"},
+		{"Ada", "March 5, 2024", "Ada · March 5, 2024"},
+	}
+
+	for _, tt := range tests {
+		if got := byline(tt.author, tt.date); got != tt.want {
+			t.Errorf("byline(%q, %q) = %q, want %q", tt.author, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutSubtitle(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+
+	tests := []struct {
+		name      string
+		subtitle  string
+		author    string
+		date      string
+		wantLines int
+		wantGrid  int
+	}{
+		{"nothing", "", "", "", 0, 0},
+		{"byline only", "", "Ada", "March 5, 2024", 0, 1},
+		{"short subtitle", "A short tour of the scheduler", "", "", 1, 1},
+		{"long subtitle is cut", strings.Repeat("A long subtitle that keeps going ", 8), "Ada", "", SubtitleMaxLines, SubtitleMaxLines + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := layoutSubtitle(dc, &fontCache{}, tt.subtitle, tt.author, tt.date, fontPath, fontPath, 1200)
+			if err != nil {
+				t.Fatalf("layoutSubtitle() error: %v", err)
+			}
+			if len(b.lines) != tt.wantLines || b.gridLines() != tt.wantGrid {
+				t.Errorf("lines = %q, gridLines() = %d, want %d lines and %d grid lines", b.lines, b.gridLines(), tt.wantLines, tt.wantGrid)
+			}
+		})
+	}
+
+	t.Run("invalid font path", func(t *testing.T) {
+		_, err := layoutSubtitle(dc, &fontCache{}, "Subtitle", "", "", "/nonexistent/font.ttf", fontPath, 1200)
+		if err == nil || !strings.Contains(err.Error(), "load font for subtitle") {
+			t.Errorf("layoutSubtitle() error = %v, want font error", err)
+		}
+	})
+}
+
+func TestLayoutTitleReservesLines(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, TitleFontSize); err != nil {
+		t.Fatal(err)
+	}
+	title := "This is a longer title that should wrap across multiple lines in the image"
+
+	plain := layoutTitle(dc, title, 1200, 628, titleStyle{}, image.Rectangle{})
+	if !plain.fits() {
+		t.Fatalf("title without reserved lines should fit: %q", plain.lines)
+	}
+	reserved := layoutTitle(dc, title, 1200, 628, titleStyle{reserve: 2}, image.Rectangle{})
+	if reserved.last != plain.last-2 {
+		t.Errorf("last = %d, want %d", reserved.last, plain.last-2)
+	}
+	if reserved.fits() {
+		t.Errorf("title with two reserved lines should not fit on %d grid lines: %q", reserved.last+1, reserved.lines)
+	}
+
+	bottom := layoutTitle(dc, "Short", 1200, 628, titleStyle{valign: VAlignBottom, reserve: 2}, image.Rectangle{})
+	if bottom.first+1+2 != bottom.grid.urlLine("") {
+		t.Errorf("bottom title on grid line %d with 2 reserved lines, want them to end above URL line %d", bottom.first, bottom.grid.urlLine(""))
+	}
+}
+
+func TestRenderSubtitle(t *testing.T) {
+	fontPath := testFontPath(t)
+	title := "Mastering Concurrency Patterns in Modern Go Services and Beyond"
+
+	fit := func(opts Options) string {
+		var logged []string
+		r := NewRenderer()
+		r.Logf = func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+		opts.Title = title
+		opts.URL = "https://example.com"
+		opts.TitleFont = fontPath
+		opts.URLFont = fontPath
+		opts.TitleFit = true
+		opts.TitleMaxSize = 96
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatalf("Render() error: %v", err)
+		}
+		return strings.Join(logged, "\n")
+	}
+
+	without := fit(Options{})
+	with := fit(Options{Subtitle: "A tour of channels, select and the scheduler", Author: "Ada", Date: "March 5, 2024"})
+	if with == without {
+		t.Errorf("title fit the same with a subtitle and byline: %q", with)
+	}
+	if strings.Contains(with, "runs into the URL") {
+		t.Errorf("fitted title with subtitle runs into the URL: %q", with)
+	}
+}
@@ -0,0 +1,195 @@
+package ogimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// Positions of the tag pills
+const (
+	TagsAbove  = "above"
+	TagsBeside = "beside"
+)
+
+// pill is a tag label and the color of the badge it is drawn on
+type pill struct {
+	label string
+	fill  color.Color
+	width float64
+}
+
+// tagSet is the tags drawn as pills, in the URL font at TagFontSize
+type tagSet struct {
+	labels   []string
+	fills    []color.Color
+	position string
+	fontPath string
+	// more is the fill of the "+N" pill that counts tags left out
+	more color.Color
+}
+
+// newTagSet returns the tags of opts with their fills: TagColor, or the
+// theme's URL color if it is empty, unless TagColors has a color for the
+// tag. Blank tags are dropped, and the others are kept as drawn, with
+// right-to-left labels reordered.
+func newTagSet(opts Options, colors palette, fontPath string) (tagSet, error) {
+	t := tagSet{position: opts.TagPosition, fontPath: fontPath, more: colors.url}
+	if opts.TagColor != "" {
+		c, err := ParseColor(opts.TagColor)
+		if err != nil {
+			return tagSet{}, fmt.Errorf("tag color: %w", err)
+		}
+		t.more = c
+	}
+
+	byTag := make(map[string]color.Color, len(opts.TagColors))
+	for tag, value := range opts.TagColors {
+		c, err := ParseColor(value)
+		if err != nil {
+			return tagSet{}, fmt.Errorf("tag color for %q: %w", tag, err)
+		}
+		byTag[strings.ToLower(strings.TrimSpace(tag))] = c
+	}
+
+	for _, tag := range opts.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		fill, ok := byTag[strings.ToLower(tag)]
+		if !ok {
+			fill = t.more
+		}
+		t.labels = append(t.labels, tag)
+		t.fills = append(t.fills, fill)
+	}
+	return t, nil
+}
+
+// newPill measures a pill for label with m
+func newPill(m measurer, label string, fill color.Color) pill {
+	w, _ := m.MeasureString(label)
+	return pill{label: label, fill: fill, width: w + 2*TagPaddingX}
+}
+
+// rowWidth returns the width of a row of pills and the gaps between them
+func rowWidth(row []pill) float64 {
+	w := 0.0
+	for i, p := range row {
+		if i > 0 {
+			w += TagGap
+		}
+		w += p.width
+	}
+	return w
+}
+
+// rows breaks the pills, measured with m, into rows
+// no wider than maxWidth. If more than maxRows rows are needed, the pills
+// after them are left out and counted on a "+N" pill at the end of the
+// last row, which drops pills from its end until the count fits. A label
+// too wide for a row of its own is cut with an ellipsis.
+func (t tagSet) rows(m measurer, maxWidth float64, maxRows int) [][]pill {
+	maxRows = max(maxRows, 1)
+	var rows [][]pill
+	used := 0.0
+	for i, label := range t.labels {
+		p := newPill(m, truncateLine(m, label, maxWidth-2*TagPaddingX), t.fills[i])
+		if len(rows) == 0 || used+TagGap+p.width > maxWidth {
+			rows = append(rows, nil)
+			used = -TagGap
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], p)
+		used += TagGap + p.width
+	}
+	if len(rows) <= maxRows {
+		return rows
+	}
+
+	hidden := 0
+	for _, row := range rows[maxRows:] {
+		hidden += len(row)
+	}
+	rows = rows[:maxRows]
+	last := rows[maxRows-1]
+	for {
+		more := newPill(m, fmt.Sprintf("+%d", hidden), t.more)
+		if len(last) == 0 || rowWidth(last)+TagGap+more.width <= maxWidth {
+			rows[maxRows-1] = append(last, more)
+			return rows
+		}
+		last = last[:len(last)-1]
+		hidden++
+	}
+}
+
+// pillHeight returns the height of a pill in the font loaded in dc
+func pillHeight(dc *gg.Context) float64 {
+	return measureFontHeight(dc) + 2*TagPaddingY
+}
+
+// drawPills draws a row of pills from x, with their tops at y, in face,
+// the font loaded in dc. Labels are black or white, whichever stands out
+// more against the pill.
+func drawPills(dc *gg.Context, face font.Face, row []pill, x, y float64) {
+	fontHeight := measureFontHeight(dc)
+	h := fontHeight + 2*TagPaddingY
+	for _, p := range row {
+		dc.SetColor(p.fill)
+		drawRoundedRect(dc, x, y, p.width, h, h/2, h/2)
+		dc.Fill()
+
+		dc.SetColor(labelColor(p.fill))
+		rtl := isRTL(p.label)
+		drawText(dc, face, p.label, rtl, x+TagPaddingX, y+TagPaddingY+fontHeight)
+		drawEmoji(dc, face, p.label, rtl, x+TagPaddingX, y+TagPaddingY+fontHeight)
+		x += p.width + TagGap
+	}
+}
+
+// labelColor returns black for light fills and white for dark ones
+func labelColor(fill color.Color) color.Color {
+	c := color.NRGBAModel.Convert(fill).(color.NRGBA)
+	luminance := 0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)
+	if luminance > 140 {
+		return color.Black
+	}
+	return color.White
+}
+
+// drawAbove draws the tags in as many rows as fit between the top of the
+// overlay and the title's first line, with the last row just above the
+// title. If the URL is on the first grid line the rows stay in the top
+// margin above it. Rows are aligned like the title and narrowed to keep
+// clear of avoid.
+func (t tagSet) drawAbove(dc *gg.Context, fonts *fontCache, title titleLayout, urlVAlign string, width int, avoid image.Rectangle) error {
+	if len(t.labels) == 0 || t.position != TagsAbove {
+		return nil
+	}
+	face, err := fonts.setFace(dc, t.fontPath, TagFontSize)
+	if err != nil {
+		return fmt.Errorf("load font for tags: %w", err)
+	}
+
+	h := pillHeight(dc)
+	top := 2 * BackgroundMargin
+	bottom := title.baseline(0) - title.grid.fontHeight - 2*TagGap
+	if urlVAlign == VAlignTop {
+		bottom = TextTopMargin - 2*TagGap
+	}
+	maxRows := int((bottom - top + TagGap) / (h + TagGap))
+	x, maxWidth := textColumn(avoid, width, top, bottom, float64(width), AlignLeft)
+
+	rows := t.rows(shapedText{m: dc, face: face}, maxWidth, maxRows)
+	y := bottom - float64(len(rows))*(h+TagGap) + TagGap
+	for _, row := range rows {
+		drawPills(dc, face, row, x+alignOffset(title.align, maxWidth, rowWidth(row)), y)
+		y += h + TagGap
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package ogimage
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestNewTagSet(t *testing.T) {
+	colors := testPalette(t)
+
+	t.Run("fills", func(t *testing.T) {
+		opts := Options{
+			Tags:      []string{"Go", " ", "graphics", "rust "},
+			TagColor:  "#333333",
+			TagColors: map[string]string{"go": "#00add8", "RUST": "rgb(222, 165, 132)"},
+		}
+		tags, err := newTagSet(opts, colors, "font.ttf")
+		if err != nil {
+			t.Fatalf("newTagSet() error: %v", err)
+		}
+		if strings.Join(tags.labels, ",") != "Go,graphics,rust" {
+			t.Fatalf("labels = %q, want blank tag dropped", tags.labels)
+		}
+		want := []color.NRGBA{{0x00, 0xad, 0xd8, 0xff}, {0x33, 0x33, 0x33, 0xff}, {222, 165, 132, 0xff}}
+		for i, fill := range tags.fills {
+			if fill != want[i] {
+				t.Errorf("fill of %q = %v, want %v", tags.labels[i], fill, want[i])
+			}
+		}
+	})
+
+	t.Run("default fill is the URL color", func(t *testing.T) {
+		tags, err := newTagSet(Options{Tags: []string{"go"}}, colors, "font.ttf")
+		if err != nil {
+			t.Fatalf("newTagSet() error: %v", err)
+		}
+		if tags.fills[0] != colors.url || tags.more != colors.url {
+			t.Errorf("fill = %v, want URL color %v", tags.fills[0], colors.url)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{"invalid tag color", Options{TagColor: "blurple"}, "tag color: "},
+		{"invalid per-tag color", Options{TagColors: map[string]string{"go": "#12"}}, `tag color for "go"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTagSet(tt.opts, colors, "font.ttf")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newTagSet() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTagRows(t *testing.T) {
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(testFontPath(t), TagFontSize); err != nil {
+		t.Fatal(err)
+	}
+	tags := tagSet{labels: []string{"tag1", "tag2", "tag3", "tag4", "tag5"}}
+	tags.fills = make([]color.Color, len(tags.labels))
+	pillWidth := newPill(dc, "tag1", nil).width
+	// Room for two pills a row
+	twoWide := 2*pillWidth + TagGap + 1
+
+	labels := func(rows [][]pill) string {
+		var out []string
+		for _, row := range rows {
+			var names []string
+			for _, p := range row {
+				names = append(names, p.label)
+			}
+			out = append(out, strings.Join(names, " "))
+		}
+		return strings.Join(out, " / ")
+	}
+
+	tests := []struct {
+		name     string
+		maxWidth float64
+		maxRows  int
+		want     string
+	}{
+		{"one row", 1000, 1, "tag1 tag2 tag3 tag4 tag5"},
+		{"wraps", twoWide, 3, "tag1 tag2 / tag3 tag4 / tag5"},
+		{"counts the rest", twoWide, 2, "tag1 tag2 / tag3 +2"},
+		{"single row makes room for the count", twoWide, 1, "tag1 +4"},
+		{"zero rows is one row", twoWide, 0, "tag1 +4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := tags.rows(dc, tt.maxWidth, tt.maxRows)
+			if got := labels(rows); got != tt.want {
+				t.Errorf("rows() = %q, want %q", got, tt.want)
+			}
+			for _, row := range rows {
+				if w := rowWidth(row); w > tt.maxWidth {
+					t.Errorf("row %q is %g wide, want at most %g", labels([][]pill{row}), w, tt.maxWidth)
+				}
+			}
+		})
+	}
+
+	t.Run("long label is cut", func(t *testing.T) {
+		long := tagSet{labels: []string{strings.Repeat("performance", 10)}, fills: []color.Color{nil}}
+		rows := long.rows(dc, 300, 1)
+		if p := rows[0][0]; p.width > 300 || !strings.HasSuffix(p.label, ellipsis) {
+			t.Errorf("pill = %q, %g wide, want cut to 300 with an ellipsis", p.label, p.width)
+		}
+	})
+}
+
+func TestDrawRoundedRect(t *testing.T) {
+	alpha := func(img image.Image, x, y int) uint32 {
+		_, _, _, a := img.At(x, y).RGBA()
+		return a
+	}
+
+	t.Run("pill", func(t *testing.T) {
+		dc := gg.NewContext(100, 40)
+		dc.SetColor(color.Black)
+		drawRoundedRect(dc, 0, 0, 100, 40, 20, 20)
+		dc.Fill()
+		img := dc.Image()
+		for _, p := range []image.Point{{1, 1}, {98, 1}, {1, 38}, {98, 38}} {
+			if a := alpha(img, p.X, p.Y); a != 0 {
+				t.Errorf("corner %v alpha = %d, want transparent", p, a)
+			}
+		}
+		if a := alpha(img, 50, 20); a != 0xffff {
+			t.Errorf("center alpha = %d, want opaque", a)
+		}
+	})
+
+	t.Run("top corners only", func(t *testing.T) {
+		dc := gg.NewContext(100, 40)
+		dc.SetColor(color.Black)
+		drawRoundedRect(dc, 0, 0, 100, 40, 20, 0)
+		dc.Fill()
+		img := dc.Image()
+		if a := alpha(img, 1, 1); a != 0 {
+			t.Errorf("top corner alpha = %d, want transparent", a)
+		}
+		if a := alpha(img, 1, 38); a != 0xffff {
+			t.Errorf("bottom corner alpha = %d, want opaque", a)
+		}
+	})
+}
+
+func TestLabelColor(t *testing.T) {
+	tests := []struct {
+		fill color.Color
+		want color.Color
+	}{
+		{color.White, color.Black},
+		{color.NRGBA{0xe8, 0xe8, 0xe8, 0xdc}, color.Black},
+		{color.NRGBA{0x00, 0xad, 0xd8, 0xff}, color.White},
+		{color.Black, color.White},
+	}
+	for _, tt := range tests {
+		if got := labelColor(tt.fill); got != tt.want {
+			t.Errorf("labelColor(%v) = %v, want %v", tt.fill, got, tt.want)
+		}
+	}
+}
+
+func TestRenderTags(t *testing.T) {
+	fontPath := testFontPath(t)
+	render := func(opts Options) image.Image {
+		t.Helper()
+		opts.Title = "Hello"
+		opts.URL = "https://example.com"
+		opts.TitleFont = fontPath
+		opts.URLFont = fontPath
+		opts.Theme = Theme{Background: "#000000", Overlay: "#000000", OverlayOpacity: 1}
+		img, err := NewRenderer().Render(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Render() error: %v", err)
+		}
+		return img
+	}
+	// lit reports whether any pixel in r isn't black
+	lit := func(img image.Image, r image.Rectangle) bool {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if cr, cg, cb, _ := img.At(x, y).RGBA(); cr|cg|cb != 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	tags := []string{"go", "graphics"}
+	topMargin := image.Rect(int(TextSideMargin), int(2*BackgroundMargin), 600, int(TextTopMargin-TagGap))
+	afterURL := image.Rect(600, 450, 1140, 560)
+
+	t.Run("above", func(t *testing.T) {
+		if lit(render(Options{}), topMargin) {
+			t.Fatal("top margin is drawn on without tags")
+		}
+		if !lit(render(Options{Tags: tags}), topMargin) {
+			t.Error("no pills in the top margin")
+		}
+	})
+
+	t.Run("beside", func(t *testing.T) {
+		if lit(render(Options{}), afterURL) {
+			t.Fatal("URL line is drawn on after the URL without tags")
+		}
+		img := render(Options{Tags: tags, TagPosition: TagsBeside})
+		if !lit(img, afterURL) {
+			t.Error("no pills after the URL")
+		}
+		if lit(img, topMargin) {
+			t.Error("pills beside the URL drawn in the top margin")
+		}
+	})
+
+	t.Run("unknown position", func(t *testing.T) {
+		_, err := NewRenderer().Render(context.Background(), Options{Title: "T", URL: "U", TitleFont: fontPath, URLFont: fontPath, TagPosition: "below"})
+		if err == nil || !strings.Contains(err.Error(), `unknown tag position "below"`) {
+			t.Errorf("Render() error = %v, want unknown tag position", err)
+		}
+	})
+}
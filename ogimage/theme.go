@@ -0,0 +1,167 @@
+package ogimage
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Theme holds the colors an image is drawn with. Colors are CSS color
+// strings (see ParseColor); the background may also be a CSS
+// linear-gradient() or radial-gradient(). Empty colors and a zero
+// OverlayOpacity take the DarkTheme values, each on its own.
+type Theme struct {
+	Background string
+	Text       string
+	URL        string
+	Shadow     string
+	// Overlay is the color of the rounded panel drawn over the background
+	Overlay string
+	// OverlayOpacity scales the overlay's alpha up to 1, or is Transparent
+	// for no panel
+	OverlayOpacity float64
+	// Highlight is drawn behind ==highlighted== spans of the title
+	Highlight string
+}
+
+// Built-in themes
+var (
+	DarkTheme = Theme{
+		Background:     "#1a1a2e",
+		Text:           "#ffffff",
+		URL:            "#e8e8e8dc",
+		Shadow:         "#000000",
+		Overlay:        "#000000",
+		OverlayOpacity: 100.0 / 255, // the alpha of 100 the original cards used
+		Highlight:      "#e94560",
+	}
+	LightTheme = Theme{
+		Background:     "#f4f1ea",
+		Text:           "#1a1a2e",
+		URL:            "#4a4a5e",
+		Shadow:         "#ffffff",
+		Overlay:        "#ffffff",
+		OverlayOpacity: 0.6,
+		Highlight:      "#ffe066",
+	}
+	SolarizedTheme = Theme{
+		Background:     "#002b36",
+		Text:           "#eee8d5",
+		URL:            "#93a1a1",
+		Shadow:         "#00212b",
+		Overlay:        "#073642",
+		OverlayOpacity: 0.8,
+		Highlight:      "#b58900",
+	}
+)
+
+// Themes maps the names of the built-in themes to their colors
+var Themes = map[string]Theme{
+	"dark":      DarkTheme,
+	"light":     LightTheme,
+	"solarized": SolarizedTheme,
+}
+
+// ThemeNames returns the names of the built-in themes, sorted
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LookupTheme returns the built-in theme with the given name, ignoring case
+func LookupTheme(name string) (Theme, bool) {
+	theme, ok := Themes[strings.ToLower(name)]
+	return theme, ok
+}
+
+// withDefaults returns a copy of t with empty colors and a zero overlay
+// opacity replaced by those of DarkTheme, and the opacity clamped to 0 to
+// 1, which makes Transparent 0. The zero Theme is DarkTheme.
+func (t Theme) withDefaults() Theme {
+	for _, c := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&t.Background, DarkTheme.Background},
+		{&t.Text, DarkTheme.Text},
+		{&t.URL, DarkTheme.URL},
+		{&t.Shadow, DarkTheme.Shadow},
+		{&t.Overlay, DarkTheme.Overlay},
+		{&t.Highlight, DarkTheme.Highlight},
+	} {
+		if *c.value == "" {
+			*c.value = c.fallback
+		}
+	}
+	if t.OverlayOpacity == 0 {
+		t.OverlayOpacity = DarkTheme.OverlayOpacity
+	}
+	t.OverlayOpacity = math.Max(0, math.Min(1, t.OverlayOpacity))
+	return t
+}
+
+// palette holds the parsed colors of a theme
+type palette struct {
+	background color.Color
+	// gradient replaces background when the theme's background is a
+	// linear-gradient() or radial-gradient()
+	gradient *gradient
+	text     color.Color
+	url      color.Color
+	shadow   color.Color
+	// overlay has its alpha already scaled by the overlay opacity
+	overlay   color.Color
+	highlight color.Color
+}
+
+// palette parses the theme's colors
+func (t Theme) palette() (palette, error) {
+	var p palette
+	if isGradient(t.Background) {
+		g, err := parseGradient(t.Background)
+		if err != nil {
+			return p, fmt.Errorf("background: %w", err)
+		}
+		p.gradient = g
+	} else {
+		c, err := ParseColor(t.Background)
+		if err != nil {
+			return p, fmt.Errorf("background color: %w", err)
+		}
+		p.background = c
+	}
+
+	for _, c := range []struct {
+		name  string
+		value string
+		dst   *color.Color
+	}{
+		{"text", t.Text, &p.text},
+		{"url", t.URL, &p.url},
+		{"shadow", t.Shadow, &p.shadow},
+		{"highlight", t.Highlight, &p.highlight},
+	} {
+		parsed, err := ParseColor(c.value)
+		if err != nil {
+			return p, fmt.Errorf("%s color: %w", c.name, err)
+		}
+		// Premultiplied in 8 bits, the dark theme's translucent URL
+		// color is exactly the one the original cards drew
+		*c.dst = color.RGBAModel.Convert(parsed)
+	}
+
+	overlay, err := ParseColor(t.Overlay)
+	if err != nil {
+		return p, fmt.Errorf("overlay color: %w", err)
+	}
+	overlay.A = uint8(math.Round(float64(overlay.A) * t.OverlayOpacity))
+	p.overlay = overlay
+
+	return p, nil
+}
@@ -0,0 +1,108 @@
+package ogimage
+
+import (
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestThemeWithDefaults(t *testing.T) {
+	t.Run("zero theme is dark", func(t *testing.T) {
+		if got := (Theme{}).withDefaults(); got != DarkTheme {
+			t.Errorf("withDefaults() = %+v, want DarkTheme", got)
+		}
+	})
+
+	t.Run("empty colors fall back", func(t *testing.T) {
+		got := Theme{Text: "#112233", OverlayOpacity: 0.5}.withDefaults()
+		want := DarkTheme
+		want.Text = "#112233"
+		want.OverlayOpacity = 0.5
+		if got != want {
+			t.Errorf("withDefaults() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("opacity is clamped", func(t *testing.T) {
+		if got := (Theme{Text: "#ffffff", OverlayOpacity: 3}).withDefaults(); got.OverlayOpacity != 1 {
+			t.Errorf("OverlayOpacity = %v, want 1", got.OverlayOpacity)
+		}
+		if got := (Theme{Text: "#ffffff", OverlayOpacity: -3}).withDefaults(); got.OverlayOpacity != 0 {
+			t.Errorf("OverlayOpacity = %v, want 0", got.OverlayOpacity)
+		}
+	})
+
+	t.Run("zero opacity falls back", func(t *testing.T) {
+		got := Theme{Background: "#000000", Overlay: "#ffffff"}.withDefaults()
+		if got.OverlayOpacity != DarkTheme.OverlayOpacity {
+			t.Errorf("OverlayOpacity = %v, want the DarkTheme %v", got.OverlayOpacity, DarkTheme.OverlayOpacity)
+		}
+		if got := (Theme{Overlay: "#ffffff", OverlayOpacity: Transparent}).withDefaults(); got.OverlayOpacity != 0 {
+			t.Errorf("Transparent OverlayOpacity = %v, want 0", got.OverlayOpacity)
+		}
+	})
+}
+
+func TestThemePalette(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlay string
+		opacity float64
+		want    color.NRGBA
+	}{
+		{"opaque overlay", "#000000", 0.4, color.NRGBA{0, 0, 0, 102}},
+		{"translucent overlay", "#ffffff80", 0.5, color.NRGBA{255, 255, 255, 64}},
+		{"dark theme", "#000000", DarkTheme.OverlayOpacity, color.NRGBA{0, 0, 0, 100}},
+		{"no overlay", "#073642", 0, color.NRGBA{0x07, 0x36, 0x42, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme := DarkTheme
+			theme.Overlay = tt.overlay
+			theme.OverlayOpacity = tt.opacity
+			colors, err := theme.palette()
+			if err != nil {
+				t.Fatalf("palette() unexpected error: %v", err)
+			}
+			if colors.overlay != tt.want {
+				t.Errorf("overlay = %v, want %v", colors.overlay, tt.want)
+			}
+		})
+	}
+
+	t.Run("dark URL color matches the original cards", func(t *testing.T) {
+		colors, err := DarkTheme.palette()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (color.RGBA{200, 200, 200, 220}); colors.url != want {
+			t.Errorf("url = %v, want %v", colors.url, want)
+		}
+	})
+
+	t.Run("invalid color names the field", func(t *testing.T) {
+		theme := DarkTheme
+		theme.Shadow = "blak"
+		_, err := theme.palette()
+		if err == nil || !strings.Contains(err.Error(), `shadow color: invalid color "blak"`) {
+			t.Errorf("palette() error = %v", err)
+		}
+	})
+}
+
+func TestLookupTheme(t *testing.T) {
+	for _, name := range []string{"dark", "Light", "SOLARIZED"} {
+		if _, ok := LookupTheme(name); !ok {
+			t.Errorf("LookupTheme(%q) not found", name)
+		}
+	}
+	if _, ok := LookupTheme("neon"); ok {
+		t.Error("LookupTheme(\"neon\") should not be found")
+	}
+
+	if got := ThemeNames(); !slices.Equal(got, []string{"dark", "light", "solarized"}) {
+		t.Errorf("ThemeNames() = %v", got)
+	}
+}
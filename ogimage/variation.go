@@ -0,0 +1,261 @@
+package ogimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	shapingfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+)
+
+// fontAxesSep separates a font path from the axis settings it is loaded
+// with. Like fontChainSep, it can't appear in a path.
+const fontAxesSep = "\x01"
+
+// withFontAxes returns path with axis settings, such as wght=800, for
+// fontCache to load a variable font at, added to or replacing those path
+// already has. Without settings it is path.
+func withFontAxes(path string, axes map[string]float64) string {
+	if len(axes) == 0 {
+		return path
+	}
+	if file, set := splitFontAxes(path); set != nil {
+		maps.Copy(set, axes)
+		path, axes = file, set
+	}
+	settings := make([]string, 0, len(axes))
+	for _, tag := range slices.Sorted(maps.Keys(axes)) {
+		settings = append(settings, tag+"="+strconv.FormatFloat(axes[tag], 'g', -1, 64))
+	}
+	return path + fontAxesSep + strings.Join(settings, ",")
+}
+
+// splitFontAxes returns the file and axis settings of a path from
+// withFontAxes
+func splitFontAxes(path string) (string, map[string]float64) {
+	file, settings, ok := strings.Cut(path, fontAxesSep)
+	if !ok {
+		return path, nil
+	}
+	axes := make(map[string]float64)
+	for _, setting := range strings.Split(settings, ",") {
+		tag, value, _ := strings.Cut(setting, "=")
+		axes[tag], _ = strconv.ParseFloat(value, 64)
+	}
+	return file, axes
+}
+
+// titleAxes returns the axis settings of the title font: TitleAxes, with
+// wght set to TitleWeight if it is set
+func (opts Options) titleAxes() (map[string]float64, error) {
+	if opts.TitleWeight < 0 || opts.TitleWeight > 1000 {
+		return nil, fmt.Errorf("title weight %g out of range: want 1 to 1000", opts.TitleWeight)
+	}
+	for tag := range opts.TitleAxes {
+		if len(tag) != 4 || strings.ContainsAny(tag, ",=") {
+			return nil, fmt.Errorf("unknown font axis %q: want a four-letter tag such as wdth", tag)
+		}
+	}
+	axes := maps.Clone(opts.TitleAxes)
+	if opts.TitleWeight != 0 {
+		if axes == nil {
+			axes = make(map[string]float64)
+		}
+		axes["wght"] = opts.TitleWeight
+	}
+	return axes, nil
+}
+
+// fontAxis is a design axis of a variable font, such as weight (wght) or
+// width (wdth), and its range
+type fontAxis struct {
+	tag           string
+	min, def, max float64
+}
+
+// parseFvar returns the axes of an fvar table
+func parseFvar(fvar fontTable) []fontAxis {
+	offset, count, size := fvar.u16(4), fvar.u16(8), fvar.u16(10)
+	var axes []fontAxis
+	for i := range count {
+		rec := offset + size*i
+		if size < 20 || rec+20 > len(fvar) {
+			break
+		}
+		axes = append(axes, fontAxis{
+			tag: string(fvar.span(rec, 4)),
+			min: fixed16(fvar.u32(rec + 4)),
+			def: fixed16(fvar.u32(rec + 8)),
+			max: fixed16(fvar.u32(rec + 12)),
+		})
+	}
+	return axes
+}
+
+// fixed16 converts a 16.16 fixed point value
+func fixed16(v int) float64 {
+	return float64(int32(v)) / 65536
+}
+
+// instantiate returns a static font of the variable TrueType font data at
+// the axis settings. go-text/typesetting normalizes the settings through
+// the fvar and avar tables and applies the gvar deltas to the outlines and
+// the HVAR or gvar deltas to the advances; the outlines are written back as
+// simple glyphs without hinting. Axes the font doesn't have are ignored,
+// and static fonts and CFF2 variable fonts are returned unchanged.
+func instantiate(data []byte, axes map[string]float64) ([]byte, error) {
+	tables, err := sfntTables(data)
+	if err != nil {
+		return nil, err
+	}
+	if tables["fvar"] == nil || tables["glyf"] == nil {
+		return data, nil
+	}
+	faces, err := shapingfont.ParseTTC(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	face := faces[0]
+
+	variations := make([]shapingfont.Variation, 0, len(axes))
+	for _, tag := range slices.Sorted(maps.Keys(axes)) {
+		variations = append(variations, shapingfont.Variation{Tag: ot.MustNewTag(tag), Value: float32(axes[tag])})
+	}
+	face.SetVariations(variations)
+	if !slices.ContainsFunc(face.Coords(), func(c shapingfont.VarCoord) bool { return c != 0 }) {
+		return data, nil
+	}
+
+	head, hhea := tables["head"], tables["hhea"]
+	numGlyphs := tables["maxp"].u16(4)
+	if len(head) < 54 || len(hhea) < 36 || numGlyphs == 0 {
+		return nil, fmt.Errorf("missing head, hhea or maxp table")
+	}
+
+	var glyf []byte
+	loca := make(fontTable, 0, 4*(numGlyphs+1))
+	hmtx := make(fontTable, 0, 4*numGlyphs)
+	for g := range numGlyphs {
+		glyph, lsb := writeOutline(glyphOutline(face, shapingfont.GID(g)))
+		loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf)))
+		glyf = append(glyf, glyph...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+		advance := math.Round(float64(face.HorizontalAdvance(shapingfont.GID(g))))
+		hmtx = binary.BigEndian.AppendUint16(hmtx, uint16(min(max(advance, 0), math.MaxUint16)))
+		hmtx = binary.BigEndian.AppendUint16(hmtx, uint16(lsb))
+	}
+	loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf)))
+
+	// Long loca offsets, and an advance for every glyph
+	head = slices.Clone(head)
+	binary.BigEndian.PutUint16(head[50:], 1)
+	hhea = slices.Clone(hhea)
+	binary.BigEndian.PutUint16(hhea[34:], uint16(numGlyphs))
+	tables["head"], tables["hhea"] = head, hhea
+	tables["glyf"], tables["loca"], tables["hmtx"] = glyf, loca, hmtx
+
+	// Variation data no longer applies, and neither do device metrics
+	for _, tag := range []string{"fvar", "avar", "gvar", "cvar", "HVAR", "VVAR", "MVAR", "STAT", "hdmx", "LTSH", "VDMX"} {
+		delete(tables, tag)
+	}
+	return writeSfnt(0x00010000, tables), nil
+}
+
+// glyphOutline returns the outline of a glyph at the variation of face,
+// in font units
+func glyphOutline(face *shapingfont.Face, g shapingfont.GID) []ot.Segment {
+	switch data := face.GlyphData(g).(type) {
+	case shapingfont.GlyphOutline:
+		return data.Segments
+	case shapingfont.GlyphBitmap:
+		if data.Outline != nil {
+			return data.Outline.Segments
+		}
+	case shapingfont.GlyphSVG:
+		return data.Outline.Segments
+	}
+	return nil
+}
+
+// writeOutline returns a simple glyf glyph of quadratic outline segments,
+// and its left side bearing. Each segment's end point is an on-curve
+// point and its control point an off-curve one; a contour that returns to
+// its first point doesn't repeat it.
+func writeOutline(segments []ot.Segment) (fontTable, int) {
+	if len(segments) == 0 {
+		return nil, 0
+	}
+	type point struct {
+		x, y    int
+		onCurve bool
+	}
+	var points []point
+	var ends []int
+	add := func(p ot.SegmentPoint, onCurve bool) {
+		x := int(min(max(math.Round(float64(p.X)), math.MinInt16), math.MaxInt16))
+		y := int(min(max(math.Round(float64(p.Y)), math.MinInt16), math.MaxInt16))
+		points = append(points, point{x, y, onCurve})
+	}
+	closeContour := func(start int) {
+		if n := len(points); n-start > 1 && points[n-1] == points[start] {
+			points = points[:n-1]
+		}
+		if len(points) > start {
+			ends = append(ends, len(points)-1)
+		}
+	}
+
+	start := 0
+	for _, s := range segments {
+		switch s.Op {
+		case ot.SegmentOpMoveTo:
+			closeContour(start)
+			start = len(points)
+			add(s.Args[0], true)
+		case ot.SegmentOpLineTo:
+			add(s.Args[0], true)
+		case ot.SegmentOpQuadTo:
+			add(s.Args[0], false)
+			add(s.Args[1], true)
+		}
+	}
+	closeContour(start)
+
+	xMin, yMin, xMax, yMax := points[0].x, points[0].y, points[0].x, points[0].y
+	for _, p := range points {
+		xMin, xMax = min(xMin, p.x), max(xMax, p.x)
+		yMin, yMax = min(yMin, p.y), max(yMax, p.y)
+	}
+
+	glyph := make([]byte, 0, 10+2*len(ends)+2+5*len(points))
+	for _, v := range []int{len(ends), xMin, yMin, xMax, yMax} {
+		glyph = binary.BigEndian.AppendUint16(glyph, uint16(v))
+	}
+	for _, end := range ends {
+		glyph = binary.BigEndian.AppendUint16(glyph, uint16(end))
+	}
+	glyph = binary.BigEndian.AppendUint16(glyph, 0)
+	for _, p := range points {
+		if p.onCurve {
+			glyph = append(glyph, 1)
+		} else {
+			glyph = append(glyph, 0)
+		}
+	}
+	x, y := 0, 0
+	for _, p := range points {
+		glyph, x = binary.BigEndian.AppendUint16(glyph, uint16(p.x-x)), p.x
+	}
+	for _, p := range points {
+		glyph, y = binary.BigEndian.AppendUint16(glyph, uint16(p.y-y)), p.y
+	}
+	return glyph, xMin
+}
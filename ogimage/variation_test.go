@@ -0,0 +1,211 @@
+package ogimage
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// testVariableFont is a font with a weight axis from 100 to 900, default
+// 400, at 1000 units per em. I is a bar from x = 100 to 200 that grows
+// 100 units wider at 900, as does its advance of 300; only two opposite
+// corners and the advance have deltas, so the other corners are
+// interpolated. L is I as a component of a composite glyph, moved right
+// by 50 units at 900, with its advance also growing by 100. The
+// component's flags have word-sized arguments that are an offset.
+func testVariableFont() []byte {
+	cmap := be{}.u16(0).u16(1).u16(3).u16(10).u32(12).
+		u16(12).u16(0).u32(40).u32(0).u32(2).
+		u32('I').u32('I').u32(1).
+		u32('L').u32('L').u32(2)
+
+	bar := be{}.u16(1).u16(100).u16(0).u16(200).u16(700).
+		u16(3).u16(0).
+		u8(1).u8(1).u8(1).u8(1).
+		u16(100).u16(0).u16(100).u16(0).
+		u16(0).u16(700).u16(0).u16(-700)
+	composite := be{}.u16(-1).u16(100).u16(0).u16(200).u16(700).
+		u16(0x0003).u16(1).u16(0).u16(0)
+	glyf := append(append(be{}, bar...), composite...)
+	loca := be{}.u16(0).u16(0).u16(len(bar) / 2).u16(len(glyf) / 2)
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint16(head[18:], 1000)
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[4:], 800)
+	binary.BigEndian.PutUint16(hhea[6:], uint16(0xffff-199))
+	binary.BigEndian.PutUint16(hhea[34:], 3)
+	maxp := append(be{}.u32(0x00010000).u16(3), make([]byte, 26)...)
+	post := append(be{}.u32(0x00030000), make([]byte, 28)...)
+	hmtx := be{}.u16(300).u16(0).u16(300).u16(100).u16(300).u16(100)
+
+	fvar := append(be{}.u16(1).u16(0).u16(16).u16(2).u16(1).u16(20).u16(0).u16(8), "wght"...).
+		u32(100 << 16).u32(400 << 16).u32(900 << 16).u16(0).u16(256)
+
+	// I: points 0 and 2 (the bottom left corner stays, the top right
+	// moves) and phantom point 5, the advance
+	barDeltas := be{}.u16(1).u16(10).
+		u16(10).u16(0x8000 | 0x2000).u16(0x4000).
+		u8(3).u8(2).u8(0).u8(2).u8(3).
+		u8(2).u8(0).u8(100).u8(100).
+		u8(0x82)
+	// L: its component and phantom points all have deltas, padded to an
+	// even length
+	compositeDeltas := be{}.u16(1).u16(10).
+		u16(7).u16(0x8000).u16(0x4000).
+		u8(4).u8(50).u8(0).u8(100).u8(0).u8(0).
+		u8(0x84).u8(0)
+	gvar := be{}.u16(1).u16(0).u16(1).u16(0).u32(0).u16(3).u16(0).u32(28).
+		u16(0).u16(0).u16(len(barDeltas) / 2).u16((len(barDeltas) + len(compositeDeltas)) / 2)
+	gvar = append(append(gvar, barDeltas...), compositeDeltas...)
+
+	return buildFont(map[string][]byte{
+		"cmap": cmap, "glyf": glyf, "loca": loca, "head": head, "hhea": hhea,
+		"maxp": maxp, "post": post, "hmtx": hmtx, "fvar": fvar, "gvar": gvar,
+	})
+}
+
+// withAvar returns a font with an avar table added that maps the
+// normalized weight 0.5, 650 in testVariableFont, to 0.8
+func withAvar(data []byte) []byte {
+	tables, err := sfntTables(data)
+	if err != nil {
+		panic(err)
+	}
+	font := make(map[string][]byte)
+	for tag, t := range tables {
+		font[tag] = t
+	}
+	font["avar"] = be{}.u16(1).u16(0).u16(0).u16(1).
+		u16(4).u16(0xc000).u16(0xc000).u16(0).u16(0).u16(0x2000).u16(0x3333).u16(0x4000).u16(0x4000)
+	return buildFont(font)
+}
+
+func TestInstantiate(t *testing.T) {
+	dir := t.TempDir()
+	path, avarPath := filepath.Join(dir, "variable.ttf"), filepath.Join(dir, "avar.ttf")
+	if err := os.WriteFile(path, testVariableFont(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(avarPath, withAvar(testVariableFont()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		axes         map[string]float64
+		bar, advance float64
+		shift        float64
+	}{
+		{"default", path, nil, 100, 300, 0},
+		{"default weight", path, map[string]float64{"wght": 400}, 100, 300, 0},
+		{"black", path, map[string]float64{"wght": 900}, 200, 400, 50},
+		{"halfway", path, map[string]float64{"wght": 650}, 150, 350, 25},
+		{"past the maximum", path, map[string]float64{"wght": 1000}, 200, 400, 50},
+		{"light has no deltas", path, map[string]float64{"wght": 100}, 100, 300, 0},
+		{"unknown axis", path, map[string]float64{"wdth": 75}, 100, 300, 0},
+		{"remapped by avar", avarPath, map[string]float64{"wght": 650}, 180, 380, 40},
+		{"avar keeps the maximum", avarPath, map[string]float64{"wght": 900}, 200, 400, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := loadFont(withFontAxes(tt.path, tt.axes))
+			if err != nil {
+				t.Fatalf("loadFont() error: %v", err)
+			}
+			// One unit per pixel
+			face, err := f.newFace(1000)
+			if err != nil {
+				t.Fatalf("newFace() error: %v", err)
+			}
+			check := func(r rune, left float64) {
+				t.Helper()
+				bounds, advance, _ := face.GlyphBounds(r)
+				want := fixed.Rectangle26_6{
+					Min: fixed.Point26_6{X: fixed26(left), Y: fixed26(-700)},
+					Max: fixed.Point26_6{X: fixed26(left + tt.bar), Y: 0},
+				}
+				if bounds != want || advance != fixed26(tt.advance) {
+					t.Errorf("%c bounds = %v advance %v, want %v advance %v", r, bounds, advance, want, fixed26(tt.advance))
+				}
+
+				// Both right corners moved, the one without a delta of its own too
+				dr, mask, maskp, _, _ := face.Glyph(fixed.Point26_6{}, r)
+				for _, y := range []int{-690, -10} {
+					p := image.Pt(int(left+tt.bar)-10, y)
+					if _, _, _, a := mask.At(maskp.X+p.X-dr.Min.X, maskp.Y+p.Y-dr.Min.Y).RGBA(); !p.In(dr) || a < 0x8000 {
+						t.Errorf("%c is not drawn at %v", r, p)
+					}
+				}
+			}
+			check('I', 100)
+			check('L', 100+tt.shift)
+		})
+	}
+}
+
+func TestRenderTitleWeight(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "variable.ttf")
+	if err := os.WriteFile(path, testVariableFont(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fontPath := testFontPath(t)
+
+	width := func(resolver FontResolver, weight float64) float64 {
+		t.Helper()
+		axes, err := Options{TitleWeight: weight}.titleAxes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r Renderer
+		chain, err := r.resolveFonts(resolver, path, axes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		face, err := r.fonts.face(chain, 100)
+		if err != nil {
+			t.Fatalf("face() error: %v", err)
+		}
+		return float64(font.MeasureString(face, "IIII")) / 64
+	}
+	regular := width(ResolveFontPath, 0)
+	if black := width(ResolveFontPath, 900); black != regular+40 {
+		t.Errorf("width at 900 = %g, want %g", black, regular+40)
+	}
+
+	// The axes of the resolver apply, and the title's replace them
+	black := func(name string) (string, map[string]float64, error) {
+		return name, map[string]float64{"wght": 900}, nil
+	}
+	if w := width(black, 0); w != regular+40 {
+		t.Errorf("width with the resolver's weight = %g, want %g", w, regular+40)
+	}
+	if w := width(black, 400); w != regular {
+		t.Errorf("width with the title weight = %g, want %g", w, regular)
+	}
+
+	for _, opts := range []Options{
+		{TitleWeight: 1200},
+		{TitleWeight: -1},
+		{TitleAxes: map[string]float64{"wd": 75}},
+	} {
+		opts.Title, opts.URL, opts.TitleFont, opts.URLFont = "Title", "example.com", fontPath, fontPath
+		if _, err := NewRenderer().Render(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "want") {
+			t.Errorf("Render(%v, %v) error = %v, want an invalid setting", opts.TitleWeight, opts.TitleAxes, err)
+		}
+	}
+
+	// Static fonts ignore the axes
+	opts := Options{Title: "Title", URL: "example.com", TitleFont: fontPath, URLFont: fontPath, TitleWeight: 800, TitleAxes: map[string]float64{"wdth": 75}}
+	if _, err := NewRenderer().Render(context.Background(), opts); err != nil {
+		t.Errorf("Render() with a static font error: %v", err)
+	}
+}
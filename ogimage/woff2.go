@@ -0,0 +1,464 @@
+package ogimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// woff2Tags are the table tags a WOFF2 table directory refers to by index
+var woff2Tags = []string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// woff2Reader reads the variable-length numbers of WOFF2 data, recording
+// the first read past its end
+type woff2Reader struct {
+	b   fontTable
+	pos int
+	err error
+}
+
+func (r *woff2Reader) bytes(n int) fontTable {
+	t := r.b.span(r.pos, n)
+	if t == nil && r.err == nil {
+		r.err = errors.New("truncated WOFF2 font")
+	}
+	r.pos += n
+	return t
+}
+
+func (r *woff2Reader) u8() int  { return r.bytes(1).u8(0) }
+func (r *woff2Reader) u16() int { return r.bytes(2).u16(0) }
+func (r *woff2Reader) i16() int { return r.bytes(2).i16(0) }
+func (r *woff2Reader) u32() int { return r.bytes(4).u32(0) }
+
+// base128 reads a UIntBase128, seven bits to a byte, most significant first
+func (r *woff2Reader) base128() int {
+	v := 0
+	for i := range 5 {
+		b := r.u8()
+		if i == 0 && b == 0x80 || v>>25 != 0 {
+			r.fail("invalid WOFF2 number")
+			return 0
+		}
+		v = v<<7 | b&0x7f
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.fail("invalid WOFF2 number")
+	return 0
+}
+
+// u255 reads a 255UInt16, a byte for values below 253
+func (r *woff2Reader) u255() int {
+	switch b := r.u8(); b {
+	case 253:
+		return r.u16()
+	case 254:
+		return r.u8() + 506
+	case 255:
+		return r.u8() + 253
+	default:
+		return b
+	}
+}
+
+func (r *woff2Reader) fail(msg string) {
+	if r.err == nil {
+		r.err = errors.New(msg)
+	}
+}
+
+// woff2Table is an entry of a WOFF2 table directory
+type woff2Table struct {
+	tag         string
+	length      int // of the table in the font
+	transformed bool
+	size        int       // as stored, transformed or not
+	data        fontTable // the size bytes of the table
+}
+
+// decodeWOFF2 unpacks a WOFF2 font, whose tables are compressed together
+// with Brotli after the glyf, loca and hmtx tables may have been
+// transformed to compress better
+func decodeWOFF2(data []byte) ([]byte, error) {
+	r := &woff2Reader{b: data}
+	r.bytes(4)
+	flavor := uint32(r.u32())
+	r.bytes(4) // length
+	n := r.u16()
+	r.bytes(6) // reserved, totalSfntSize
+	compressedSize := r.u32()
+	r.bytes(24) // versions and metadata
+
+	tables := make([]woff2Table, n)
+	total := 0
+	for i := range tables {
+		t := &tables[i]
+		flags := r.u8()
+		if index := flags & 0x3f; index < len(woff2Tags) {
+			t.tag = woff2Tags[index]
+		} else {
+			t.tag = string(r.bytes(4))
+		}
+		t.length = r.base128()
+		// glyf and loca are transformed unless their transform version is
+		// 3, the other tables if it is anything but 0
+		version := flags >> 6
+		if t.tag == "glyf" || t.tag == "loca" {
+			t.transformed = version == 0
+		} else {
+			t.transformed = version != 0
+		}
+		t.size = t.length
+		if t.transformed {
+			t.size = r.base128()
+		}
+		if total += t.size; total > maxWebFontSize {
+			return nil, errors.New("WOFF2 font is too large")
+		}
+	}
+	if flavor == 0x74746366 { // ttcf
+		return nil, errors.New("WOFF2 font collections are not supported")
+	}
+	compressed := r.bytes(compressedSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if n == 0 {
+		return nil, errors.New("not a font file")
+	}
+
+	stream, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), int64(total)+1))
+	if err != nil {
+		return nil, fmt.Errorf("WOFF2 data: %w", err)
+	}
+	if len(stream) != total {
+		return nil, fmt.Errorf("WOFF2 data: want %d bytes, got %d", total, len(stream))
+	}
+	byTag := make(map[string]*woff2Table, n)
+	for i := range tables {
+		t := &tables[i]
+		t.data, stream = stream[:t.size], stream[t.size:]
+		byTag[t.tag] = t
+	}
+
+	out := make(map[string]fontTable, n)
+	for _, t := range tables {
+		if !t.transformed {
+			out[t.tag] = t.data
+		}
+	}
+	var xMins []int
+	if glyf := byTag["glyf"]; glyf != nil && glyf.transformed {
+		if loca := byTag["loca"]; loca == nil || !loca.transformed {
+			return nil, errors.New("WOFF2 glyf table is transformed but loca is not")
+		}
+		glyfData, locaData, mins, err := decodeWOFF2Glyf(glyf.data)
+		if err != nil {
+			return nil, fmt.Errorf("WOFF2 table glyf: %w", err)
+		}
+		out["glyf"], out["loca"], xMins = glyfData, locaData, mins
+	}
+	if hmtx := byTag["hmtx"]; hmtx != nil && hmtx.transformed {
+		if xMins == nil {
+			return nil, errors.New("WOFF2 hmtx table is transformed but glyf is not")
+		}
+		out["hmtx"], err = decodeWOFF2Hmtx(hmtx.data, out["hhea"].u16(34), xMins)
+		if err != nil {
+			return nil, fmt.Errorf("WOFF2 table hmtx: %w", err)
+		}
+	}
+	for _, t := range tables {
+		if t.transformed && out[t.tag] == nil {
+			return nil, fmt.Errorf("WOFF2 table %s: unknown transform", t.tag)
+		}
+	}
+	return writeSfnt(flavor, out), nil
+}
+
+// glyf flags of simple glyph points and composite glyph components
+const (
+	glyfOnCurve      = 0x01
+	glyfXShort       = 0x02
+	glyfYShort       = 0x04
+	glyfXSame        = 0x10 // or positive, if short
+	glyfYSame        = 0x20
+	glyfOverlap      = 0x40
+	glyfArgWords     = 0x0001
+	glyfScale        = 0x0008
+	glyfMore         = 0x0020
+	glyfXYScale      = 0x0040
+	glyfTwoByTwo     = 0x0080
+	glyfInstructions = 0x0100
+)
+
+// decodeWOFF2Glyf rebuilds the glyf and loca tables from a transformed
+// glyf table, which stores the parts of all glyphs in separate streams:
+// contour counts, point counts, point flags, coordinates, composite
+// components, bounding boxes and instructions. It also returns the left
+// edge of each glyph, which a transformed hmtx table leaves out.
+func decodeWOFF2Glyf(data fontTable) (glyf, loca []byte, xMins []int, err error) {
+	h := &woff2Reader{b: data}
+	h.u16() // reserved
+	options := h.u16()
+	numGlyphs := h.u16()
+	shortLoca := h.u16() == 0
+	var sizes [7]int
+	for i := range sizes {
+		sizes[i] = h.u32()
+	}
+	var streams [7]*woff2Reader
+	for i, size := range sizes {
+		streams[i] = &woff2Reader{b: h.bytes(size)}
+	}
+	var overlap fontTable
+	if options&1 != 0 {
+		overlap = h.bytes((numGlyphs + 7) / 8)
+	}
+	if h.err != nil {
+		return nil, nil, nil, h.err
+	}
+	contours, points, flags, coords, composites, bboxes, instructions :=
+		streams[0], streams[1], streams[2], streams[3], streams[4], streams[5], streams[6]
+	bboxBitmap := bboxes.bytes(4 * ((numGlyphs + 31) / 32))
+
+	xMins = make([]int, numGlyphs)
+	offsets := make([]int, 0, numGlyphs+1)
+	for g := range numGlyphs {
+		offsets = append(offsets, len(glyf))
+		nContours := contours.i16()
+		hasBBox := bboxBitmap.u8(g/8)&(0x80>>(g%8)) != 0
+		var bbox [4]int
+		if hasBBox {
+			bbox = [4]int{bboxes.i16(), bboxes.i16(), bboxes.i16(), bboxes.i16()}
+		}
+
+		var glyph []byte
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, fmt.Errorf("glyph %d: empty glyph with a bounding box", g)
+			}
+		case nContours > 0:
+			ends := make([]int, nContours)
+			total := 0
+			for i := range ends {
+				total += points.u255()
+				ends[i] = total - 1
+			}
+			if total > len(flags.b)-flags.pos {
+				return nil, nil, nil, fmt.Errorf("glyph %d: truncated points", g)
+			}
+			pts := make([]glyfPoint, total)
+			x, y := 0, 0
+			for i := range pts {
+				dx, dy, on := woff2Triplet(flags.u8(), coords)
+				x, y = x+dx, y+dy
+				pts[i] = glyfPoint{x, y, on}
+			}
+			if !hasBBox {
+				bbox = pointBounds(pts)
+			}
+			glyph = appendU16s(nil, nContours, bbox[0], bbox[1], bbox[2], bbox[3])
+			glyph = appendU16s(glyph, ends...)
+			n := coords.u255()
+			glyph = append(appendU16s(glyph, n), instructions.bytes(n)...)
+			glyph = appendGlyfPoints(glyph, pts, overlap.u8(g/8)&(0x80>>(g%8)) != 0)
+		case nContours == -1:
+			if !hasBBox {
+				return nil, nil, nil, fmt.Errorf("glyph %d: composite glyph without a bounding box", g)
+			}
+			start := composites.pos
+			hasInstructions := false
+			for more := true; more; {
+				component := composites.u16()
+				size := 4 // flags and glyph index
+				if component&glyfArgWords != 0 {
+					size += 4
+				} else {
+					size += 2
+				}
+				switch {
+				case component&glyfScale != 0:
+					size += 2
+				case component&glyfXYScale != 0:
+					size += 4
+				case component&glyfTwoByTwo != 0:
+					size += 8
+				}
+				composites.bytes(size - 2)
+				hasInstructions = hasInstructions || component&glyfInstructions != 0
+				more = component&glyfMore != 0 && composites.err == nil
+			}
+			glyph = appendU16s(nil, nContours, bbox[0], bbox[1], bbox[2], bbox[3])
+			glyph = append(glyph, composites.b.span(start, composites.pos-start)...)
+			if hasInstructions {
+				n := coords.u255()
+				glyph = append(appendU16s(glyph, n), instructions.bytes(n)...)
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("glyph %d: %d contours", g, nContours)
+		}
+		xMins[g] = bbox[0]
+		glyf = append(glyf, glyph...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	offsets = append(offsets, len(glyf))
+	for _, s := range append(streams[:], h) {
+		if s.err != nil {
+			return nil, nil, nil, s.err
+		}
+	}
+
+	if shortLoca && len(glyf)/2 > 0xffff {
+		return nil, nil, nil, errors.New("glyphs too large for short loca offsets")
+	}
+	for _, off := range offsets {
+		if shortLoca {
+			loca = binary.BigEndian.AppendUint16(loca, uint16(off/2))
+		} else {
+			loca = binary.BigEndian.AppendUint32(loca, uint32(off))
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+// appendU16s appends each of vs as a 16-bit big-endian value, signed or not
+func appendU16s(b []byte, vs ...int) []byte {
+	for _, v := range vs {
+		b = binary.BigEndian.AppendUint16(b, uint16(v))
+	}
+	return b
+}
+
+// glyfPoint is a point of a simple glyph's outline
+type glyfPoint struct {
+	x, y int
+	on   bool
+}
+
+// woff2Triplet decodes the flag and coordinates of a point, relative to
+// the previous one. The flag's low seven bits choose how many bytes of
+// coords hold the x and y offsets and how they are split; its high bit is
+// set for off-curve points.
+func woff2Triplet(flag int, coords *woff2Reader) (dx, dy int, on bool) {
+	sign := func(bit, v int) int {
+		if flag>>bit&1 == 0 {
+			return -v
+		}
+		return v
+	}
+	on = flag&0x80 == 0
+	switch flag &= 0x7f; {
+	case flag < 10:
+		dy = sign(0, (flag&14)<<7+coords.u8())
+	case flag < 20:
+		dx = sign(0, ((flag-10)&14)<<7+coords.u8())
+	case flag < 84:
+		b0, b1 := flag-20, coords.u8()
+		dx = sign(0, 1+b0&0x30+b1>>4)
+		dy = sign(1, 1+(b0&0x0c)<<2+b1&0x0f)
+	case flag < 120:
+		b0 := flag - 84
+		dx = sign(0, 1+(b0/12)<<8+coords.u8())
+		dy = sign(1, 1+((b0%12)>>2)<<8+coords.u8())
+	case flag < 124:
+		b := coords.bytes(3)
+		dx = sign(0, b.u8(0)<<4+b.u8(1)>>4)
+		dy = sign(1, (b.u8(1)&0x0f)<<8+b.u8(2))
+	default:
+		b := coords.bytes(4)
+		dx = sign(0, b.u16(0))
+		dy = sign(1, b.u16(2))
+	}
+	return dx, dy, on
+}
+
+// pointBounds returns the xMin, yMin, xMax and yMax of pts
+func pointBounds(pts []glyfPoint) [4]int {
+	b := [4]int{pts[0].x, pts[0].y, pts[0].x, pts[0].y}
+	for _, p := range pts[1:] {
+		b = [4]int{min(b[0], p.x), min(b[1], p.y), max(b[2], p.x), max(b[3], p.y)}
+	}
+	return b
+}
+
+// appendGlyfPoints appends the flags and coordinates of a simple glyph's
+// points, each coordinate as a byte when it moves less than 256 units
+func appendGlyfPoints(glyph []byte, pts []glyfPoint, overlap bool) []byte {
+	var xs, ys []byte
+	px, py := 0, 0
+	for i, p := range pts {
+		var flag byte
+		if p.on {
+			flag |= glyfOnCurve
+		}
+		if i == 0 && overlap {
+			flag |= glyfOverlap
+		}
+		flag, xs = appendGlyfCoord(flag, xs, p.x-px, glyfXShort, glyfXSame)
+		flag, ys = appendGlyfCoord(flag, ys, p.y-py, glyfYShort, glyfYSame)
+		glyph = append(glyph, flag)
+		px, py = p.x, p.y
+	}
+	return append(append(glyph, xs...), ys...)
+}
+
+func appendGlyfCoord(flag byte, out []byte, d int, short, same byte) (byte, []byte) {
+	switch {
+	case d == 0:
+		return flag | same, out
+	case d > -256 && d < 256:
+		flag |= short
+		if d > 0 {
+			flag |= same
+		}
+		return flag, append(out, byte(max(d, -d)))
+	default:
+		return flag, binary.BigEndian.AppendUint16(out, uint16(int16(d)))
+	}
+}
+
+// decodeWOFF2Hmtx rebuilds an hmtx table whose left side bearings were
+// left out because they equal the glyphs' left edges
+func decodeWOFF2Hmtx(data fontTable, numHMetrics int, xMins []int) ([]byte, error) {
+	r := &woff2Reader{b: data}
+	flags := r.u8()
+	if numHMetrics == 0 || numHMetrics > len(xMins) {
+		return nil, fmt.Errorf("%d horizontal metrics for %d glyphs", numHMetrics, len(xMins))
+	}
+	advances := make([]int, numHMetrics)
+	for i := range advances {
+		advances[i] = r.u16()
+	}
+	lsb := func(g int) int {
+		if g < numHMetrics && flags&1 != 0 || g >= numHMetrics && flags&2 != 0 {
+			return xMins[g]
+		}
+		return r.i16()
+	}
+	var out []byte
+	for g, advance := range advances {
+		out = appendU16s(out, advance, lsb(g))
+	}
+	for g := numHMetrics; g < len(xMins); g++ {
+		out = appendU16s(out, lsb(g))
+	}
+	return out, r.err
+}
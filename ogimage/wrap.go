@@ -0,0 +1,291 @@
+package ogimage
+
+import (
+	"math"
+	"strings"
+)
+
+// Title wrapping modes
+const (
+	// WrapGreedy fills each line with as many words as fit, then moves a
+	// word down if the last line would be a single word
+	WrapGreedy = "greedy"
+	// WrapBalanced breaks the title into as few lines as WrapGreedy but
+	// picks the breaks that make the lines' rendered widths most even
+	WrapBalanced = "balanced"
+)
+
+// measurer measures the width and height of a string as it is drawn.
+// A *gg.Context measures it in its loaded font; a *richText measures each
+// styled run of a marked-up title in its own face.
+type measurer interface {
+	MeasureString(s string) (w, h float64)
+}
+
+// wrapLines wraps text to fit within maxWidth using the style's wrap mode,
+// then breaks any word too wide for a line of its own, hyphenating it in
+// the style's language
+func wrapLines(dc measurer, text string, maxWidth float64, style titleStyle) []string {
+	var lines []string
+	if style.wrap == WrapBalanced {
+		lines = wrapBalanced(dc, text, maxWidth)
+	} else {
+		lines = wrapText(dc, text, maxWidth)
+	}
+	return breakLongLines(dc, lines, maxWidth, loadHyphenator(style.hyphenate))
+}
+
+// wrapText wraps text to fit within maxWidth and prevents orphans.
+// Lines break at the break opportunities of breakUnits: at spaces, and
+// between ideographs in text written without them.
+// An orphan is when the last line contains only one word.
+// If an orphan is detected, the last word from the previous line is moved
+// to the last line so the final line has at least two words.
+func wrapText(dc measurer, text string, maxWidth float64) []string {
+	units := breakUnits(text)
+	if len(units) == 0 {
+		return nil
+	}
+
+	var lines []string
+	var currentLine strings.Builder
+
+	for _, unit := range units {
+		testLine := currentLine.String() + unit
+		if currentLine.Len() == 0 {
+			testLine = strings.TrimPrefix(unit, " ")
+		}
+
+		w, _ := dc.MeasureString(testLine)
+		if w > maxWidth && currentLine.Len() > 0 {
+			lines = append(lines, currentLine.String())
+			currentLine.Reset()
+			currentLine.WriteString(strings.TrimPrefix(unit, " "))
+		} else {
+			currentLine.Reset()
+			currentLine.WriteString(testLine)
+		}
+	}
+	if currentLine.Len() > 0 {
+		lines = append(lines, currentLine.String())
+	}
+
+	return preventOrphans(dc, lines)
+}
+
+// wrapBalanced breaks text into the same number of lines as wrapText,
+// choosing the breaks that minimize the sum of the squared space left at
+// the end of every line, measured with the font loaded in dc. A single word
+// on the last line is penalized as heavily as a line left empty. A word
+// wider than maxWidth gets a line of its own.
+func wrapBalanced(dc measurer, text string, maxWidth float64) []string {
+	words := breakUnits(text)
+	count := len(wrapText(dc, text, maxWidth))
+	if count <= 1 {
+		return wrapText(dc, text, maxWidth)
+	}
+
+	n := len(words)
+	widths := make(map[[2]int]float64)
+	lineWidth := func(i, j int) float64 {
+		if w, ok := widths[[2]int{i, j}]; ok {
+			return w
+		}
+		w, _ := dc.MeasureString(joinUnits(words[i:j]))
+		widths[[2]int{i, j}] = w
+		return w
+	}
+
+	// lineCost is the badness of a line of words[i:j]
+	lineCost := func(i, j int, last bool) float64 {
+		w := lineWidth(i, j)
+		if w > maxWidth {
+			if j-i > 1 {
+				return math.Inf(1)
+			}
+			w = maxWidth
+		}
+		cost := (maxWidth - w) * (maxWidth - w)
+		if last && j-i == 1 {
+			cost += maxWidth * maxWidth
+		}
+		return cost
+	}
+
+	// best[l][j] is the least cost of breaking words[:j] into l lines,
+	// and breaks[l][j] is where the last of those lines starts
+	best := make([][]float64, count+1)
+	breaks := make([][]int, count+1)
+	for l := range best {
+		best[l] = make([]float64, n+1)
+		breaks[l] = make([]int, n+1)
+		for j := range best[l] {
+			best[l][j] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+
+	for l := 1; l <= count; l++ {
+		for j := l; j <= n; j++ {
+			for i := l - 1; i < j; i++ {
+				if math.IsInf(best[l-1][i], 1) {
+					continue
+				}
+				cost := best[l-1][i] + lineCost(i, j, l == count)
+				if cost < best[l][j] {
+					best[l][j] = cost
+					breaks[l][j] = i
+				}
+			}
+		}
+	}
+
+	if math.IsInf(best[count][n], 1) {
+		return wrapText(dc, text, maxWidth)
+	}
+
+	lines := make([]string, count)
+	for l, j := count, n; l > 0; l-- {
+		i := breaks[l][j]
+		lines[l-1] = joinUnits(words[i:j])
+		j = i
+	}
+	return lines
+}
+
+// preventOrphans checks if the last line has only one word and if so,
+// moves the last word from the previous line to create a more balanced layout.
+// After fixing an orphan, it also checks if the line before the modified line
+// can be balanced by moving a word down. Words are the units of breakUnits,
+// so in Chinese or Japanese an orphan is a single character.
+func preventOrphans(dc measurer, lines []string) []string {
+	if len(lines) < 2 {
+		return lines
+	}
+
+	lastLine := lines[len(lines)-1]
+	lastLineWords := breakUnits(lastLine)
+
+	// Only fix if last line has exactly one word (orphan)
+	if len(lastLineWords) != 1 {
+		return lines
+	}
+
+	prevLine := lines[len(lines)-2]
+	prevLineWords := breakUnits(prevLine)
+
+	// Only move a word if the previous line has at least 2 words
+	if len(prevLineWords) < 2 {
+		return lines
+	}
+
+	// Move the last word from previous line to the last line
+	wordToMove := strings.TrimPrefix(prevLineWords[len(prevLineWords)-1], " ")
+	newPrevLine := joinUnits(prevLineWords[:len(prevLineWords)-1])
+	newLastLine := joinLines(wordToMove, lastLine)
+
+	lines[len(lines)-2] = newPrevLine
+	lines[len(lines)-1] = newLastLine
+
+	// Now check if we need to balance lines above the modified line
+	return balanceLinesUpward(dc, lines, len(lines)-2)
+}
+
+// balanceLinesUpward checks if the line at modifiedIdx can be balanced with the line above it.
+// If the line above ends with two words that both start after the width of the modified line,
+// move one word down to balance. This process continues upward as needed.
+func balanceLinesUpward(dc measurer, lines []string, modifiedIdx int) []string {
+	if modifiedIdx < 1 {
+		return lines
+	}
+
+	for idx := modifiedIdx; idx >= 1; idx-- {
+		currentLine := lines[idx]
+		aboveLine := lines[idx-1]
+
+		currentWidth, _ := dc.MeasureString(currentLine)
+		aboveWords := breakUnits(aboveLine)
+
+		// Need at least 2 words in the line above to consider balancing
+		if len(aboveWords) < 2 {
+			continue
+		}
+
+		// Check if the last two words of the line above both start after the current line's width
+		lineWithoutLastWord := joinUnits(aboveWords[:len(aboveWords)-1])
+		withoutWidth, _ := dc.MeasureString(lineWithoutLastWord)
+		wordWidth, _ := dc.MeasureString(strings.TrimPrefix(aboveWords[len(aboveWords)-2], " "))
+		secondToLastWordStart := withoutWidth - wordWidth
+
+		// If the second-to-last word starts at or after the current line's width,
+		// both trailing words are "hanging" past the current line, so move one down
+		if secondToLastWordStart >= currentWidth {
+			wordToMove := strings.TrimPrefix(aboveWords[len(aboveWords)-1], " ")
+			lines[idx-1] = lineWithoutLastWord
+			lines[idx] = joinLines(wordToMove, currentLine)
+			// Continue checking upward since we modified line idx-1
+		} else {
+			// No balancing needed at this level, stop propagating
+			break
+		}
+	}
+
+	return lines
+}
+
+// ellipsis ends the last line of a clamped title
+const ellipsis = "…"
+
+// clampLines keeps the first maxLines lines. The text that no longer fits
+// is cut from the end of the last kept line, at a word boundary where
+// possible, until the line and an ellipsis fit within maxWidth. A maxLines
+// of zero or less keeps every line.
+func clampLines(dc measurer, lines []string, maxLines int, maxWidth float64) []string {
+	if maxLines <= 0 || len(lines) <= maxLines {
+		return lines
+	}
+
+	clamped := append([]string(nil), lines[:maxLines]...)
+	clamped[maxLines-1] = ellipsize(dc, clamped[maxLines-1], maxWidth)
+	return clamped
+}
+
+// truncateLine returns line if it fits within maxWidth, and otherwise cuts
+// it like the last line of a clamped title
+func truncateLine(dc measurer, line string, maxWidth float64) string {
+	if w, _ := dc.MeasureString(line); w <= maxWidth {
+		return line
+	}
+	return ellipsize(dc, line, maxWidth)
+}
+
+// ellipsize cuts text from the end of line, at a word boundary where
+// possible, until the line and an ellipsis fit within maxWidth, and ends
+// it with the ellipsis
+func ellipsize(dc measurer, line string, maxWidth float64) string {
+	words := breakUnits(line)
+	fits := func(text string) bool {
+		w, _ := dc.MeasureString(text + ellipsis)
+		return w <= maxWidth
+	}
+
+	// Drop whole words, and trailing punctuation that would sit before
+	// the ellipsis
+	for n := len(words); n > 0; n-- {
+		text := strings.TrimRight(joinUnits(words[:n]), ",;:.-–—、。，")
+		if text != "" && fits(text) {
+			return text + ellipsis
+		}
+	}
+
+	// A single word wider than the line is cut between characters
+	if len(words) > 0 {
+		runes := []rune(strings.TrimPrefix(words[0], " "))
+		for n := len(runes) - 1; n > 0; n-- {
+			if fits(string(runes[:n])) {
+				return string(runes[:n]) + ellipsis
+			}
+		}
+	}
+	return ellipsis
+}
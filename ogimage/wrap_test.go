@@ -0,0 +1,443 @@
+package ogimage
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+// runeWidths measures a string as one unit per character, with style runes
+// taking no width, as a monospaced font would
+type runeWidths struct{}
+
+func (runeWidths) MeasureString(s string) (w, h float64) {
+	for _, r := range s {
+		if !isStyleRune(r) {
+			w++
+		}
+	}
+	return w, 1
+}
+
+func TestPreventOrphans(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name:     "no lines",
+			input:    []string{},
+			expected: []string{},
+		},
+		{
+			name:     "single line",
+			input:    []string{"Hello World"},
+			expected: []string{"Hello World"},
+		},
+		{
+			name:     "two lines no orphan",
+			input:    []string{"Hello World", "Foo Bar"},
+			expected: []string{"Hello World", "Foo Bar"},
+		},
+		{
+			name:     "orphan on last line",
+			input:    []string{"Hello World Foo", "Bar"},
+			expected: []string{"Hello World", "Foo Bar"},
+		},
+		{
+			name:     "three lines with orphan",
+			input:    []string{"First Line Here", "Second Line Words", "Orphan"},
+			expected: []string{"First Line Here", "Second Line", "Words Orphan"},
+		},
+		{
+			name:     "previous line has only one word - cannot fix",
+			input:    []string{"Hello", "World"},
+			expected: []string{"Hello", "World"},
+		},
+		{
+			name:     "last line already has multiple words",
+			input:    []string{"Hello World", "Foo Bar Baz"},
+			expected: []string{"Hello World", "Foo Bar Baz"},
+		},
+		{
+			name:     "nil input",
+			input:    nil,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := preventOrphans(runeWidths{}, tt.input)
+
+			if len(result) != len(tt.expected) {
+				t.Errorf("preventOrphans() returned %d lines, want %d", len(result), len(tt.expected))
+				return
+			}
+
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("preventOrphans()[%d] = %q, want %q", i, result[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWrapBalanced(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, 72); err != nil {
+		t.Fatalf("failed to load font: %v", err)
+	}
+
+	// spread is the difference between the widest and narrowest line
+	spread := func(lines []string) float64 {
+		lo, hi := math.Inf(1), 0.0
+		for _, line := range lines {
+			w, _ := dc.MeasureString(line)
+			lo, hi = math.Min(lo, w), math.Max(hi, w)
+		}
+		return hi - lo
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth float64
+	}{
+		{"two lines", "Mastering Concurrency Patterns in Modern Go Services", 1080},
+		{"three lines", "This is a longer title that should wrap across multiple lines in the image", 1080},
+		{"narrow column", "How to Build Fast and Reliable APIs in Go", 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			greedy := wrapText(dc, tt.text, tt.maxWidth)
+			balanced := wrapBalanced(dc, tt.text, tt.maxWidth)
+
+			if len(balanced) != len(greedy) {
+				t.Fatalf("wrapBalanced() = %d lines, want %d like wrapText", len(balanced), len(greedy))
+			}
+			if got := strings.Join(balanced, " "); got != tt.text {
+				t.Errorf("words changed: %q", got)
+			}
+			for _, line := range balanced {
+				if w, _ := dc.MeasureString(line); w > tt.maxWidth {
+					t.Errorf("line %q is %v wide, want at most %v", line, w, tt.maxWidth)
+				}
+			}
+			if len(strings.Fields(balanced[len(balanced)-1])) < 2 {
+				t.Errorf("last line %q is an orphan", balanced[len(balanced)-1])
+			}
+			if spread(balanced) > spread(greedy) {
+				t.Errorf("balanced spread %v is larger than greedy %v\nbalanced: %q\ngreedy: %q",
+					spread(balanced), spread(greedy), balanced, greedy)
+			}
+		})
+	}
+
+	t.Run("single line unchanged", func(t *testing.T) {
+		if got := wrapBalanced(dc, "Hello World", 1080); len(got) != 1 || got[0] != "Hello World" {
+			t.Errorf("wrapBalanced() = %q", got)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if got := wrapBalanced(dc, "  ", 1080); len(got) != 0 {
+			t.Errorf("wrapBalanced() = %q, want no lines", got)
+		}
+	})
+
+	t.Run("word wider than the line", func(t *testing.T) {
+		got := wrapBalanced(dc, "A Supercalifragilisticexpialidocious Title", 400)
+		if strings.Join(got, " ") != "A Supercalifragilisticexpialidocious Title" {
+			t.Errorf("wrapBalanced() = %q", got)
+		}
+	})
+}
+
+func TestClampLines(t *testing.T) {
+	fontPath := testFontPath(t)
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, 40); err != nil {
+		t.Fatalf("failed to load font: %v", err)
+	}
+	lines := []string{"The quick brown fox", "jumps over the lazy,", "dog and keeps running"}
+	width := func(s string) float64 {
+		w, _ := dc.MeasureString(s)
+		return w
+	}
+
+	t.Run("no limit", func(t *testing.T) {
+		if got := clampLines(dc, lines, 0, 1000); len(got) != 3 {
+			t.Errorf("clampLines() = %q, want all lines", got)
+		}
+	})
+
+	t.Run("fewer lines than limit", func(t *testing.T) {
+		if got := clampLines(dc, lines, 5, 1000); len(got) != 3 || got[2] != lines[2] {
+			t.Errorf("clampLines() = %q, want lines unchanged", got)
+		}
+	})
+
+	t.Run("ellipsis fits after last line", func(t *testing.T) {
+		got := clampLines(dc, lines, 2, 1000)
+		want := []string{"The quick brown fox", "jumps over the lazy…"}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("clampLines() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("words dropped to make room", func(t *testing.T) {
+		maxWidth := width("jumps over the lazy")
+		got := clampLines(dc, lines, 2, maxWidth)
+		if got[1] != "jumps over the…" {
+			t.Errorf("last line = %q, want %q", got[1], "jumps over the…")
+		}
+		if w := width(got[1]); w > maxWidth {
+			t.Errorf("last line is %v wide, want at most %v", w, maxWidth)
+		}
+	})
+
+	t.Run("long word cut between characters", func(t *testing.T) {
+		maxWidth := width("Supercal…")
+		got := clampLines(dc, []string{"Supercalifragilistic", "word"}, 1, maxWidth)
+		if len(got) != 1 || !strings.HasSuffix(got[0], "…") || width(got[0]) > maxWidth {
+			t.Errorf("clampLines() = %q, want one cut line within %v", got, maxWidth)
+		}
+	})
+
+	t.Run("does not modify input", func(t *testing.T) {
+		input := append([]string(nil), lines...)
+		clampLines(dc, input, 1, 100)
+		if input[0] != lines[0] {
+			t.Errorf("input modified: %q", input)
+		}
+	})
+}
+
+func TestWrapText(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	tests := []struct {
+		name           string
+		text           string
+		maxWidth       float64
+		minLines       int // minimum expected lines
+		checkNoOrphans bool
+	}{
+		{
+			name:           "empty text",
+			text:           "",
+			maxWidth:       500,
+			minLines:       0,
+			checkNoOrphans: false,
+		},
+		{
+			name:           "single word",
+			text:           "Hello",
+			maxWidth:       500,
+			minLines:       1,
+			checkNoOrphans: false,
+		},
+		{
+			name:           "short text fits on one line",
+			text:           "Hello World",
+			maxWidth:       500,
+			minLines:       1,
+			checkNoOrphans: false,
+		},
+		{
+			name:           "text wraps to multiple lines",
+			text:           "This is a longer title that should wrap across multiple lines",
+			maxWidth:       300,
+			minLines:       2,
+			checkNoOrphans: true,
+		},
+		{
+			name:           "title ending with single word should not orphan",
+			text:           "Building High-Performance Web Services Today",
+			maxWidth:       400,
+			minLines:       2,
+			checkNoOrphans: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := gg.NewContext(1200, 628)
+			if err := dc.LoadFontFace(fontPath, 72); err != nil {
+				t.Fatalf("failed to load font: %v", err)
+			}
+
+			lines := wrapText(dc, tt.text, tt.maxWidth)
+
+			if len(lines) < tt.minLines {
+				t.Errorf("wrapText() returned %d lines, want at least %d", len(lines), tt.minLines)
+			}
+
+			if tt.checkNoOrphans && len(lines) >= 2 {
+				lastLine := lines[len(lines)-1]
+				words := strings.Fields(lastLine)
+				if len(words) == 1 {
+					// Check if previous line has only one word (unavoidable orphan)
+					prevLine := lines[len(lines)-2]
+					prevWords := strings.Fields(prevLine)
+					if len(prevWords) >= 2 {
+						t.Errorf("wrapText() created orphan: last line has only one word %q", lastLine)
+					}
+				}
+			}
+
+			// Verify all words are preserved
+			originalWords := strings.Fields(tt.text)
+			var resultWords []string
+			for _, line := range lines {
+				resultWords = append(resultWords, strings.Fields(line)...)
+			}
+
+			if len(originalWords) != len(resultWords) {
+				t.Errorf("wrapText() lost words: got %d, want %d", len(resultWords), len(originalWords))
+			}
+		})
+	}
+}
+
+func TestWrapTextOrphanPrevention(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	// This test specifically verifies orphan prevention behavior
+	dc := gg.NewContext(1200, 628)
+	if err := dc.LoadFontFace(fontPath, 72); err != nil {
+		t.Fatalf("failed to load font: %v", err)
+	}
+
+	// Test with a title that would naturally create an orphan
+	// "Advanced Patterns for Building High-Performance Web Services"
+	// At certain widths, "Services" might end up alone on the last line
+	title := "Advanced Patterns for Building High-Performance Web Services"
+
+	// Use a width that would cause wrapping
+	lines := wrapText(dc, title, 600)
+
+	if len(lines) < 2 {
+		t.Skip("text did not wrap at this width, cannot test orphan prevention")
+	}
+
+	// Check that last line doesn't have a single word (unless unavoidable)
+	lastLine := lines[len(lines)-1]
+	lastWords := strings.Fields(lastLine)
+
+	if len(lastWords) == 1 {
+		// Verify this is unavoidable (previous line has only one word)
+		prevLine := lines[len(lines)-2]
+		prevWords := strings.Fields(prevLine)
+		if len(prevWords) >= 2 {
+			t.Errorf("orphan detected: last line %q has only one word, but previous line %q has %d words",
+				lastLine, prevLine, len(prevWords))
+		}
+	}
+}
+
+func TestPreventOrphansLineBalancing(t *testing.T) {
+	// Test the improved orphan algorithm that balances lines when a word is moved.
+	// When a word is moved from line N to line N+1, we check if line N-1 ends with
+	// two words that both start after the length of line N. If so, we move one word
+	// down to balance the lines.
+	//
+	// Example scenario:
+	// Before orphan prevention:
+	//   Line 1: "The as via or"      (length ~X)
+	//   Line 2: "with can alt"       (length ~Y, shorter)
+	//   Line 3: "vip"                (orphan)
+	//
+	// After basic orphan prevention (move "alt" down):
+	//   Line 1: "The as via or"      (length ~X)
+	//   Line 2: "with can"           (length ~Z, now even shorter)
+	//   Line 3: "alt vip"            (no longer orphan)
+	//
+	// With improved balancing, we check if line 1 ends with two words ("via or")
+	// that both start after the length of line 2 ("with can"). If "via" starts
+	// after the end of "with can", we should move "or" down to balance:
+	//   Line 1: "The as via"
+	//   Line 2: "or with can"
+	//   Line 3: "alt vip"
+
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name: "balance lines when previous line has trailing short words",
+			// Line 1: "aaaa bb cc" is longer than line 2: "dd ee"
+			// After orphan fix: line 2 becomes "dd" and line 3 becomes "ee ff"
+			// Now line 1 ends with "bb cc" - check if "bb" starts after len("dd")
+			// If so, move "cc" down to balance
+			input:    []string{"aaaa bb cc", "dd ee", "ff"},
+			expected: []string{"aaaa bb", "cc dd", "ee ff"},
+		},
+		{
+			name:     "no balancing needed when lines are already balanced",
+			input:    []string{"aaaa bbbb", "cccc dddd", "ee ff"},
+			expected: []string{"aaaa bbbb", "cccc dddd", "ee ff"},
+		},
+		{
+			name: "balance propagates up multiple lines",
+			// After orphan fix on line 3, line 2 becomes short, triggering balance from line 1
+			input:    []string{"aa bb cc dd", "ee ff gg", "hh"},
+			expected: []string{"aa bb cc", "dd ee ff", "gg hh"},
+		},
+		{
+			name:     "single line unchanged",
+			input:    []string{"hello world"},
+			expected: []string{"hello world"},
+		},
+		{
+			name:     "two lines no orphan unchanged",
+			input:    []string{"hello world", "foo bar"},
+			expected: []string{"hello world", "foo bar"},
+		},
+		{
+			// "bb" starts 5 characters in, past the 2 of "dd" but not its
+			// 8 bytes
+			name:     "style runes take no width",
+			input:    []string{"aaaa bb cc", "\ufdd1\ufdd3dd ee", "ff"},
+			expected: []string{"aaaa bb", "cc \ufdd1\ufdd3dd", "ee ff"},
+		},
+		{
+			name:     "characters are measured, not bytes",
+			input:    []string{"aaaa bb cc", "東京 ee", "ff"},
+			expected: []string{"aaaa bb", "cc東京", "ee ff"},
+		},
+		{
+			name: "orphan fixed but no balancing needed",
+			// After orphan fix, line 1 doesn't have trailing words past line 2's length
+			input:    []string{"aa bb", "cc dd ee", "ff"},
+			expected: []string{"aa bb", "cc dd", "ee ff"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := preventOrphans(runeWidths{}, tt.input)
+
+			if len(result) != len(tt.expected) {
+				t.Errorf("preventOrphans() returned %d lines, want %d\ngot: %v\nwant: %v",
+					len(result), len(tt.expected), result, tt.expected)
+				return
+			}
+
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("preventOrphans()[%d] = %q, want %q\nfull result: %v",
+						i, result[i], tt.expected[i], result)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"og-image-generator/ogimage"
+)
+
+// Limits for image parameters accepted by the HTTP server
+const (
+	MinServeDimension = 100
+	MaxServeDimension = 2400
+	MinServeTitleSize = 8.0
+	MaxServeTitleSize = 300.0
+	MaxServeTextLen   = 500
+	MaxServeMaxLines  = 20
+)
+
+// ServeOptions holds the configuration for the HTTP server
+type ServeOptions struct {
+	Addr      string
+	TitleFont string
+	URLFont   string
+	// BoldFont, ItalicFont and CodeFont draw the marked-up spans of titles
+	BoldFont   string
+	ItalicFont string
+	CodeFont   string
+	// TitleWeight and TitleAxes instance variable title fonts
+	TitleWeight float64
+	TitleAxes   map[string]float64
+	Theme       ogimage.Theme
+	Logo        ogimage.Logo
+	// MaxRenders is how many images are rendered at once; further requests
+	// get 503 Service Unavailable. Zero means GOMAXPROCS.
+	MaxRenders int
+}
+
+func parseServeFlags(args []string) (*ServeOptions, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	titleFont := fs.String("title-font", "", "Title font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	urlFont := fs.String("url-font", "", "URL font file path (TTF, OTF, WOFF or WOFF2) or installed family such as \"Inter:bold\", or a comma-separated list of fallbacks")
+	resolveTheme := themeFlags(fs)
+	resolveLogo := logoFlags(fs)
+	resolveInlineFonts := inlineFontFlags(fs)
+	resolveFontAxes := fontAxesFlags(fs)
+	configPath := fs.String("config", "", "Config file of default flag values (default .og-image.yaml if present)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := applyConfigFile(fs, *configPath); err != nil {
+		return nil, err
+	}
+	theme, err := resolveTheme()
+	if err != nil {
+		return nil, err
+	}
+	logo, err := resolveLogo()
+	if err != nil {
+		return nil, err
+	}
+
+	var fonts ogimage.Options
+	resolveInlineFonts(&fonts)
+	if err := resolveFontAxes(&fonts); err != nil {
+		return nil, err
+	}
+
+	return &ServeOptions{
+		Addr:        *addr,
+		TitleFont:   *titleFont,
+		URLFont:     *urlFont,
+		BoldFont:    fonts.BoldFont,
+		ItalicFont:  fonts.ItalicFont,
+		CodeFont:    fonts.CodeFont,
+		TitleWeight: fonts.TitleWeight,
+		TitleAxes:   fonts.TitleAxes,
+		Theme:       theme,
+		Logo:        logo,
+	}, nil
+}
+
+func runServe(args []string, resolver ogimage.FontResolver) error {
+	opts, err := parseServeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           newServeHandler(&ogimage.Renderer{ResolveFont: resolver}, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Printf("Serving social images on %s/og.png\n", opts.Addr)
+	return server.ListenAndServe()
+}
+
+// newServeHandler returns the HTTP handler that renders images on request.
+// Rendering is CPU bound, so requests beyond opts.MaxRenders are turned
+// away rather than queued. Render errors, which name font and image
+// files, are logged to stderr and not sent to the client.
+func newServeHandler(renderer *ogimage.Renderer, opts *ServeOptions) http.Handler {
+	maxRenders := opts.MaxRenders
+	if maxRenders <= 0 {
+		maxRenders = runtime.GOMAXPROCS(0)
+	}
+	renders := make(chan struct{}, maxRenders)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og.png", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderOpts, err := optionsFromQuery(r.URL.Query(), opts.Theme)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		renderOpts.TitleFont = opts.TitleFont
+		renderOpts.URLFont = opts.URLFont
+		renderOpts.BoldFont = opts.BoldFont
+		renderOpts.ItalicFont = opts.ItalicFont
+		renderOpts.CodeFont = opts.CodeFont
+		renderOpts.TitleWeight = opts.TitleWeight
+		renderOpts.TitleAxes = opts.TitleAxes
+		renderOpts.Logo = opts.Logo
+
+		select {
+		case renders <- struct{}{}:
+			defer func() { <-renders }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests in progress", http.StatusServiceUnavailable)
+			return
+		}
+
+		img, err := renderer.Render(r.Context(), *renderOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: render: %v\n", r.URL.RequestURI(), err)
+			http.Error(w, "failed to render image", http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: encode png: %v\n", r.URL.RequestURI(), err)
+			http.Error(w, "failed to render image", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(buf.Bytes())
+	})
+	return mux
+}
+
+// optionsFromQuery builds rendering options from request query parameters,
+// applying the same defaults as the command-line flags. theme is used unless
+// the request names a built-in theme.
+func optionsFromQuery(q url.Values, theme ogimage.Theme) (*ogimage.Options, error) {
+	opts := &ogimage.Options{
+		Title:     q.Get("title"),
+		URL:       q.Get("url"),
+		Subtitle:  q.Get("subtitle"),
+		Author:    q.Get("author"),
+		Date:      q.Get("date"),
+		Tags:      splitList(q.Get("tags")),
+		Width:     ogimage.DefaultWidth,
+		Height:    ogimage.DefaultHeight,
+		Theme:     theme,
+		TitleSize: ogimage.TitleFontSize,
+	}
+
+	if opts.Title == "" || opts.URL == "" {
+		return nil, fmt.Errorf("title and url are required")
+	}
+	if len(opts.Title) > MaxServeTextLen || len(opts.URL) > MaxServeTextLen {
+		return nil, fmt.Errorf("title and url must be at most %d bytes", MaxServeTextLen)
+	}
+	if len(opts.Subtitle) > MaxServeTextLen || len(opts.Author)+len(opts.Date) > MaxServeTextLen {
+		return nil, fmt.Errorf("subtitle, author and date must be at most %d bytes", MaxServeTextLen)
+	}
+	if len(q.Get("tags")) > MaxServeTextLen || len(q.Get("tag-colors")) > MaxServeTextLen {
+		return nil, fmt.Errorf("tags and tag-colors must be at most %d bytes", MaxServeTextLen)
+	}
+	if len(q.Get("bg")) > MaxServeTextLen {
+		return nil, fmt.Errorf("bg must be at most %d bytes", MaxServeTextLen)
+	}
+
+	if name := q.Get("theme"); name != "" {
+		var ok bool
+		if opts.Theme, ok = ogimage.LookupTheme(name); !ok {
+			return nil, fmt.Errorf("unknown theme %q", name)
+		}
+	}
+	opts.BgColor = opts.Theme.Background
+	if bg := q.Get("bg"); bg != "" {
+		if err := ogimage.ValidateBackground(bg); err != nil {
+			return nil, fmt.Errorf("bg: %w", err)
+		}
+		opts.BgColor = bg
+	}
+
+	var err error
+	if opts.Width, err = intParam(q, "width", opts.Width, MinServeDimension, MaxServeDimension); err != nil {
+		return nil, err
+	}
+	if opts.Height, err = intParam(q, "height", opts.Height, MinServeDimension, MaxServeDimension); err != nil {
+		return nil, err
+	}
+	if opts.TitleSize, err = floatParam(q, "title-size", opts.TitleSize, MinServeTitleSize, MaxServeTitleSize); err != nil {
+		return nil, err
+	}
+	if opts.MaxLines, err = intParam(q, "max-lines", 0, 0, MaxServeMaxLines); err != nil {
+		return nil, err
+	}
+	switch opts.Wrap = q.Get("wrap"); opts.Wrap {
+	case "", ogimage.WrapGreedy, ogimage.WrapBalanced:
+	default:
+		return nil, fmt.Errorf("unknown wrap %q", opts.Wrap)
+	}
+	switch opts.Hyphenate = q.Get("hyphenate"); opts.Hyphenate {
+	case "", ogimage.HyphenateEnglish, ogimage.HyphenateGerman:
+	default:
+		return nil, fmt.Errorf("unknown hyphenation language %q", opts.Hyphenate)
+	}
+	for _, name := range []string{"align", "url-align"} {
+		switch a := q.Get(name); a {
+		case "", ogimage.AlignLeft, ogimage.AlignCenter, ogimage.AlignRight:
+		default:
+			return nil, fmt.Errorf("unknown %s %q", name, a)
+		}
+	}
+	for _, name := range []string{"valign", "url-valign"} {
+		switch v := q.Get(name); v {
+		case "", ogimage.VAlignTop, ogimage.VAlignMiddle, ogimage.VAlignBottom:
+		default:
+			return nil, fmt.Errorf("unknown %s %q", name, v)
+		}
+	}
+	opts.Align = q.Get("align")
+	opts.VAlign = q.Get("valign")
+	opts.URLAlign = q.Get("url-align")
+	opts.URLVAlign = q.Get("url-valign")
+
+	switch opts.TagPosition = q.Get("tag-position"); opts.TagPosition {
+	case "", ogimage.TagsAbove, ogimage.TagsBeside:
+	default:
+		return nil, fmt.Errorf("unknown tag-position %q", opts.TagPosition)
+	}
+	if c := q.Get("tag-color"); c != "" {
+		if _, err := ogimage.ParseColor(c); err != nil {
+			return nil, fmt.Errorf("tag-color: %w", err)
+		}
+		opts.TagColor = c
+	}
+	if opts.TagColors, err = parseTagColors(q.Get("tag-colors")); err != nil {
+		return nil, fmt.Errorf("tag-colors: %w", err)
+	}
+
+	return opts, nil
+}
+
+// intParam parses an optional integer query parameter within [lo, hi]
+func intParam(q url.Values, name string, def, lo, hi int) (int, error) {
+	s := q.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	if v < lo || v > hi {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, lo, hi)
+	}
+	return v, nil
+}
+
+// floatParam parses an optional numeric query parameter within [lo, hi]
+func floatParam(q url.Values, name string, def, lo, hi float64) (float64, error) {
+	s := q.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	// NaN compares false with both bounds, so it is rejected on its own
+	if math.IsNaN(v) || v < lo || v > hi {
+		return 0, fmt.Errorf("%s must be between %g and %g", name, lo, hi)
+	}
+	return v, nil
+}
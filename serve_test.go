@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"og-image-generator/ogimage"
+)
+
+// newTestServeHandler returns a handler that renders with the test font
+func newTestServeHandler(t *testing.T) http.Handler {
+	t.Helper()
+	fontPath := testFontPath(t)
+	return newServeHandler(ogimage.NewRenderer(), &ServeOptions{
+		TitleFont: fontPath,
+		URLFont:   fontPath,
+	})
+}
+
+func TestServeHandler(t *testing.T) {
+	handler := newTestServeHandler(t)
+
+	t.Run("renders png", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/og.png?title=Hello+World&url=https://example.com&bg=%23ff0000", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("Content-Type = %q, want %q", ct, "image/png")
+		}
+
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("response is not a valid png: %v", err)
+		}
+		if img.Bounds().Dx() != ogimage.DefaultWidth || img.Bounds().Dy() != ogimage.DefaultHeight {
+			t.Errorf("unexpected image dimensions: got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	})
+
+	t.Run("custom dimensions", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/og.png?title=Hello&url=https://example.com&width=800&height=400&title-size=48", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("response is not a valid png: %v", err)
+		}
+		if img.Bounds().Dx() != 800 || img.Bounds().Dy() != 400 {
+			t.Errorf("unexpected image dimensions: got %dx%d, want 800x400", img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	})
+
+	t.Run("head request has no body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/og.png?title=Hello&url=https://example.com", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("expected empty body, got %d bytes", rec.Body.Len())
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/og.png?title=Hello&url=https://example.com", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+		}
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/other.png", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/og.png?title=Hello&url=https://example.com&width=99999", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		if !strings.Contains(rec.Body.String(), "width must be between") {
+			t.Errorf("unexpected body: %s", rec.Body.String())
+		}
+	})
+}
+
+func TestServeHandlerErrors(t *testing.T) {
+	fontPath := testFontPath(t)
+
+	t.Run("render error hides font paths", func(t *testing.T) {
+		handler := newServeHandler(ogimage.NewRenderer(), &ServeOptions{
+			TitleFont: "/secret/fonts/missing.ttf",
+			URLFont:   fontPath,
+		})
+		req := httptest.NewRequest(http.MethodGet, "/og.png?title=Hello&url=https://example.com", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+		}
+		if body := rec.Body.String(); strings.Contains(body, "/secret") || !strings.Contains(body, "failed to render image") {
+			t.Errorf("unexpected body: %s", body)
+		}
+	})
+
+	t.Run("busy server turns requests away", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		renderer := &ogimage.Renderer{ResolveFont: func(name string) (string, map[string]float64, error) {
+			if name == "slow.ttf" {
+				started <- struct{}{}
+				<-release
+			}
+			return fontPath, nil, nil
+		}}
+		handler := newServeHandler(renderer, &ServeOptions{TitleFont: "slow.ttf", URLFont: fontPath, MaxRenders: 1})
+
+		done := make(chan int)
+		go func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/og.png?title=First&url=https://example.com", nil))
+			done <- rec.Code
+		}()
+		<-started
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/og.png?title=Second&url=https://example.com", nil))
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("status = %d with Retry-After %q, want %d with Retry-After", rec.Code, rec.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+		}
+
+		close(release)
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("first request status = %d, want %d", code, http.StatusOK)
+		}
+
+		// The slot is free again
+		go func() { <-started }()
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/og.png?title=Third&url=https://example.com", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("status after the render finished = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"defaults", "title=Hello&url=https://example.com", ""},
+		{"missing title", "url=https://example.com", "title and url are required"},
+		{"missing url", "title=Hello", "title and url are required"},
+		{"title too long", "title=" + strings.Repeat("a", MaxServeTextLen+1) + "&url=https://example.com", "at most"},
+		{"byline", "title=Hello&url=https://example.com&subtitle=A+tour&author=Ada&date=2024-03-05", ""},
+		{"subtitle too long", "title=Hello&url=https://example.com&subtitle=" + strings.Repeat("a", MaxServeTextLen+1), "subtitle, author and date must be at most"},
+		{"width not a number", "title=Hello&url=https://example.com&width=wide", "width must be an integer"},
+		{"width too small", "title=Hello&url=https://example.com&width=10", "width must be between"},
+		{"height too large", "title=Hello&url=https://example.com&height=5000", "height must be between"},
+		{"title size not a number", "title=Hello&url=https://example.com&title-size=big", "title-size must be a number"},
+		{"title size too large", "title=Hello&url=https://example.com&title-size=1000", "title-size must be between"},
+		{"title size NaN", "title=Hello&url=https://example.com&title-size=NaN", "title-size must be between"},
+		{"title size infinite", "title=Hello&url=https://example.com&title-size=-Inf", "title-size must be between"},
+		{"max lines", "title=Hello&url=https://example.com&max-lines=3", ""},
+		{"max lines negative", "title=Hello&url=https://example.com&max-lines=-1", "max-lines must be between"},
+		{"balanced wrap", "title=Hello&url=https://example.com&wrap=balanced", ""},
+		{"unknown wrap", "title=Hello&url=https://example.com&wrap=optimal", `unknown wrap "optimal"`},
+		{"hyphenate", "title=Hello&url=https://example.com&hyphenate=de", ""},
+		{"centered", "title=Hello&url=https://example.com&align=center&valign=middle&url-align=center&url-valign=top", ""},
+		{"unknown align", "title=Hello&url=https://example.com&url-align=justify", `unknown url-align "justify"`},
+		{"unknown valign", "title=Hello&url=https://example.com&valign=center", `unknown valign "center"`},
+		{"unknown hyphenation language", "title=Hello&url=https://example.com&hyphenate=xx", `unknown hyphenation language "xx"`},
+		{"tags", "title=Hello&url=https://example.com&tags=go,graphics&tag-position=beside&tag-color=%23333&tag-colors=go%3D%2300add8", ""},
+		{"unknown tag position", "title=Hello&url=https://example.com&tags=go&tag-position=below", `unknown tag-position "below"`},
+		{"invalid tag color", "title=Hello&url=https://example.com&tags=go&tag-color=blurple", "tag-color: "},
+		{"invalid tag colors", "title=Hello&url=https://example.com&tags=go&tag-colors=go", `tag-colors: "go": want tag=color`},
+		{"tags too long", "title=Hello&url=https://example.com&tags=" + strings.Repeat("a", MaxServeTextLen+1), "tags and tag-colors must be at most"},
+		{"invalid bg", "title=Hello&url=https://example.com&bg=%231a1a2", `bg: invalid color "#1a1a2"`},
+		{"bg too long", "title=Hello&url=https://example.com&bg=linear-gradient(" + strings.Repeat("red,", MaxServeTextLen/4) + "blue)", "bg must be at most"},
+		{"unknown theme", "title=Hello&url=https://example.com&theme=neon", "unknown theme \"neon\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts, err := optionsFromQuery(q, ogimage.DarkTheme)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("optionsFromQuery() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opts.Width != ogimage.DefaultWidth || opts.Height != ogimage.DefaultHeight {
+				t.Errorf("dimensions = %dx%d, want defaults", opts.Width, opts.Height)
+			}
+			if opts.TitleSize != ogimage.TitleFontSize {
+				t.Errorf("TitleSize = %f, want %f", opts.TitleSize, ogimage.TitleFontSize)
+			}
+			if opts.BgColor != "#1a1a2e" {
+				t.Errorf("BgColor = %q, want %q", opts.BgColor, "#1a1a2e")
+			}
+		})
+	}
+
+	t.Run("theme param", func(t *testing.T) {
+		q := url.Values{"title": {"Hello"}, "url": {"https://example.com"}, "theme": {"Light"}}
+		opts, err := optionsFromQuery(q, ogimage.DarkTheme)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Theme != ogimage.LightTheme || opts.BgColor != ogimage.LightTheme.Background {
+			t.Errorf("Theme = %+v, BgColor = %q, want light theme", opts.Theme, opts.BgColor)
+		}
+
+		q.Set("bg", "#ff0000")
+		if opts, _ = optionsFromQuery(q, ogimage.DarkTheme); opts.BgColor != "#ff0000" {
+			t.Errorf("BgColor = %q, want bg param to override theme", opts.BgColor)
+		}
+	})
+}
+
+func TestParseServeFlags(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		opts, err := parseServeFlags(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Addr != ":8080" {
+			t.Errorf("Addr = %q, want %q", opts.Addr, ":8080")
+		}
+	})
+
+	t.Run("all flags provided", func(t *testing.T) {
+		opts, err := parseServeFlags([]string{"-addr", "127.0.0.1:9000", "-title-font", "/t.ttf", "-url-font", "/u.ttf"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Addr != "127.0.0.1:9000" {
+			t.Errorf("Addr = %q, want %q", opts.Addr, "127.0.0.1:9000")
+		}
+		if opts.TitleFont != "/t.ttf" || opts.URLFont != "/u.ttf" {
+			t.Errorf("fonts = %q, %q", opts.TitleFont, opts.URLFont)
+		}
+	})
+
+	t.Run("theme", func(t *testing.T) {
+		opts, err := parseServeFlags([]string{"-theme", "solarized", "-text-color", "#ffffff"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if opts.Theme.Background != ogimage.SolarizedTheme.Background || opts.Theme.Text != "#ffffff" {
+			t.Errorf("Theme = %+v", opts.Theme)
+		}
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		if _, err := parseServeFlags([]string{"-nope"}); err == nil {
+			t.Error("expected error for unknown flag")
+		}
+	})
+}
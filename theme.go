@@ -0,0 +1,323 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"og-image-generator/ogimage"
+)
+
+// themeFlags registers -theme, -bg and the color flags on fs. The returned
+// function, called after parsing, starts from the named theme and overrides
+// the colors given on the command line or in the config file.
+func themeFlags(fs *flag.FlagSet) func() (ogimage.Theme, error) {
+	dark := ogimage.DarkTheme
+	name := fs.String("theme", "dark", "Color theme: "+strings.Join(ogimage.ThemeNames(), ", "))
+	bg := fs.String("bg", dark.Background, "Background color, or a CSS linear-gradient() or radial-gradient(), e.g. \"linear-gradient(135deg, #1a1a2e, #0f3460)\"")
+	text := fs.String("text-color", dark.Text, "Title text color, any CSS color")
+	urlColor := fs.String("url-color", dark.URL, "URL text color, any CSS color")
+	shadow := fs.String("shadow-color", dark.Shadow, "Title shadow color, any CSS color")
+	overlay := fs.String("overlay-color", dark.Overlay, "Background overlay color, any CSS color")
+	opacity := fs.Float64("overlay-opacity", dark.OverlayOpacity, "Background overlay opacity, from 0 to 1")
+	highlight := fs.String("highlight-color", dark.Highlight, "Color behind ==highlighted== title spans, any CSS color")
+
+	return func() (ogimage.Theme, error) {
+		theme, ok := ogimage.LookupTheme(*name)
+		if !ok {
+			return theme, fmt.Errorf("unknown theme %q: want one of %s", *name, strings.Join(ogimage.ThemeNames(), ", "))
+		}
+
+		// Only colors set explicitly override the theme; the flag
+		// defaults are the dark theme's
+		var invalid error
+		fs.Visit(func(f *flag.Flag) {
+			var err error
+			switch {
+			case f.Name == "bg":
+				err = ogimage.ValidateBackground(f.Value.String())
+			case strings.HasSuffix(f.Name, "-color"):
+				_, err = ogimage.ParseColor(f.Value.String())
+			}
+			if err != nil && invalid == nil {
+				invalid = fmt.Errorf("-%s: %w", f.Name, err)
+			}
+
+			switch f.Name {
+			case "bg":
+				theme.Background = *bg
+			case "text-color":
+				theme.Text = *text
+			case "url-color":
+				theme.URL = *urlColor
+			case "shadow-color":
+				theme.Shadow = *shadow
+			case "overlay-color":
+				theme.Overlay = *overlay
+			case "overlay-opacity":
+				// A zero opacity would take the default
+				theme.OverlayOpacity = *opacity
+				if *opacity == 0 {
+					theme.OverlayOpacity = ogimage.Transparent
+				}
+			case "highlight-color":
+				theme.Highlight = *highlight
+			}
+		})
+		if invalid != nil {
+			return theme, invalid
+		}
+
+		if !(*opacity >= 0 && *opacity <= 1) {
+			return theme, fmt.Errorf("overlay-opacity must be between 0 and 1")
+		}
+		return theme, nil
+	}
+}
+
+// bgImageFlags registers -bg-image and the flags that control how it is
+// drawn on fs. The returned function, called after parsing, validates them
+// and copies them into opts.
+func bgImageFlags(fs *flag.FlagSet) func(opts *ogimage.Options) error {
+	path := fs.String("bg-image", "", "Background image file path (PNG, JPEG, GIF or WebP)")
+	fit := fs.String("bg-fit", ogimage.FitCover, "Background image fit: cover, contain or fill")
+	blur := fs.Float64("bg-blur", 0, "Background image blur radius in pixels")
+	darken := fs.Float64("bg-darken", 0, "Background image darkening, from 0 to 1")
+
+	return func(opts *ogimage.Options) error {
+		switch *fit {
+		case ogimage.FitCover, ogimage.FitContain, ogimage.FitFill:
+		default:
+			return fmt.Errorf("unknown bg-fit %q: want cover, contain or fill", *fit)
+		}
+		if *blur < 0 {
+			return fmt.Errorf("bg-blur must not be negative")
+		}
+		if *darken < 0 || *darken > 1 {
+			return fmt.Errorf("bg-darken must be between 0 and 1")
+		}
+
+		opts.BgImage = *path
+		opts.BgFit = *fit
+		opts.BgBlur = *blur
+		opts.BgDarken = *darken
+		return nil
+	}
+}
+
+// logoFlags registers -logo and the flags that place it on fs. The returned
+// function, called after parsing, validates them.
+func logoFlags(fs *flag.FlagSet) func() (ogimage.Logo, error) {
+	path := fs.String("logo", "", "Logo or avatar file path (PNG, JPEG, GIF or WebP)")
+	position := fs.String("logo-position", ogimage.LogoBottomRight, "Logo corner: top-left, top-right, bottom-left or bottom-right")
+	size := fs.Float64("logo-size", ogimage.DefaultLogoSize, "Size of the box the logo is scaled to fit, in pixels")
+	padding := fs.Float64("logo-padding", ogimage.DefaultLogoPadding, "Distance from the logo to the card edges, in pixels")
+	opacity := fs.Float64("logo-opacity", 1, "Logo opacity, from 0 to 1")
+	circle := fs.Bool("logo-circle", false, "Crop the logo to a circle, for avatars")
+
+	return func() (ogimage.Logo, error) {
+		logo := ogimage.Logo{
+			Path:     *path,
+			Position: *position,
+			Size:     *size,
+			Padding:  *padding,
+			Opacity:  *opacity,
+			Circle:   *circle,
+		}
+		// The flags default to the defaults, so a zero was asked for
+		if logo.Padding == 0 {
+			logo.Padding = ogimage.NoLogoPadding
+		}
+		if logo.Opacity == 0 {
+			logo.Opacity = ogimage.Transparent
+		}
+		return logo, logo.Validate()
+	}
+}
+
+// titleLayoutFlags registers -wrap, -hyphenate, the alignment flags for
+// the title and URL, and -title-fit and its size range on fs.
+// The returned function, called after parsing, validates them and copies
+// them into opts.
+func titleLayoutFlags(fs *flag.FlagSet) func(opts *ogimage.Options) error {
+	wrap := fs.String("wrap", ogimage.WrapGreedy, "Title line breaking: greedy or balanced")
+	hyphenate := fs.String("hyphenate", "", "Hyphenate words too wide for a line: en or de (default none)")
+	align := fs.String("align", "", "Title alignment: left, center or right (default left, or right for a right-to-left title)")
+	valign := fs.String("valign", ogimage.VAlignTop, "Title placement: top, middle or bottom")
+	urlAlign := fs.String("url-align", "", "URL alignment: left, center or right (default left, or right for a right-to-left title)")
+	urlVAlign := fs.String("url-valign", ogimage.VAlignBottom, "URL placement: top, middle or bottom")
+	fit := fs.Bool("title-fit", false, "Use the largest title size that fits above the URL")
+	minSize := fs.Float64("title-min-size", ogimage.TitleMinFontSize, "Smallest title size for -title-fit, in points")
+	maxSize := fs.Float64("title-max-size", 0, "Largest title size for -title-fit, in points (default -title-size)")
+
+	return func(opts *ogimage.Options) error {
+		if *wrap != ogimage.WrapGreedy && *wrap != ogimage.WrapBalanced {
+			return fmt.Errorf("unknown wrap %q: want greedy or balanced", *wrap)
+		}
+		switch *hyphenate {
+		case "", ogimage.HyphenateEnglish, ogimage.HyphenateGerman:
+		default:
+			return fmt.Errorf("unknown hyphenation language %q: want en or de", *hyphenate)
+		}
+		for _, a := range []string{*align, *urlAlign} {
+			switch a {
+			case "", ogimage.AlignLeft, ogimage.AlignCenter, ogimage.AlignRight:
+			default:
+				return fmt.Errorf("unknown align %q: want left, center or right", a)
+			}
+		}
+		for _, v := range []string{*valign, *urlVAlign} {
+			switch v {
+			case ogimage.VAlignTop, ogimage.VAlignMiddle, ogimage.VAlignBottom:
+			default:
+				return fmt.Errorf("unknown valign %q: want top, middle or bottom", v)
+			}
+		}
+		if *minSize <= 0 || *maxSize < 0 {
+			return fmt.Errorf("title-min-size must be positive and title-max-size must not be negative")
+		}
+		if *maxSize != 0 && *minSize > *maxSize {
+			return fmt.Errorf("title-min-size must not be larger than title-max-size")
+		}
+
+		opts.Wrap = *wrap
+		opts.Hyphenate = *hyphenate
+		opts.Align = *align
+		opts.VAlign = *valign
+		opts.URLAlign = *urlAlign
+		opts.URLVAlign = *urlVAlign
+		opts.TitleFit = *fit
+		opts.TitleMinSize = *minSize
+		opts.TitleMaxSize = *maxSize
+		return nil
+	}
+}
+
+// inlineFontFlags registers the fonts of the bold, italic and code spans
+// of a marked-up title on fs. The returned function, called after
+// parsing, copies them into opts.
+func inlineFontFlags(fs *flag.FlagSet) func(opts *ogimage.Options) {
+	bold := fs.String("bold-font", "", "Font file path or family for **bold** title spans (default faux bold in the title font)")
+	italic := fs.String("italic-font", "", "Font file path or family for _italic_ title spans (default slanted title font)")
+	code := fs.String("code-font", "", "Font file path or family for code title spans (default the title font)")
+
+	return func(opts *ogimage.Options) {
+		opts.BoldFont = *bold
+		opts.ItalicFont = *italic
+		opts.CodeFont = *code
+	}
+}
+
+// fontAxesFlags registers -title-weight and -title-axes, the variable
+// font settings of the title, on fs. The returned function, called after
+// parsing, validates them and copies them into opts.
+func fontAxesFlags(fs *flag.FlagSet) func(opts *ogimage.Options) error {
+	weight := fs.Float64("title-weight", 0, "Title font weight from 1 to 1000, for variable fonts (default the font's own)")
+	axes := fs.String("title-axes", "", "Other variable font axes of the title, as comma-separated tag=value pairs, e.g. \"wdth=75,opsz=72\"")
+
+	return func(opts *ogimage.Options) error {
+		if *weight < 0 || *weight > 1000 {
+			return fmt.Errorf("title-weight %g out of range: want 1 to 1000", *weight)
+		}
+		byTag, err := parseFontAxes(*axes)
+		if err != nil {
+			return fmt.Errorf("-title-axes: %w", err)
+		}
+
+		opts.TitleWeight = *weight
+		opts.TitleAxes = byTag
+		return nil
+	}
+}
+
+// parseFontAxes parses comma-separated tag=value axis settings
+func parseFontAxes(s string) (map[string]float64, error) {
+	pairs := splitList(s)
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	byTag := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		tag, value, ok := strings.Cut(pair, "=")
+		tag, value = strings.TrimSpace(tag), strings.TrimSpace(value)
+		if !ok || len(tag) != 4 {
+			return nil, fmt.Errorf("%q: want a four-letter tag and a value, such as wdth=75", pair)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", tag, value)
+		}
+		byTag[tag] = v
+	}
+	return byTag, nil
+}
+
+// tagFlags registers -tag-position and the tag color flags on fs. The
+// returned function, called after parsing, validates them and copies them
+// into opts.
+func tagFlags(fs *flag.FlagSet) func(opts *ogimage.Options) error {
+	position := fs.String("tag-position", ogimage.TagsAbove, "Tag pills position: above (the title) or beside (the URL)")
+	fill := fs.String("tag-color", "", "Tag pill color (default the URL color)")
+	colors := fs.String("tag-colors", "", "Per-tag pill colors, as comma-separated tag=color pairs")
+
+	return func(opts *ogimage.Options) error {
+		if *position != ogimage.TagsAbove && *position != ogimage.TagsBeside {
+			return fmt.Errorf("unknown tag-position %q: want above or beside", *position)
+		}
+		byTag, err := parseTagColors(*colors)
+		if err != nil {
+			return fmt.Errorf("-tag-colors: %w", err)
+		}
+
+		opts.TagPosition = *position
+		opts.TagColor = *fill
+		opts.TagColors = byTag
+		return nil
+	}
+}
+
+// parseTagColors parses comma-separated tag=color pairs
+func parseTagColors(s string) (map[string]string, error) {
+	pairs := splitList(s)
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	byTag := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		tag, value, ok := strings.Cut(pair, "=")
+		tag, value = strings.TrimSpace(tag), strings.TrimSpace(value)
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("%q: want tag=color", pair)
+		}
+		if _, err := ogimage.ParseColor(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", tag, err)
+		}
+		byTag[tag] = value
+	}
+	return byTag, nil
+}
+
+// splitList splits a comma-separated list, ignoring commas inside
+// parentheses such as those of rgb() colors, and drops blank items
+func splitList(s string) []string {
+	var items []string
+	depth, start := 0, 0
+	for i, r := range s + "," {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth = max(depth-1, 0)
+		case ',':
+			if depth > 0 {
+				continue
+			}
+			if item := strings.TrimSpace(s[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+		}
+	}
+	return items
+}
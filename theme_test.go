@@ -0,0 +1,545 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"og-image-generator/ogimage"
+)
+
+func TestThemeFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    func() ogimage.Theme
+		wantErr string
+	}{
+		{
+			name: "default is dark",
+			want: func() ogimage.Theme { return ogimage.DarkTheme },
+		},
+		{
+			name: "named theme",
+			args: []string{"-theme", "light"},
+			want: func() ogimage.Theme { return ogimage.LightTheme },
+		},
+		{
+			name: "colors override theme",
+			args: []string{"-theme", "solarized", "-bg", "#000000", "-url-color", "#ff0000", "-overlay-opacity", "0"},
+			want: func() ogimage.Theme {
+				theme := ogimage.SolarizedTheme
+				theme.Background = "#000000"
+				theme.URL = "#ff0000"
+				theme.OverlayOpacity = ogimage.Transparent
+				return theme
+			},
+		},
+		{
+			name:    "unknown theme",
+			args:    []string{"-theme", "neon"},
+			wantErr: "unknown theme \"neon\": want one of dark, light, solarized",
+		},
+		{
+			name: "css colors",
+			args: []string{"-text-color", "rgb(10, 20, 30)", "-shadow-color", "transparent"},
+			want: func() ogimage.Theme {
+				theme := ogimage.DarkTheme
+				theme.Text = "rgb(10, 20, 30)"
+				theme.Shadow = "transparent"
+				return theme
+			},
+		},
+		{
+			name:    "invalid color",
+			args:    []string{"-bg", "#1a1a2"},
+			wantErr: `-bg: invalid color "#1a1a2"`,
+		},
+		{
+			name: "gradient background",
+			args: []string{"-bg", "linear-gradient(135deg, #1a1a2e, #0f3460)"},
+			want: func() ogimage.Theme {
+				theme := ogimage.DarkTheme
+				theme.Background = "linear-gradient(135deg, #1a1a2e, #0f3460)"
+				return theme
+			},
+		},
+		{
+			name:    "invalid gradient",
+			args:    []string{"-bg", "radial-gradient(red)"},
+			wantErr: "-bg: invalid gradient",
+		},
+		{
+			name:    "invalid text color",
+			args:    []string{"-text-color", "whit"},
+			wantErr: `-text-color: invalid color "whit"`,
+		},
+		{
+			name: "highlight color",
+			args: []string{"-theme", "light", "-highlight-color", "#a0e0ff"},
+			want: func() ogimage.Theme {
+				theme := ogimage.LightTheme
+				theme.Highlight = "#a0e0ff"
+				return theme
+			},
+		},
+		{
+			name:    "invalid highlight color",
+			args:    []string{"-highlight-color", "yelow"},
+			wantErr: `-highlight-color: invalid color "yelow"`,
+		},
+		{
+			name:    "opacity out of range",
+			args:    []string{"-overlay-opacity", "1.5"},
+			wantErr: "overlay-opacity must be between 0 and 1",
+		},
+		{
+			name:    "negative opacity",
+			args:    []string{"-overlay-opacity", "-1"},
+			wantErr: "overlay-opacity must be between 0 and 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveTheme := themeFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			theme, err := resolveTheme()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveTheme() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := tt.want(); theme != want {
+				t.Errorf("theme = %+v, want %+v", theme, want)
+			}
+		})
+	}
+}
+
+func TestThemeFromConfig(t *testing.T) {
+	path := writeManifest(t, "og.yaml", "theme: light\ntext_color: \"#ff0000\"\noverlay_opacity: 0.25\n")
+	opts, err := parseBatchFlags([]string{"-config", path, "-text-color", "#00ff00", "cards.csv"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := ogimage.LightTheme
+	want.Text = "#00ff00"
+	want.OverlayOpacity = 0.25
+	if opts.Defaults.Theme != want {
+		t.Errorf("Theme = %+v, want %+v", opts.Defaults.Theme, want)
+	}
+	if opts.Defaults.BgColor != ogimage.LightTheme.Background {
+		t.Errorf("BgColor = %q, want light theme background", opts.Defaults.BgColor)
+	}
+}
+
+func TestBgImageFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ogimage.Options
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: ogimage.Options{BgFit: ogimage.FitCover},
+		},
+		{
+			name: "all flags",
+			args: []string{"-bg-image", "hero.jpg", "-bg-fit", "contain", "-bg-blur", "8", "-bg-darken", "0.3"},
+			want: ogimage.Options{BgImage: "hero.jpg", BgFit: ogimage.FitContain, BgBlur: 8, BgDarken: 0.3},
+		},
+		{
+			name:    "unknown fit",
+			args:    []string{"-bg-fit", "tile"},
+			wantErr: `unknown bg-fit "tile"`,
+		},
+		{
+			name:    "negative blur",
+			args:    []string{"-bg-blur", "-2"},
+			wantErr: "bg-blur must not be negative",
+		},
+		{
+			name:    "darken out of range",
+			args:    []string{"-bg-darken", "2"},
+			wantErr: "bg-darken must be between 0 and 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveBgImage := bgImageFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var opts ogimage.Options
+			err := resolveBgImage(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveBgImage() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("opts = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestBgImageFromConfig(t *testing.T) {
+	path := writeManifest(t, "og.yaml", "bg_image: hero.png\nbg_fit: fill\nbg_darken: 0.5\n")
+	opts, err := parseContentFlags([]string{"-config", path, "-bg-darken", "0.2", "content"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Defaults.BgImage != "hero.png" || opts.Defaults.BgFit != ogimage.FitFill || opts.Defaults.BgDarken != 0.2 {
+		t.Errorf("Defaults = %+v", opts.Defaults)
+	}
+}
+
+// ptr returns a pointer to v, for the optional fields of ogimage.Logo
+func TestLogoFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ogimage.Logo
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: ogimage.Logo{Position: ogimage.LogoBottomRight, Size: ogimage.DefaultLogoSize, Padding: ogimage.DefaultLogoPadding, Opacity: 1},
+		},
+		{
+			name: "all flags",
+			args: []string{"-logo", "avatar.png", "-logo-position", "top-left", "-logo-size", "120", "-logo-padding", "30", "-logo-opacity", "0.8", "-logo-circle"},
+			want: ogimage.Logo{Path: "avatar.png", Position: ogimage.LogoTopLeft, Size: 120, Padding: 30, Opacity: 0.8, Circle: true},
+		},
+		{
+			name: "zero padding and opacity",
+			args: []string{"-logo", "avatar.png", "-logo-padding", "0", "-logo-opacity", "0"},
+			want: ogimage.Logo{Path: "avatar.png", Position: ogimage.LogoBottomRight, Size: ogimage.DefaultLogoSize, Padding: ogimage.NoLogoPadding, Opacity: ogimage.Transparent},
+		},
+		{
+			name:    "unknown position",
+			args:    []string{"-logo-position", "middle"},
+			wantErr: `unknown logo position "middle"`,
+		},
+		{
+			name:    "opacity out of range",
+			args:    []string{"-logo-opacity", "-0.5"},
+			wantErr: "logo opacity must be between 0 and 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveLogo := logoFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			logo, err := resolveLogo()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveLogo() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(logo, tt.want) {
+				t.Errorf("logo = %+v, want %+v", logo, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogoFromConfig(t *testing.T) {
+	path := writeManifest(t, "og.toml", "logo = \"brand.png\"\nlogo_circle = true\nlogo_size = 64.0\n")
+	opts, err := parseServeFlags([]string{"-config", path, "-logo-size", "100"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Logo.Path != "brand.png" || !opts.Logo.Circle || opts.Logo.Size != 100 {
+		t.Errorf("Logo = %+v", opts.Logo)
+	}
+}
+
+func TestTitleLayoutFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ogimage.Options
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: ogimage.Options{
+				Wrap:         ogimage.WrapGreedy,
+				VAlign:       ogimage.VAlignTop,
+				URLVAlign:    ogimage.VAlignBottom,
+				TitleMinSize: ogimage.TitleMinFontSize,
+			},
+		},
+		{
+			name: "fit with range",
+			args: []string{"-wrap", "balanced", "-hyphenate", "de", "-title-fit", "-title-min-size", "40", "-title-max-size", "96"},
+			want: ogimage.Options{
+				Wrap:         ogimage.WrapBalanced,
+				Hyphenate:    ogimage.HyphenateGerman,
+				VAlign:       ogimage.VAlignTop,
+				URLVAlign:    ogimage.VAlignBottom,
+				TitleFit:     true,
+				TitleMinSize: 40,
+				TitleMaxSize: 96,
+			},
+		},
+		{
+			name: "centered",
+			args: []string{"-align", "center", "-valign", "middle", "-url-align", "center", "-url-valign", "top"},
+			want: ogimage.Options{
+				Wrap:         ogimage.WrapGreedy,
+				Align:        ogimage.AlignCenter,
+				VAlign:       ogimage.VAlignMiddle,
+				URLAlign:     ogimage.AlignCenter,
+				URLVAlign:    ogimage.VAlignTop,
+				TitleMinSize: ogimage.TitleMinFontSize,
+			},
+		},
+		{
+			name:    "unknown wrap",
+			args:    []string{"-wrap", "optimal"},
+			wantErr: `unknown wrap "optimal"`,
+		},
+		{
+			name:    "unknown hyphenation language",
+			args:    []string{"-hyphenate", "fr"},
+			wantErr: `unknown hyphenation language "fr"`,
+		},
+		{
+			name:    "unknown url align",
+			args:    []string{"-url-align", "justify"},
+			wantErr: `unknown align "justify"`,
+		},
+		{
+			name:    "unknown valign",
+			args:    []string{"-valign", "center"},
+			wantErr: `unknown valign "center"`,
+		},
+		{
+			name:    "zero min",
+			args:    []string{"-title-min-size", "0"},
+			wantErr: "title-min-size must be positive",
+		},
+		{
+			name:    "min above max",
+			args:    []string{"-title-min-size", "80", "-title-max-size", "60"},
+			wantErr: "title-min-size must not be larger than title-max-size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveTitleLayout := titleLayoutFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var opts ogimage.Options
+			err := resolveTitleLayout(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveTitleLayout() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("opts = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ogimage.Options
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: ogimage.Options{TagPosition: ogimage.TagsAbove},
+		},
+		{
+			name: "beside with colors",
+			args: []string{"-tag-position", "beside", "-tag-color", "#333", "-tag-colors", "go=#00add8, rust = rgb(222, 165, 132)"},
+			want: ogimage.Options{
+				TagPosition: ogimage.TagsBeside,
+				TagColor:    "#333",
+				TagColors:   map[string]string{"go": "#00add8", "rust": "rgb(222, 165, 132)"},
+			},
+		},
+		{
+			name:    "unknown position",
+			args:    []string{"-tag-position", "below"},
+			wantErr: `unknown tag-position "below"`,
+		},
+		{
+			name:    "missing color",
+			args:    []string{"-tag-colors", "go"},
+			wantErr: `"go": want tag=color`,
+		},
+		{
+			name:    "invalid color",
+			args:    []string{"-tag-colors", "go=blurple"},
+			wantErr: "-tag-colors: go:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveTags := tagFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var opts ogimage.Options
+			err := resolveTags(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveTags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("opts = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestFontAxesFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ogimage.Options
+		wantErr string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "weight and axes",
+			args: []string{"-title-weight", "800", "-title-axes", "wdth=75, opsz = 72"},
+			want: ogimage.Options{
+				TitleWeight: 800,
+				TitleAxes:   map[string]float64{"wdth": 75, "opsz": 72},
+			},
+		},
+		{
+			name:    "weight out of range",
+			args:    []string{"-title-weight", "1200"},
+			wantErr: "title-weight 1200 out of range",
+		},
+		{
+			name:    "short tag",
+			args:    []string{"-title-axes", "wd=75"},
+			wantErr: `"wd=75": want a four-letter tag`,
+		},
+		{
+			name:    "not a number",
+			args:    []string{"-title-axes", "wdth=narrow"},
+			wantErr: `-title-axes: wdth: "narrow" is not a number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			resolveFontAxes := fontAxesFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var opts ogimage.Options
+			err := resolveFontAxes(&opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveFontAxes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("opts = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"go, performance,graphics", []string{"go", "performance", "graphics"}},
+		{" , go,, ", []string{"go"}},
+		{"a=rgb(1, 2, 3),b=#fff", []string{"a=rgb(1, 2, 3)", "b=#fff"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunInvalidColor(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	output := filepath.Join(t.TempDir(), "out.png")
+	os.Args = []string{"og-image-generator", "-title", "T", "-url", "https://example.com", "-output", output, "-bg", "#1a1a2"}
+	resetFlags()
+
+	err := run()
+	if err == nil || !strings.Contains(err.Error(), `-bg: invalid color "#1a1a2"`) {
+		t.Errorf("run() error = %v, want invalid color", err)
+	}
+	if fileExists(output) {
+		t.Error("no image should be written for an invalid color")
+	}
+}